@@ -0,0 +1,129 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+//ConnRequest is a connection request passed to AcceptFunc of a listening socket.
+
+type ConnRequest struct {
+	Peer     *net.UDPAddr //address of the connecting peer
+	StreamID string       //application data of the request, see Socket.SetStreamID
+	Socket   *Socket      //socket of the new connection, not connected yet
+}
+
+//AcceptFunc decides about a connection request before the connection is set up. It returns 0
+//to accept the connection, any other value rejects it and is sent to the peer as the reason,
+//connect of the peer fails with *RejectError. Options of req.Socket can be changed, for example
+//buffer sizes, bandwidth or congestion control picked by the stream ID, they apply to the
+//connection returned by Accept.
+//
+//AcceptFunc is called by UDT receiving thread, packets of all connections sharing the UDP port
+//wait until it returns, so it must return quickly. It may change options of the listening socket,
+//such as its handshake rate, pre-shared keys or AcceptFunc, which apply to following requests.
+//It must not close req.Socket.
+
+type AcceptFunc func(req *ConnRequest) (reason int)
+
+//RejectError is returned by connect when AcceptFunc of the listener rejected the connection.
+
+type RejectError struct {
+	Reason int //value returned by AcceptFunc of the listener
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("udt connect: %s, reason %d", UDT_ECONNREJ.String(), e.Reason)
+}
+
+//RejectError matches ErrConnRejected with errors.Is.
+
+func (e *RejectError) Is(target error) bool {
+	return target == ErrConnRejected
+}
+
+//AcceptFunc of listening sockets by UDT socket.
+
+var acceptFuncs sync.Map
+
+//Sets function deciding about connection requests of listening socket, nil accepts all of
+//them, which is the default. It can be set at any time, the function is released by Close.
+
+func (socket *Socket) SetAcceptFunc(fn AcceptFunc) error {
+	var hook C.UDT_ACCEPTHOOK
+	if fn != nil {
+		hook = acceptHook()
+		acceptFuncs.Store(socket.sock, &acceptEntry{fn: fn, af: socket.af})
+	}
+	if cret, errno := C.udt_setaccepthook(socket.sock, hook, nil); cret < 0 {
+		acceptFuncs.Delete(socket.sock)
+		return udtError("setaccepthook", errno)
+	}
+	if fn == nil {
+		acceptFuncs.Delete(socket.sock)
+	}
+	return nil
+}
+
+type acceptEntry struct {
+	fn AcceptFunc
+	af C.int
+}
+
+//export udtgoAcceptHook
+func udtgoAcceptHook(opaque unsafe.Pointer, lsn C.UDTSOCKET, ns C.UDTSOCKET, peer *C.struct_sockaddr, streamid *C.char, n C.int) C.int {
+	v, ok := acceptFuncs.Load(lsn)
+	if !ok {
+		//the listener is being closed
+		return 0
+	}
+	entry := v.(*acceptEntry)
+
+	raddr, _ := sockaddrToUDPAddr((*syscall.RawSockaddrAny)(unsafe.Pointer(peer)))
+	req := &ConnRequest{
+		Peer:     raddr,
+		StreamID: C.GoStringN(streamid, n),
+		Socket:   &Socket{sock: ns, af: entry.af, raddr: raddr},
+	}
+	return C.int(entry.fn(req))
+}
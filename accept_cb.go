@@ -0,0 +1,57 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+//Accept hook of listening sockets, see accept.go. It is kept apart from accept.go because
+//preamble of a file with exported functions must not contain definitions.
+
+/*
+#include "udtc.h"
+
+extern int udtgoAcceptHook(void* opaque, UDTSOCKET lsn, UDTSOCKET ns, struct sockaddr* peer, char* streamid, int len);
+
+static int udtgo_acceptHook(void* opaque, UDTSOCKET lsn, UDTSOCKET ns, const struct sockaddr* peer, const char* streamid, int len) {
+	return udtgoAcceptHook(opaque, lsn, ns, (struct sockaddr*)peer, (char*)streamid, len);
+}
+
+static UDT_ACCEPTHOOK udtgo_acceptHookPtr() {
+	return udtgo_acceptHook;
+}
+*/
+import "C"
+
+func acceptHook() C.UDT_ACCEPTHOOK {
+	return C.udtgo_acceptHookPtr()
+}
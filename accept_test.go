@@ -0,0 +1,111 @@
+package udtgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAcceptFunc(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", PORT9032)
+	l, err := NewListener("udt4", addr)
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+
+	const bandwidth = 10 << 20
+	err = l.(*Listener).SetAcceptFunc(func(req *ConnRequest) int {
+		if req.Peer == nil || req.Peer.Port == 0 {
+			t.Errorf("Request should have peer address got %v", req.Peer)
+		}
+		if req.StreamID != "ok" {
+			return 403
+		}
+		if err := req.Socket.SetMaxBandwidth(bandwidth); err != nil {
+			t.Errorf("Unable to set bandwidth of new connection %s", err)
+		}
+		return 0
+	})
+	if err != nil {
+		t.Fatalf("Unable to set accept func %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = DialContext(ctx, "udt4", addr, WithStreamID("forbidden"))
+	var rerr *RejectError
+	if !errors.As(err, &rerr) || rerr.Reason != 403 {
+		t.Fatalf("Dial should be rejected with reason 403 got %v", err)
+	}
+	if !errors.Is(err, ErrConnRejected) {
+		t.Errorf("Reject error should match ErrConnRejected")
+	}
+
+	c, err := DialContext(ctx, "udt4", addr, WithStreamID("ok"))
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+
+	ac, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept connection %s", err)
+	}
+	defer ac.Close()
+
+	socket := ac.(*Conn).Socket()
+	if id, err := socket.StreamID(); err != nil || id != "ok" {
+		t.Errorf("Stream ID should be %q got %q %v", "ok", id, err)
+	}
+	if bw, err := socket.MaxBandwidth(); err != nil || bw != bandwidth {
+		t.Errorf("Bandwidth should be %d got %d %v", bandwidth, bw, err)
+	}
+}
+
+func TestAcceptFuncChangesListener(t *testing.T) {
+	addr := fmt.Sprintf("127.0.0.1:%d", PORT9048)
+	l, err := NewListener("udt4", addr)
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+	lsn := l.(*Listener)
+
+	//options of the listener are changed while the request is being decided
+	err = lsn.SetAcceptFunc(func(req *ConnRequest) int {
+		if err := lsn.Socket().SetHandshakeRate(50); err != nil {
+			t.Errorf("Unable to set handshake rate in accept func %s", err)
+		}
+		if n, err := lsn.Socket().PreSharedKeyCount(); err != nil || n != 0 {
+			t.Errorf("Listener should have no keys got %d %v", n, err)
+		}
+		if err := lsn.SetAcceptFunc(func(req *ConnRequest) int { return 401 }); err != nil {
+			t.Errorf("Unable to replace accept func in accept func %s", err)
+		}
+		return 0
+	})
+	if err != nil {
+		t.Fatalf("Unable to set accept func %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := DialContext(ctx, "udt4", addr)
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+	if rate, err := lsn.Socket().HandshakeRate(); err != nil || rate != 50 {
+		t.Errorf("Handshake rate should be 50 got %d %v", rate, err)
+	}
+
+	_, err = DialContext(ctx, "udt4", addr)
+	var rerr *RejectError
+	if !errors.As(err, &rerr) || rerr.Reason != 401 {
+		t.Errorf("Dial should be rejected by the replaced accept func got %v", err)
+	}
+}
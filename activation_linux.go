@@ -0,0 +1,211 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+//Descriptor of the first socket passed by systemd socket activation, SD_LISTEN_FDS_START.
+
+const listenFDsStart = 3
+
+//Creates listener on an inherited UDP socket, for example one passed by the parent process
+//in exec.Cmd.ExtraFiles. The UDT stream socket gets IP family of fd, options are applied
+//before it is bound. The listener binds a duplicate of fd, which UDT closes with it. On
+//success fd itself is closed, on failure it stays open and owned by the caller.
+
+func FileListener(fd int, opts ...SocketOption) (*Listener, error) {
+
+	family, err := udpSocketFamily(fd)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+
+	socket, err := CreateSocket(family, true, opts...)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+
+	//UDT owns the duplicate once it is bound and closes it even if Listen fails
+	dup, err := dupFD(fd)
+	if err != nil {
+		Close(socket)
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+	if err = BindFD(socket, dup); err != nil {
+		syscall.Close(dup)
+		Close(socket)
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+	if _, err = Listen(socket, listenBacklog); err != nil {
+		Close(socket)
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+	syscall.Close(fd)
+
+	laddr, _ := getUDPAddr(socket, false)
+	return &Listener{
+		socket: socket,
+		laddr:  laddr,
+	}, nil
+}
+
+//Returns listeners on UDP sockets passed by systemd socket activation (LISTEN_PID and
+//LISTEN_FDS environment variables) in order of the descriptors. Other passed descriptors,
+//for example TCP sockets, are left to the application. The variables are unset so child
+//processes do not take the sockets again. No listeners and no error are returned if the
+//process was not started by socket activation.
+
+func SystemdListeners(opts ...SocketOption) ([]*Listener, error) {
+	return systemdListeners(listenFDsStart, opts)
+}
+
+func systemdListeners(start int, opts []SocketOption) ([]*Listener, error) {
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var listeners []*Listener
+	for fd := start; fd < start+n; fd++ {
+		if _, err := udpSocketFamily(fd); err != nil {
+			continue
+		}
+		l, err := FileListener(fd, opts...)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+//Sends UDP socket of the listener over Unix socket conn as SCM_RIGHTS, the process at the
+//other end, for example a new version of the server, takes it over with ReceiveListener and
+//accepts connections on the same port without a window in which it is closed.
+//
+//Both processes share the UDP socket afterwards and each one drops packets of the other's
+//connections. Transfers on connections of the sender slow down by orders of magnitude or
+//stall until they time out, so they should be finished before Handoff and the listener
+//closed right after it. Connection requests are retried and reach the new process.
+
+func (l *Listener) Handoff(conn *net.UnixConn) error {
+
+	fd, err := l.socket.UDPFD()
+	if err != nil {
+		return &net.OpError{Op: "handoff", Net: "udt", Addr: l.laddr, Err: err}
+	}
+	if _, _, err = conn.WriteMsgUnix([]byte{0}, syscall.UnixRights(fd), nil); err != nil {
+		return &net.OpError{Op: "handoff", Net: "udt", Addr: l.laddr, Err: err}
+	}
+	return nil
+}
+
+//Receives UDP socket sent by Listener.Handoff over Unix socket conn and creates listener on
+//it like FileListener.
+
+func ReceiveListener(conn *net.UnixConn, opts ...SocketOption) (*Listener, error) {
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: os.NewSyscallError("recvmsg", err)}
+	}
+	var fds []int
+	for i := range msgs {
+		if rights, err := syscall.ParseUnixRights(&msgs[i]); err == nil {
+			fds = append(fds, rights...)
+		}
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: fmt.Errorf("expected one descriptor, received %d", len(fds))}
+	}
+
+	l, err := FileListener(fds[0], opts...)
+	if err != nil {
+		syscall.Close(fds[0])
+		return nil, err
+	}
+	return l, nil
+}
+
+//Returns IP family for CreateSocket of UDP socket fd, fails if fd is not a UDP socket.
+
+func udpSocketFamily(fd int) (string, error) {
+
+	sotype, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return "", os.NewSyscallError("getsockopt", err)
+	}
+	if sotype != syscall.SOCK_DGRAM {
+		return "", fmt.Errorf("descriptor %d is not a UDP socket", fd)
+	}
+
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		return "", os.NewSyscallError("getsockname", err)
+	}
+	switch sa.(type) {
+	case *syscall.SockaddrInet4:
+		return "ip4", nil
+	case *syscall.SockaddrInet6:
+		return "ip6", nil
+	}
+	return "", fmt.Errorf("descriptor %d is not a UDP socket", fd)
+}
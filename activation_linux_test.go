@@ -0,0 +1,149 @@
+package udtgo
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//Dials address and waits until listener accepts the connection.
+
+func dialAccept(t *testing.T, l *Listener, port int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := DialContext(ctx, "udt4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+
+	ac, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept connection %s", err)
+	}
+	ac.Close()
+}
+
+func listenUDPFD(t *testing.T, port int) int {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatalf("Unable to listen UDP %s", err)
+	}
+	defer conn.Close()
+
+	fd, err := dupUDPConn(conn)
+	if err != nil {
+		t.Fatalf("Unable to duplicate UDP socket %s", err)
+	}
+	return fd
+}
+
+func TestSystemdListeners(t *testing.T) {
+	fd := listenUDPFD(t, PORT9038)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+	listeners, err := systemdListeners(fd, nil)
+	if err != nil {
+		syscall.Close(fd)
+		t.Fatalf("Unable to take over systemd sockets %s", err)
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("There should be one listener got %d", len(listeners))
+	}
+	l := listeners[0]
+	defer l.Close()
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("LISTEN_FDS should be unset")
+	}
+	if addr := l.Addr().(*net.UDPAddr); addr.Port != PORT9038 {
+		t.Errorf("Listener port should be %d got %v", PORT9038, addr)
+	}
+
+	dialAccept(t, l, PORT9038)
+}
+
+func TestFileListenerNotUDP(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Unable to create socket pair %s", err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	if _, err = FileListener(fds[0]); err == nil {
+		t.Errorf("Listener should not be created on Unix socket")
+	}
+}
+
+func TestFileListenerFailedKeepsFD(t *testing.T) {
+	fd := listenUDPFD(t, PORT9052)
+
+	if _, err := FileListener(fd, WithRendezvous(true)); err == nil {
+		syscall.Close(fd)
+		t.Fatalf("Listener should not be created on rendezvous socket")
+	}
+	//closed sockets are released by the UDT garbage collector
+	time.Sleep(2 * time.Second)
+	if _, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE); err != nil {
+		t.Fatalf("Descriptor should stay open after failure %s", err)
+	}
+
+	l, err := FileListener(fd)
+	if err != nil {
+		syscall.Close(fd)
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+
+	dialAccept(t, l, PORT9052)
+}
+
+func TestListenerHandoff(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Unable to create socket pair %s", err)
+	}
+	unixConn := func(fd int) *net.UnixConn {
+		f := os.NewFile(uintptr(fd), "handoff")
+		defer f.Close()
+		c, err := net.FileConn(f)
+		if err != nil {
+			t.Fatalf("Unable to create Unix connection %s", err)
+		}
+		return c.(*net.UnixConn)
+	}
+	parent, child := unixConn(fds[0]), unixConn(fds[1])
+	defer parent.Close()
+	defer child.Close()
+
+	nl, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9039))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	old := nl.(*Listener)
+
+	if err = old.Handoff(parent); err != nil {
+		old.Close()
+		t.Fatalf("Unable to hand off listener %s", err)
+	}
+	l, err := ReceiveListener(child)
+	old.Close()
+	if err != nil {
+		t.Fatalf("Unable to receive listener %s", err)
+	}
+	defer l.Close()
+
+	if addr := l.Addr().(*net.UDPAddr); addr.Port != PORT9039 {
+		t.Errorf("Listener port should be %d got %v", PORT9039, addr)
+	}
+
+	dialAccept(t, l, PORT9039)
+}
@@ -0,0 +1,347 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"fmt"
+	"runtime/cgo"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//CongestionControl is user defined congestion control algorithm, the Go version of
+//UDT CCC class (http://udt.sourceforge.net/udt4/doc/ccc.htm). Each connection gets its own
+//CongestionControl from the function passed to SetCongestionControl.
+//
+//Methods are called by UDT threads while UDT holds internal locks, they must return
+//quickly and must not call UDT functions on the same socket. OnPktSent and OnPktReceived
+//are called for every packet.
+
+type CongestionControl interface {
+	//Called when the connection is set up. c controls the connection until Close returns.
+	Init(c *CCControl)
+	//Called when the connection is closed.
+	Close()
+	//Called when ACK is received, ackNo is the acknowledged sequence number.
+	OnACK(ackNo int32)
+	//Called when loss report is received, see LossRanges for format of lossList.
+	OnLoss(lossList []int32)
+	//Called when retransmission timer expires.
+	OnTimeout()
+	//Called when data packet is sent.
+	OnPktSent(pkt *CCPacket)
+	//Called when data packet is received.
+	OnPktReceived(pkt *CCPacket)
+	//Called when user defined control packet sent by CCControl.SendCustomMsg is received.
+	ProcessCustomMsg(pkt *CCPacket)
+}
+
+//CCPacket describes packet passed to packet events of CongestionControl.
+
+type CCPacket struct {
+	Control   bool   //control packet, otherwise data packet
+	Type      int    //type of control packet, 0x7FFF for user defined packet
+	ExtType   int    //extended type of user defined control packet
+	SeqNo     int32  //sequence number of data packet
+	MsgNo     int32  //message number of data packet
+	Info      int32  //additional information of control packet
+	Timestamp int32  //timestamp in microseconds
+	Len       int    //payload size in bytes
+	Data      []byte //payload of user defined control packet, nil for other packets
+}
+
+//CCParams are connection parameters maintained by UDT, see CCControl.Params.
+
+type CCParams struct {
+	PktSndPeriod time.Duration //packet sending period
+	CWndSize     float64       //congestion window size in packets
+	MaxCWndSize  float64       //maximum congestion window size in packets, the flow window
+	MSS          int           //maximum packet size including all packet headers
+	SndCurrSeqNo int32         //largest sequence number sent out
+	RcvRate      int           //packet arrival rate at receiver side, packets per second
+	RTT          time.Duration //estimated round trip time
+	Bandwidth    int           //estimated bandwidth, packets per second
+	SYNInterval  time.Duration //UDT SYN interval (rate control period)
+}
+
+//CCControl gives CongestionControl access to its connection. It may only be used from
+//methods of the CongestionControl it was passed to.
+
+type CCControl struct {
+	ccc C.UDT_CCC
+}
+
+//Returns current parameters of the connection.
+
+func (c *CCControl) Params() CCParams {
+	var p C.UDT_CCPARAMS
+	C.udt_cc_getparams(c.ccc, &p)
+	return CCParams{
+		PktSndPeriod: time.Duration(float64(p.usPktSndPeriod) * float64(time.Microsecond)),
+		CWndSize:     float64(p.pktCWndSize),
+		MaxCWndSize:  float64(p.pktMaxCWndSize),
+		MSS:          int(p.mss),
+		SndCurrSeqNo: int32(p.sndCurrSeqNo),
+		RcvRate:      int(p.rcvRate),
+		RTT:          time.Duration(p.usRTT) * time.Microsecond,
+		Bandwidth:    int(p.bandwidth),
+		SYNInterval:  time.Duration(p.usSYNInterval) * time.Microsecond,
+	}
+}
+
+//Sets interval between two data packets, which controls the sending rate.
+
+func (c *CCControl) SetPktSndPeriod(period time.Duration) {
+	C.udt_cc_setpktsndperiod(c.ccc, C.double(float64(period)/float64(time.Microsecond)))
+}
+
+//Sets congestion window size, the maximum number of unacknowledged packets.
+
+func (c *CCControl) SetCWndSize(packets float64) {
+	C.udt_cc_setcwndsize(c.ccc, C.double(packets))
+}
+
+//Sets period of timer based acknowledging. UDT sends ACK at least every SYN interval.
+
+func (c *CCControl) SetACKTimer(period time.Duration) {
+	C.udt_cc_setacktimer(c.ccc, C.int(period/time.Millisecond))
+}
+
+//Sets number of received packets after which ACK is sent, 0 disables packet based acknowledging.
+
+func (c *CCControl) SetACKInterval(packets int) {
+	C.udt_cc_setackinterval(c.ccc, C.int(packets))
+}
+
+//Sets retransmission timeout, replacing timeout computed by UDT.
+
+func (c *CCControl) SetRTO(rto time.Duration) {
+	C.udt_cc_setrto(c.ccc, C.int(rto/time.Microsecond))
+}
+
+//Sends user defined control packet to the peer, which receives it in ProcessCustomMsg.
+//extType is 16 bit type chosen by the application.
+
+func (c *CCControl) SendCustomMsg(extType int, data []byte) {
+	var p *C.char
+	if len(data) > 0 {
+		p = (*C.char)(unsafe.Pointer(&data[0]))
+	}
+	C.udt_cc_sendcustommsg(c.ccc, C.int(extType), p, C.int(len(data)))
+}
+
+//BaseCC implements CongestionControl with no-op events. Embed it to implement only the
+//needed events, Init stores the CCControl in Control. Without changes UDT sends at
+//fixed rate, one packet per microsecond with window of 16 packets.
+
+type BaseCC struct {
+	Control *CCControl
+}
+
+func (b *BaseCC) Init(c *CCControl)              { b.Control = c }
+func (b *BaseCC) Close()                         {}
+func (b *BaseCC) OnACK(ackNo int32)              {}
+func (b *BaseCC) OnLoss(lossList []int32)        {}
+func (b *BaseCC) OnTimeout()                     {}
+func (b *BaseCC) OnPktSent(pkt *CCPacket)        {}
+func (b *BaseCC) OnPktReceived(pkt *CCPacket)    {}
+func (b *BaseCC) ProcessCustomMsg(pkt *CCPacket) {}
+
+//LossRange is a range of lost sequence numbers, both ends included.
+
+type LossRange struct {
+	From, To int32
+}
+
+//Decodes loss list passed to OnLoss. In the list a number with highest bit set starts a range
+//ending with the next number, other numbers are single lost packets.
+
+func LossRanges(lossList []int32) []LossRange {
+	ranges := make([]LossRange, 0, len(lossList))
+	for i := 0; i < len(lossList); i++ {
+		if lossList[i] < 0 && i+1 < len(lossList) {
+			ranges = append(ranges, LossRange{lossList[i] & 0x7FFFFFFF, lossList[i+1]})
+			i++
+		} else {
+			ranges = append(ranges, LossRange{lossList[i] & 0x7FFFFFFF, lossList[i] & 0x7FFFFFFF})
+		}
+	}
+	return ranges
+}
+
+//Sets user defined congestion control (UDT_CC). newCC is called for every connection
+//of the socket, including connections accepted by a listening socket. Must be set before
+//the socket is connected or listening.
+
+func (socket *Socket) SetCongestionControl(newCC func() CongestionControl) error {
+	if newCC == nil {
+		return fmt.Errorf("invalid value nil for %s", UDT_CC)
+	}
+	h := cgo.NewHandle(newCC)
+	defer h.Delete()
+	if cret, errno := C.udt_setcc(socket.sock, ccCallbacks(), C.uintptr_t(h)); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Returns user defined congestion control of a connected socket, or nil if the socket
+//uses UDT native congestion control, is not connected or is closed.
+
+func (socket *Socket) CongestionControl() CongestionControl {
+	var h C.uintptr_t
+	if cret, _ := C.udt_getcc(socket.sock, &h); cret < 0 || h == 0 {
+		return nil
+	}
+	//the socket may be closed and its instance released meanwhile
+	ccMu.Lock()
+	defer ccMu.Unlock()
+	if !ccLive[h] {
+		return nil
+	}
+	return cgo.Handle(h).Value().(*ccInstance).cc
+}
+
+//Sets user defined congestion control, UDT_CC.
+
+func WithCongestionControl(newCC func() CongestionControl) SocketOption {
+	return func(socket *Socket) error { return socket.SetCongestionControl(newCC) }
+}
+
+//Congestion control of one connection, its handle is owned by the C++ CCC object.
+
+type ccInstance struct {
+	cc   CongestionControl
+	ctrl *CCControl
+}
+
+//Handles of instances not released yet. UDT garbage collection thread releases the
+//instance of a closed socket, possibly while CongestionControl looks it up.
+
+var (
+	ccMu   sync.Mutex
+	ccLive = make(map[C.uintptr_t]bool)
+)
+
+func ccInstanceOf(h C.uintptr_t) *ccInstance {
+	return cgo.Handle(h).Value().(*ccInstance)
+}
+
+func ccPacket(p *C.UDT_CCPACKET, withData bool) *CCPacket {
+	pkt := &CCPacket{
+		Control:   p.control != 0,
+		Type:      int(p._type),
+		ExtType:   int(p.exttype),
+		SeqNo:     int32(p.seqno),
+		MsgNo:     int32(p.msgno),
+		Info:      int32(p.info),
+		Timestamp: int32(p.timestamp),
+		Len:       int(p.len),
+	}
+	if withData && p.len > 0 {
+		pkt.Data = C.GoBytes(unsafe.Pointer(p.data), p.len)
+	}
+	return pkt
+}
+
+//export udtgoCCCreate
+func udtgoCCCreate(factory C.uintptr_t, ccc C.UDT_CCC) C.uintptr_t {
+	newCC := cgo.Handle(factory).Value().(func() CongestionControl)
+	h := C.uintptr_t(cgo.NewHandle(&ccInstance{cc: newCC(), ctrl: &CCControl{ccc: ccc}}))
+	ccMu.Lock()
+	ccLive[h] = true
+	ccMu.Unlock()
+	return h
+}
+
+//export udtgoCCClone
+func udtgoCCClone(h C.uintptr_t) C.uintptr_t {
+	return C.uintptr_t(cgo.NewHandle(cgo.Handle(h).Value()))
+}
+
+//export udtgoCCRelease
+func udtgoCCRelease(h C.uintptr_t) {
+	ccMu.Lock()
+	defer ccMu.Unlock()
+	delete(ccLive, h)
+	cgo.Handle(h).Delete()
+}
+
+//export udtgoCCInit
+func udtgoCCInit(h C.uintptr_t) {
+	inst := ccInstanceOf(h)
+	inst.cc.Init(inst.ctrl)
+}
+
+//export udtgoCCClose
+func udtgoCCClose(h C.uintptr_t) {
+	ccInstanceOf(h).cc.Close()
+}
+
+//export udtgoCCOnACK
+func udtgoCCOnACK(h C.uintptr_t, ackNo C.int32_t) {
+	ccInstanceOf(h).cc.OnACK(int32(ackNo))
+}
+
+//export udtgoCCOnLoss
+func udtgoCCOnLoss(h C.uintptr_t, lossList *C.int32_t, size C.int) {
+	list := make([]int32, int(size))
+	copy(list, unsafe.Slice((*int32)(unsafe.Pointer(lossList)), int(size)))
+	ccInstanceOf(h).cc.OnLoss(list)
+}
+
+//export udtgoCCOnTimeout
+func udtgoCCOnTimeout(h C.uintptr_t) {
+	ccInstanceOf(h).cc.OnTimeout()
+}
+
+//export udtgoCCOnPktSent
+func udtgoCCOnPktSent(h C.uintptr_t, pkt *C.UDT_CCPACKET) {
+	ccInstanceOf(h).cc.OnPktSent(ccPacket(pkt, false))
+}
+
+//export udtgoCCOnPktReceived
+func udtgoCCOnPktReceived(h C.uintptr_t, pkt *C.UDT_CCPACKET) {
+	ccInstanceOf(h).cc.OnPktReceived(ccPacket(pkt, false))
+}
+
+//export udtgoCCProcessCustomMsg
+func udtgoCCProcessCustomMsg(h C.uintptr_t, pkt *C.UDT_CCPACKET) {
+	ccInstanceOf(h).cc.ProcessCustomMsg(ccPacket(pkt, true))
+}
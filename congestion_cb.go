@@ -0,0 +1,77 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+//Callback table of user defined congestion control. It is kept apart from congestion.go
+//because preamble of a file with exported functions must not contain definitions.
+
+/*
+#include "udtc.h"
+
+extern uintptr_t udtgoCCCreate(uintptr_t factory, UDT_CCC ccc);
+extern uintptr_t udtgoCCClone(uintptr_t h);
+extern void udtgoCCRelease(uintptr_t h);
+extern void udtgoCCInit(uintptr_t h);
+extern void udtgoCCClose(uintptr_t h);
+extern void udtgoCCOnACK(uintptr_t h, int32_t ackNo);
+extern void udtgoCCOnLoss(uintptr_t h, int32_t* lossList, int size);
+extern void udtgoCCOnTimeout(uintptr_t h);
+extern void udtgoCCOnPktSent(uintptr_t h, UDT_CCPACKET* pkt);
+extern void udtgoCCOnPktReceived(uintptr_t h, UDT_CCPACKET* pkt);
+extern void udtgoCCProcessCustomMsg(uintptr_t h, UDT_CCPACKET* pkt);
+
+static const UDT_CCCALLBACKS udtgo_cccallbacks = {
+	udtgoCCCreate,
+	udtgoCCClone,
+	udtgoCCRelease,
+	udtgoCCInit,
+	udtgoCCClose,
+	udtgoCCOnACK,
+	udtgoCCOnLoss,
+	udtgoCCOnTimeout,
+	udtgoCCOnPktSent,
+	udtgoCCOnPktReceived,
+	udtgoCCProcessCustomMsg,
+};
+
+static const UDT_CCCALLBACKS* udtgo_ccCallbacks() {
+	return &udtgo_cccallbacks;
+}
+*/
+import "C"
+
+func ccCallbacks() *C.UDT_CCCALLBACKS {
+	return C.udtgo_ccCallbacks()
+}
@@ -0,0 +1,150 @@
+package udtgo
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testCustomMsgType = 0x42
+
+//Fixed rate congestion control counting its events.
+
+type testCC struct {
+	BaseCC
+	acks, sent, received int64
+	closed               int32
+	customOnce           sync.Once
+	params               CCParams
+	custom               chan *CCPacket
+}
+
+func (cc *testCC) Init(c *CCControl) {
+	cc.BaseCC.Init(c)
+	c.SetPktSndPeriod(20 * time.Microsecond)
+	c.SetCWndSize(64)
+	c.SetACKInterval(8)
+}
+
+func (cc *testCC) OnACK(ackNo int32) {
+	atomic.AddInt64(&cc.acks, 1)
+	cc.customOnce.Do(func() {
+		cc.params = cc.Control.Params()
+		cc.Control.SendCustomMsg(testCustomMsgType, []byte("hello"))
+	})
+}
+
+func (cc *testCC) OnPktSent(pkt *CCPacket)     { atomic.AddInt64(&cc.sent, 1) }
+func (cc *testCC) OnPktReceived(pkt *CCPacket) { atomic.AddInt64(&cc.received, 1) }
+func (cc *testCC) Close()                      { atomic.StoreInt32(&cc.closed, 1) }
+
+func (cc *testCC) ProcessCustomMsg(pkt *CCPacket) {
+	select {
+	case cc.custom <- pkt:
+	default:
+	}
+}
+
+func TestCongestionControl(t *testing.T) {
+	serverCC := &testCC{custom: make(chan *CCPacket, 1)}
+	s, err := CreateSocket("ip4", true, WithCongestionControl(func() CongestionControl { return serverCC }))
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+	if _, err = Bind(s, PORT9020); err != nil {
+		t.Fatalf("Unable to bind socket %s", err)
+	}
+	if _, err = Listen(s, 1); err != nil {
+		t.Fatalf("Unable to listen socket %s", err)
+	}
+
+	dataSize := 1 << 20
+	received := make(chan int64, 1)
+	go func() {
+		ns, err := Accept(s)
+		if err != nil {
+			t.Errorf("Unable to accept request on socket %s", err)
+			received <- 0
+			return
+		}
+		c := NewConn(ns)
+		defer c.Close()
+		n, _ := io.Copy(io.Discard, c)
+		received <- n
+	}()
+
+	clientCC := &testCC{custom: make(chan *CCPacket, 1)}
+	sc, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	if _, err = Setsockopt(sc, UDT_CC, func() CongestionControl { return clientCC }); err != nil {
+		t.Fatalf("Unable to set congestion control %s", err)
+	}
+	if _, err = Connect(sc, "localhost", PORT9020); err != nil {
+		t.Fatalf("Unable to connect %s", err)
+	}
+	if cc := sc.CongestionControl(); cc != CongestionControl(clientCC) {
+		t.Errorf("Socket should return its congestion control got %v", cc)
+	}
+	if err = sc.SetCongestionControl(func() CongestionControl { return &BaseCC{} }); err == nil {
+		t.Errorf("Congestion control of connected socket should not change")
+	}
+
+	c := NewConn(sc)
+	if _, err = c.Write(make([]byte, dataSize)); err != nil {
+		t.Fatalf("Unable to write data %s", err)
+	}
+	stats, err := sc.Stats(false)
+	if err != nil {
+		t.Fatalf("Unable to get stats %s", err)
+	}
+	if stats.PktSndPeriod != 20*time.Microsecond {
+		t.Errorf("Packet sending period should be 20us got %v", stats.PktSndPeriod)
+	}
+
+	select {
+	case pkt := <-serverCC.custom:
+		if !pkt.Control || pkt.ExtType != testCustomMsgType || string(pkt.Data) != "hello" {
+			t.Errorf("Unexpected custom message %+v", pkt)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Custom message was not received")
+	}
+
+	c.Close()
+	if n := <-received; n != int64(dataSize) {
+		t.Errorf("Server should receive %d bytes got %d", dataSize, n)
+	}
+	if atomic.LoadInt64(&clientCC.acks) == 0 || atomic.LoadInt64(&clientCC.sent) < int64(dataSize/1456) {
+		t.Errorf("Client should see ACKs and sent packets got %d %d", clientCC.acks, clientCC.sent)
+	}
+	if atomic.LoadInt64(&serverCC.received) < int64(dataSize/1456) {
+		t.Errorf("Server should see received packets got %d", serverCC.received)
+	}
+	if p := clientCC.params; p.MSS != 1500 || p.CWndSize != 64 {
+		t.Errorf("Unexpected congestion control parameters %+v", p)
+	}
+	if atomic.LoadInt32(&clientCC.closed) == 0 {
+		t.Errorf("Client congestion control should be closed")
+	}
+	if cc := sc.CongestionControl(); cc != nil {
+		t.Errorf("Closed socket should have no congestion control got %v", cc)
+	}
+}
+
+func TestLossRanges(t *testing.T) {
+	ranges := LossRanges([]int32{5, -0x80000000 | 10, 20, 30})
+	want := []LossRange{{5, 5}, {10, 20}, {30, 30}}
+	if len(ranges) != len(want) {
+		t.Fatalf("Expected %v got %v", want, ranges)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("Expected %v got %v", want, ranges)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//Longest time a single blocking UDT call waits before deadlines are checked again.
+//This makes deadlines changed during a pending Read or Write take effect.
+
+const maxBlockTime = 250 * time.Millisecond
+
+//Common part of stream and message connections: socket ownership, addresses and
+//deadlines. Read and Write deadlines are applied with UDT_RCVTIMEO and UDT_SNDTIMEO options.
+
+type udtConn struct {
+	socket *Socket
+
+	rmu    sync.Mutex //serializes Read calls
+	rtimeo int        //UDT_RCVTIMEO value set on the socket, guarded by rmu
+	wmu    sync.Mutex //serializes Write calls
+	wtimeo int        //UDT_SNDTIMEO value set on the socket, guarded by wmu
+
+	mu        sync.Mutex
+	rdeadline time.Time
+	wdeadline time.Time
+	closed    bool
+}
+
+func (c *udtConn) init(socket *Socket) {
+	c.socket = socket
+	c.rtimeo = -1
+	c.wtimeo = -1
+}
+
+//Conn wraps connected UDT stream socket (SOCK_STREAM) and implements net.Conn.
+
+type Conn struct {
+	udtConn
+}
+
+//Use this function to wrap connected UDT stream socket into Conn. Conn takes
+//ownership of the socket, closing Conn closes the socket.
+
+func NewConn(socket *Socket) *Conn {
+	c := &Conn{}
+	c.init(socket)
+	return c
+}
+
+//Reads data from the connection. Read returns io.EOF once the peer closed the
+//connection and all received data is consumed.
+
+func (c *Conn) Read(b []byte) (n int, err error) {
+	if c.isClosed() {
+		return 0, c.opError("read", net.ErrClosed)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for {
+		if err = c.applyReadDeadline(); err != nil {
+			return 0, c.opError("read", err)
+		}
+
+		retval, errno := C.udt_recv(c.socket.sock, (*C.char)(unsafe.Pointer(&b[0])), C.int(len(b)), C.int(0))
+		if retval >= 0 {
+			return int(retval), nil
+		}
+		err = udtError("recv", errno)
+
+		switch {
+		case errors.Is(err, ErrTimeout):
+			continue
+		case c.isClosed():
+			return 0, c.opError("read", net.ErrClosed)
+		case errors.Is(err, ErrConnLost) || errors.Is(err, ErrNoConn):
+			return 0, io.EOF
+		}
+		return 0, c.opError("read", err)
+	}
+}
+
+//Writes data to the connection. Write blocks until all data is handed over
+//to UDT sending buffer or write deadline expires.
+
+func (c *Conn) Write(b []byte) (n int, err error) {
+	if c.isClosed() {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	for n < len(b) {
+		if err = c.applyWriteDeadline(); err != nil {
+			return n, c.opError("write", err)
+		}
+
+		retval, errno := C.udt_send(c.socket.sock, (*C.char)(unsafe.Pointer(&b[n])), C.int(len(b)-n), C.int(0))
+		if retval >= 0 {
+			n += int(retval)
+			continue
+		}
+		err = udtError("send", errno)
+
+		if errors.Is(err, ErrTimeout) {
+			continue
+		}
+		if c.isClosed() {
+			err = net.ErrClosed
+		}
+		return n, c.opError("write", err)
+	}
+	return n, nil
+}
+
+//Closes the connection and underlying UDT socket. Any blocked Read or Write
+//operations are unblocked and return errors.
+
+func (c *udtConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.opError("close", net.ErrClosed)
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	if _, err := Close(c.socket); err != nil {
+		return c.opError("close", err)
+	}
+	return nil
+}
+
+//Returns local network address, it is *net.UDPAddr.
+
+func (c *udtConn) LocalAddr() net.Addr {
+	addr, err := getUDPAddr(c.socket, false)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+//Returns remote network address, it is *net.UDPAddr.
+
+func (c *udtConn) RemoteAddr() net.Addr {
+	addr, err := Peeraddr(c.socket)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+//Sets read and write deadlines. A zero value for t means I/O operations will not time out.
+
+func (c *udtConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	c.rdeadline = t
+	c.wdeadline = t
+	return nil
+}
+
+//Sets deadline for future and pending Read calls.
+
+func (c *udtConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	c.rdeadline = t
+	return nil
+}
+
+//Sets deadline for future and pending Write calls.
+
+func (c *udtConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return c.opError("set", net.ErrClosed)
+	}
+	c.wdeadline = t
+	return nil
+}
+
+//Makes pending and future Read (read is true) or Write calls fail when ctx is done, by moving
+//the deadline into the past. Deadline of ctx is applied as well if it is earlier. Returned
+//function stops watching and restores the previous deadline, unless it was set again
+//meanwhile.
+
+func (c *udtConn) watchContext(ctx context.Context, read bool) (stop func()) {
+	deadline := &c.wdeadline
+	if read {
+		deadline = &c.rdeadline
+	}
+
+	c.mu.Lock()
+	saved := *deadline
+	if d, ok := ctx.Deadline(); ok && (saved.IsZero() || d.Before(saved)) {
+		*deadline = d
+	}
+	installed := *deadline
+	c.mu.Unlock()
+
+	stopped := false
+	cancel := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		if !stopped {
+			//a deadline set by the caller meanwhile is restored instead
+			if !deadline.Equal(installed) {
+				saved = *deadline
+			}
+			*deadline = time.Unix(1, 0)
+			installed = *deadline
+		}
+		c.mu.Unlock()
+	})
+	return func() {
+		cancel()
+		c.mu.Lock()
+		stopped = true
+		if deadline.Equal(installed) {
+			*deadline = saved
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *udtConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+//Returns underlying UDT socket.
+
+func (c *udtConn) Socket() *Socket {
+	return c.socket
+}
+
+//Sets UDT_RCVTIMEO for the next blocking receive call from read deadline. Caller holds rmu.
+
+func (c *udtConn) applyReadDeadline() error {
+	timeo, err := c.timeout(true)
+	if err != nil {
+		return err
+	}
+	if timeo != c.rtimeo {
+		if err = setIntOpt(c.socket, C.UDT_UDT_RCVTIMEO, timeo); err != nil {
+			return err
+		}
+		c.rtimeo = timeo
+	}
+	return nil
+}
+
+//Sets UDT_SNDTIMEO for the next blocking send call from write deadline. Caller holds wmu.
+
+func (c *udtConn) applyWriteDeadline() error {
+	timeo, err := c.timeout(false)
+	if err != nil {
+		return err
+	}
+	if timeo != c.wtimeo {
+		if err = setIntOpt(c.socket, C.UDT_UDT_SNDTIMEO, timeo); err != nil {
+			return err
+		}
+		c.wtimeo = timeo
+	}
+	return nil
+}
+
+//Computes UDT timeout in milliseconds for the next blocking call from read or write
+//deadline. Returns os.ErrDeadlineExceeded if the deadline has already passed.
+
+func (c *udtConn) timeout(read bool) (int, error) {
+	c.mu.Lock()
+	deadline := c.wdeadline
+	if read {
+		deadline = c.rdeadline
+	}
+	c.mu.Unlock()
+
+	wait := maxBlockTime
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if remaining < wait {
+			wait = remaining
+		}
+	}
+	return int((wait + time.Millisecond - 1) / time.Millisecond), nil
+}
+
+func (c *udtConn) opError(op string, err error) error {
+	opErr := &net.OpError{Op: op, Net: "udt", Err: err}
+	if addr := c.LocalAddr(); addr != nil {
+		opErr.Source = addr
+	}
+	if addr := c.RemoteAddr(); addr != nil {
+		opErr.Addr = addr
+	}
+	return opErr
+}
@@ -0,0 +1,155 @@
+package udtgo
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnReadWrite(t *testing.T) {
+	s, err := startServer(PORT9010, "ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	message := "Hello from Kamlesh\n"
+
+	go func() {
+		sc, err := startClient("ip4", "localhost", PORT9010, true)
+		if err != nil {
+			t.Errorf("Unable to start client %s", err)
+			return
+		}
+		c := NewConn(sc)
+		defer c.Close()
+
+		if _, err := io.WriteString(c, message); err != nil {
+			t.Errorf("Unable to write data %s", err)
+		}
+	}()
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept request on socket %s", err)
+	}
+	var c net.Conn = NewConn(ns)
+	defer c.Close()
+
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unable to read data %s", err)
+	}
+	if line != message {
+		t.Errorf("Message should be %q got %q", message, line)
+	}
+
+	if _, ok := c.LocalAddr().(*net.UDPAddr); !ok {
+		t.Errorf("Local address should be *net.UDPAddr got %v", c.LocalAddr())
+	}
+	if addr, ok := c.RemoteAddr().(*net.UDPAddr); !ok || !addr.IP.IsLoopback() {
+		t.Errorf("Remote address should be loopback *net.UDPAddr got %v", c.RemoteAddr())
+	}
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data := make([]byte, 10)
+	if _, err = c.Read(data); err != io.EOF {
+		t.Errorf("Read should return EOF after peer closed got %v", err)
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	s, err := startServer(PORT9011, "ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		sc, err := startClient("ip4", "localhost", PORT9011, true)
+		if err != nil {
+			t.Errorf("Unable to start client %s", err)
+			return
+		}
+		<-done
+		Close(sc)
+	}()
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept request on socket %s", err)
+	}
+	c := NewConn(ns)
+	defer c.Close()
+
+	start := time.Now()
+	c.SetReadDeadline(start.Add(300 * time.Millisecond))
+
+	data := make([]byte, 10)
+	_, err = c.Read(data)
+	nerr, ok := err.(net.Error)
+	if !ok || !nerr.Timeout() {
+		t.Fatalf("Read should time out got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Read timed out after %s", elapsed)
+	}
+}
+
+func TestConnWatchContextDeadline(t *testing.T) {
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	c := NewConn(s)
+	defer c.Close()
+	rdeadline := func() time.Time {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.rdeadline
+	}
+
+	//deadline of ctx is applied while watching and the previous one restored afterwards
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	stop := c.watchContext(ctx, true)
+	if d, _ := ctx.Deadline(); !rdeadline().Equal(d) {
+		t.Errorf("Read deadline should be deadline of ctx got %v", rdeadline())
+	}
+	stop()
+	if !rdeadline().IsZero() {
+		t.Errorf("Read deadline should be restored got %v", rdeadline())
+	}
+
+	//deadline set by the caller while watching is kept
+	set := time.Now().Add(time.Minute)
+	stop = c.watchContext(ctx, true)
+	c.SetReadDeadline(set)
+	stop()
+	if !rdeadline().Equal(set) {
+		t.Errorf("Read deadline should be %v got %v", set, rdeadline())
+	}
+
+	//also when ctx was cancelled afterwards
+	set = set.Add(time.Minute)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	stop = c.watchContext(ctx2, true)
+	c.SetReadDeadline(set)
+	cancel2()
+	for start := time.Now(); !rdeadline().Equal(time.Unix(1, 0)) && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	if !rdeadline().Equal(time.Unix(1, 0)) {
+		t.Errorf("Cancelled ctx should move read deadline into the past got %v", rdeadline())
+	}
+	stop()
+	if !rdeadline().Equal(set) {
+		t.Errorf("Read deadline should be %v got %v", set, rdeadline())
+	}
+}
@@ -0,0 +1,279 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include <stdlib.h>
+// #include "udtc.h"
+import "C"
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+//Block sizes of native file transfer, same as Sendfile and Recvfile.
+
+const (
+	sendfileBlock = 7320000
+	recvfileBlock = 366000
+)
+
+//File open in the operating system such as *os.File. Matching methods instead of *os.File
+//also finds files wrapped by os.File.WriteTo, which io.Copy prefers to Conn.ReadFrom.
+
+type osFile interface {
+	io.Seeker
+	Stat() (os.FileInfo, error)
+	SyscallConn() (syscall.RawConn, error)
+}
+
+//Sends size bytes read from r over the connection. If size is negative, SendFrom sends
+//until r returns io.EOF. Returns io.ErrUnexpectedEOF if r ends before size bytes are sent.
+//Regular files are sent by UDT directly, see Conn.ReadFrom.
+
+func SendFrom(conn *Conn, r io.Reader, size int64) (n int64, err error) {
+	if size < 0 {
+		return conn.ReadFrom(r)
+	}
+	n, err = conn.ReadFrom(io.LimitReader(r, size))
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+//Receives size bytes from the connection and writes them to w. If size is negative,
+//RecvTo receives until the peer closes the connection. Returns io.ErrUnexpectedEOF if the
+//connection is closed before size bytes are received. Regular files are written by UDT
+//directly, see Conn.WriteTo.
+
+func RecvTo(conn *Conn, w io.Writer, size int64) (n int64, err error) {
+	if size < 0 {
+		return conn.WriteTo(w)
+	}
+	n, err = conn.writeTo(w, size)
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+//Implements io.ReaderFrom, so io.Copy to the connection uses it. If r is a regular *os.File,
+//or *io.LimitedReader of one, and no write deadline is set, the file is sent by UDT
+//sendfile without copying it through Go buffers. The native transfer is not interrupted
+//by deadlines set while it runs, only by Close.
+
+func (c *Conn) ReadFrom(r io.Reader) (n int64, err error) {
+	if c.isClosed() {
+		return 0, c.opError("readfrom", net.ErrClosed)
+	}
+
+	remain := int64(math.MaxInt64)
+	lr, limited := r.(*io.LimitedReader)
+	if limited {
+		remain, r = lr.N, lr.R
+		if remain <= 0 {
+			return 0, nil
+		}
+	}
+	f, ok := r.(osFile)
+	if !ok || c.hasDeadline(false) {
+		if limited {
+			r = lr
+		}
+		return c.copyFrom(r)
+	}
+	if !nativeFile(f) {
+		if limited {
+			r = lr
+		}
+		return c.copyFrom(r)
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, c.opError("readfrom", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, c.opError("readfrom", err)
+	}
+	if size := fi.Size() - offset; size < remain {
+		remain = size
+	}
+	if remain <= 0 {
+		return 0, nil
+	}
+
+	n, err = transferFile(c.socket, f, offset, remain, true)
+	if _, serr := f.Seek(offset+n, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	if limited {
+		lr.N -= n
+	}
+	if err != nil {
+		if c.isClosed() {
+			err = net.ErrClosed
+		}
+		return n, c.opError("readfrom", err)
+	}
+	return n, nil
+}
+
+//Implements io.WriterTo, so io.Copy from the connection uses it. WriteTo writes data to w
+//until the peer closes the connection. If w is a regular *os.File and no read deadline is
+//set, data is written to the file by UDT recvfile without copying it through Go buffers.
+
+func (c *Conn) WriteTo(w io.Writer) (n int64, err error) {
+	return c.writeTo(w, -1)
+}
+
+//Writes up to size bytes to w, until the peer closes the connection if size is negative.
+
+func (c *Conn) writeTo(w io.Writer, size int64) (n int64, err error) {
+	if c.isClosed() {
+		return 0, c.opError("writeto", net.ErrClosed)
+	}
+	if size == 0 {
+		return 0, nil
+	}
+
+	f, ok := w.(osFile)
+	if !ok || c.hasDeadline(true) {
+		return c.copyTo(w, size)
+	}
+	if !nativeFile(f) {
+		return c.copyTo(w, size)
+	}
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, c.opError("writeto", err)
+	}
+	remain := size
+	if remain < 0 {
+		remain = math.MaxInt64
+	}
+
+	n, err = transferFile(c.socket, f, offset, remain, false)
+	if _, serr := f.Seek(offset+n, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	switch {
+	case err == nil:
+		return n, nil
+	case c.isClosed():
+		return n, c.opError("writeto", net.ErrClosed)
+	case errors.Is(err, ErrConnLost) || errors.Is(err, ErrNoConn):
+		//peer closed the connection, same as io.EOF from Read
+		return n, nil
+	}
+	return n, c.opError("writeto", err)
+}
+
+//Sends or receives size bytes of file f starting at offset with UDT sendfile or recvfile.
+//Sendfile reopens the file for reading by its path, recvfile writes through the descriptor
+//of f, so files opened write-only are received too. Closing f waits until the transfer ends.
+//Returns number of bytes transferred also when the transfer fails.
+
+func transferFile(socket *Socket, f osFile, offset, size int64, send bool) (n int64, err error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	pos := C.int64_t(offset)
+	cerr := rc.Control(func(fd uintptr) {
+		if send {
+			cpath := C.CString(nativeFilePath(fd))
+			defer C.free(unsafe.Pointer(cpath))
+			if cret, errno := C.udt_sendfile2(socket.sock, cpath, &pos, C.int64_t(size), C.int(sendfileBlock)); cret < 0 {
+				err = udtError("sendfile", errno)
+			}
+		} else if cret, errno := C.udt_recvfile_fd(socket.sock, C.int(fd), &pos, C.int64_t(size), C.int(recvfileBlock)); cret < 0 {
+			err = udtError("recvfile", errno)
+		}
+	})
+	if cerr != nil {
+		return 0, cerr
+	}
+	return int64(pos) - offset, err
+}
+
+//Hides ReadFrom and WriteTo of Conn from io.Copy in the buffered fallback.
+
+type connWriter struct{ c *Conn }
+
+func (w connWriter) Write(b []byte) (int, error) { return w.c.Write(b) }
+
+type connReader struct{ c *Conn }
+
+func (r connReader) Read(b []byte) (int, error) { return r.c.Read(b) }
+
+func (c *Conn) copyFrom(r io.Reader) (int64, error) {
+	return io.Copy(connWriter{c}, r)
+}
+
+func (c *Conn) copyTo(w io.Writer, size int64) (int64, error) {
+	if size < 0 {
+		return io.Copy(w, connReader{c})
+	}
+	n, err := io.CopyN(w, connReader{c}, size)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (c *udtConn) hasDeadline(read bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if read {
+		return !c.rdeadline.IsZero()
+	}
+	return !c.wdeadline.IsZero()
+}
@@ -0,0 +1,177 @@
+package udtgo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//Returns connected client and server connections on port, opts are applied to the client socket.
+
+func connPair(t *testing.T, port int, opts ...SocketOption) (client, server *Conn) {
+	s, err := startServer(port, "ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	accepted := make(chan *Socket, 1)
+	go func() {
+		ns, err := Accept(s)
+		if err != nil {
+			t.Errorf("Unable to accept request on socket %s", err)
+		}
+		accepted <- ns
+	}()
+
+	sc, err := CreateSocket("ip4", true, opts...)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	if _, err = Connect(sc, "localhost", port); err != nil {
+		t.Fatalf("Unable to connect %s", err)
+	}
+	ns := <-accepted
+	if ns == nil {
+		t.FailNow()
+	}
+	return NewConn(sc), NewConn(ns)
+}
+
+func TestConnReadFromFile(t *testing.T) {
+	client, server := connPair(t, PORT9021)
+	defer server.Close()
+
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	skip := int64(1000)
+	go func() {
+		defer client.Close()
+		f, err := os.Open(src)
+		if err != nil {
+			t.Errorf("Unable to open file %s", err)
+			return
+		}
+		defer f.Close()
+		if _, err = f.Seek(skip, io.SeekStart); err != nil {
+			t.Errorf("Unable to seek file %s", err)
+			return
+		}
+		if n, err := io.Copy(client, f); err != nil || n != int64(len(data))-skip {
+			t.Errorf("Unable to send file %d %s", n, err)
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != int64(len(data)) {
+			t.Errorf("File offset should be at the end got %d", pos)
+		}
+	}()
+
+	//existing content before the current offset must be kept
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatalf("Unable to create file %s", err)
+	}
+	defer dst.Close()
+	if _, err = dst.Write(data[:skip]); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	if n, err := io.Copy(dst, server); err != nil || n != int64(len(data))-skip {
+		t.Fatalf("Unable to receive file %d %s", n, err)
+	}
+	if _, err = dst.Write([]byte("end")); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	got, err := os.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatalf("Unable to read file %s", err)
+	}
+	if !bytes.Equal(got, append(data, "end"...)) {
+		t.Errorf("Received file differs from sent file, %d bytes", len(got))
+	}
+}
+
+func TestSendFromRecvTo(t *testing.T) {
+	client, server := connPair(t, PORT9022)
+	defer server.Close()
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	go func() {
+		defer client.Close()
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write(data)
+			pw.Close()
+		}()
+		if n, err := SendFrom(client, pr, 1000); err != nil || n != 1000 {
+			t.Errorf("Unable to send first part %d %s", n, err)
+		}
+		if n, err := SendFrom(client, pr, -1); err != nil || n != int64(len(data))-1000 {
+			t.Errorf("Unable to send rest %d %s", n, err)
+		}
+		if n, err := SendFrom(client, bytes.NewReader(data[:10]), 20); !errors.Is(err, io.ErrUnexpectedEOF) || n != 10 {
+			t.Errorf("Short reader should fail with unexpected EOF got %d %v", n, err)
+		}
+	}()
+
+	var buf bytes.Buffer
+	if n, err := RecvTo(server, &buf, int64(len(data))); err != nil || n != int64(len(data)) {
+		t.Fatalf("Unable to receive data %d %s", n, err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Received data differs from sent data")
+	}
+	if n, err := RecvTo(server, io.Discard, 20); !errors.Is(err, io.ErrUnexpectedEOF) || n != 10 {
+		t.Errorf("Closed connection should fail with unexpected EOF got %d %v", n, err)
+	}
+}
+
+func TestConnWriteToWriteOnlyFile(t *testing.T) {
+	client, server := connPair(t, PORT9044)
+	defer server.Close()
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+	go func() {
+		defer client.Close()
+		if _, err := client.Write(data); err != nil {
+			t.Errorf("Unable to send data %s", err)
+		}
+	}()
+
+	//the file cannot be reopened for reading, recvfile must write through its descriptor
+	path := filepath.Join(t.TempDir(), "dst")
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0200)
+	if err != nil {
+		t.Fatalf("Unable to create file %s", err)
+	}
+	defer dst.Close()
+	if n, err := io.Copy(dst, server); err != nil || n != int64(len(data)) {
+		t.Fatalf("Unable to receive file %d %s", n, err)
+	}
+	if pos, _ := dst.Seek(0, io.SeekCurrent); pos != int64(len(data)) {
+		t.Errorf("File offset should be at the end got %d", pos)
+	}
+
+	if err = os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Unable to change file mode %s", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read file %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Received file differs from sent file, %d bytes", len(got))
+	}
+}
@@ -0,0 +1,381 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+)
+
+//Longest time a single epoll wait blocks before context is checked again.
+
+const connectPollInterval = 50 * time.Millisecond
+
+//Time the next connection attempt waits for the previous one, Connection Attempt Delay
+//of RFC 8305.
+
+const connectAttemptDelay = 250 * time.Millisecond
+
+//Dial connects to the address on the named network like DialContext without a deadline.
+
+func Dial(network, address string, opts ...SocketOption) (net.Conn, error) {
+	return DialContext(context.Background(), network, address, opts...)
+}
+
+//DialContext connects to the address on the named network using UDT stream socket.
+//Network must be udt, udt4 or udt6. The connection is set up asynchronously
+//(UDT_RCVSYN is off during connect) and completion is waited for with UDT epoll, so
+//cancellation or deadline of ctx aborts the connect. On failure or abort the
+//UDT socket is closed. Returned connection is *Conn in blocking mode. Options are applied
+//to the socket before connecting, for example WithStreamID. Connection rejected by
+//AcceptFunc of the listener fails with *RejectError.
+//
+//Host names are resolved to all their IPv4 and IPv6 addresses (only one family for udt4
+//and udt6) which are tried as RFC 8305 Happy Eyeballs does: families alternate and a new
+//attempt, on a socket of the address family, starts when the previous one fails or has
+//not finished in 250ms. The first connection set up is returned and the other attempts
+//are closed. If all of them fail the error of the first attempt is returned.
+
+func DialContext(ctx context.Context, network, address string, opts ...SocketOption) (net.Conn, error) {
+
+	raddrs, err := resolveUDTAddrs(ctx, network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "udt", Err: err}
+	}
+
+	socket, raddr, err := dialParallel(ctx, interleaveAddrs(raddrs), opts)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "udt", Addr: raddr, Err: err}
+	}
+
+	return NewConn(socket), nil
+}
+
+//Resolves network and address in form of host:port to all addresses of the host usable on
+//the network. Empty host is the loopback address.
+
+func resolveUDTAddrs(ctx context.Context, network, address string) ([]*net.UDPAddr, error) {
+
+	var ipNetwork string
+	switch network {
+	case "udt":
+		ipNetwork = "ip"
+	case "udt4", "ip4":
+		ipNetwork = "ip4"
+	case "udt6", "ip6":
+		ipNetwork = "ip6"
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	host, service, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.DefaultResolver.LookupPort(ctx, "udp", service)
+	if err != nil {
+		return nil, err
+	}
+
+	if host == "" {
+		if ipNetwork == "ip6" {
+			return []*net.UDPAddr{{IP: net.IPv6loopback, Port: port}}, nil
+		}
+		return []*net.UDPAddr{{IP: net.IPv4(127, 0, 0, 1), Port: port}}, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var raddrs []*net.UDPAddr
+	for _, ip := range ips {
+		is4 := ip.IP.To4() != nil
+		if (ipNetwork == "ip4" && !is4) || (ipNetwork == "ip6" && is4) {
+			continue
+		}
+		raddrs = append(raddrs, &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone})
+	}
+	if len(raddrs) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return raddrs, nil
+}
+
+//Orders addresses for connection attempts, families alternate starting with the family of
+//the first address which the resolver prefers.
+
+func interleaveAddrs(raddrs []*net.UDPAddr) []*net.UDPAddr {
+
+	var primary, fallback []*net.UDPAddr
+	for _, raddr := range raddrs {
+		if len(primary) == 0 || (raddr.IP.To4() != nil) == (primary[0].IP.To4() != nil) {
+			primary = append(primary, raddr)
+		} else {
+			fallback = append(fallback, raddr)
+		}
+	}
+
+	ordered := make([]*net.UDPAddr, 0, len(raddrs))
+	for i := 0; i < len(primary) || i < len(fallback); i++ {
+		if i < len(primary) {
+			ordered = append(ordered, primary[i])
+		}
+		if i < len(fallback) {
+			ordered = append(ordered, fallback[i])
+		}
+	}
+	return ordered
+}
+
+type dialResult struct {
+	index  int //position of the address in raddrs
+	socket *Socket
+	raddr  *net.UDPAddr
+	err    error
+}
+
+//Connects to raddrs in order, starting the next attempt when the previous one failed or
+//connectAttemptDelay passed. Returns socket of the first attempt that succeeds, the rest
+//are aborted and their sockets closed. If all of them fail, returns address and error of
+//the attempt started first, whichever attempt finished first.
+
+func dialParallel(ctx context.Context, raddrs []*net.UDPAddr, opts []SocketOption) (*Socket, *net.UDPAddr, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(raddrs))
+	started, pending := 0, 0
+	var delay <-chan time.Time
+
+	startNext := func() {
+		index, raddr := started, raddrs[started]
+		go func() {
+			socket, err := dialAddr(ctx, raddr, opts)
+			results <- dialResult{index: index, socket: socket, raddr: raddr, err: err}
+		}()
+		started++
+		pending++
+		delay = nil
+		if started < len(raddrs) {
+			delay = time.After(connectAttemptDelay)
+		}
+	}
+
+	errs := make([]error, len(raddrs))
+	startNext()
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				//attempts still running see cancelled ctx, one may succeed meanwhile
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if res := <-results; res.err == nil {
+							Close(res.socket)
+						}
+					}
+				}(pending)
+				return res.socket, res.raddr, nil
+			}
+			errs[res.index] = res.err
+			if started < len(raddrs) {
+				startNext()
+			}
+		case <-delay:
+			startNext()
+		}
+	}
+	return nil, raddrs[0], errs[0]
+}
+
+//Creates stream socket of IP family of raddr and connects it.
+
+func dialAddr(ctx context.Context, raddr *net.UDPAddr, opts []SocketOption) (*Socket, error) {
+
+	family := "ip4"
+	if raddr.IP.To4() == nil {
+		family = "ip6"
+	}
+
+	socket, err := CreateSocket(family, true, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = connectContext(ctx, socket, raddr); err != nil {
+		Close(socket)
+		return nil, err
+	}
+	return socket, nil
+}
+
+//DialRendezvous sets up connection with a peer which calls DialRendezvous with the addresses
+//swapped at about the same time, for example after both peers learned their public addresses
+//from a third party. UDT stream socket in rendezvous mode is bound to laddr, nil or zero port
+//picks a free port, and both sides send connection requests to each other until they meet.
+//Options are applied before the socket is bound.
+//
+//Attempts which expire before ctx is done are repeated on the same local port. Without a
+//deadline of ctx DialRendezvous fails after UDT rendezvous timeout of 30 seconds. Returned
+//connection is *Conn in blocking mode as returned by DialContext.
+
+func DialRendezvous(ctx context.Context, laddr, raddr *net.UDPAddr, opts ...SocketOption) (net.Conn, error) {
+
+	family := "ip4"
+	if raddr.IP.To4() == nil {
+		family = "ip6"
+	}
+	opts = append(opts[:len(opts):len(opts)], WithRendezvous(true))
+
+	for {
+		socket, err := CreateSocket(family, true, opts...)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: "udt", Source: laddr, Addr: raddr, Err: err}
+		}
+		if err = BindAddr(socket, laddr); err != nil {
+			Close(socket)
+			return nil, &net.OpError{Op: "dial", Net: "udt", Source: laddr, Addr: raddr, Err: err}
+		}
+		if laddr == nil || laddr.Port == 0 {
+			//the peer knows the port, it must not change when connect is repeated
+			laddr, _ = socket.LocalAddr()
+		}
+
+		err = connectContext(ctx, socket, raddr)
+		if err == nil {
+			return NewConn(socket), nil
+		}
+		Close(socket)
+
+		var uerr *Error
+		_, hasDeadline := ctx.Deadline()
+		if !hasDeadline || ctx.Err() != nil || !errors.As(err, &uerr) || uerr.Code != UDT_ENOSERVER {
+			return nil, &net.OpError{Op: "dial", Net: "udt", Source: laddr, Addr: raddr, Err: err}
+		}
+	}
+}
+
+//Starts asynchronous connect of the socket to raddr and waits until connection is
+//set up, fails or ctx is done. Socket is switched back to blocking receiving mode
+//once it is connected.
+
+func connectContext(ctx context.Context, socket *Socket, raddr *net.UDPAddr) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := setBoolOpt(socket, C.UDT_UDT_RCVSYN, false); err != nil {
+		return err
+	}
+
+	eid, err := EpollCreate()
+	if err != nil {
+		return err
+	}
+	defer EpollRelease(eid)
+
+	if _, err = EpollAddUsock(eid, socket, UDT_EPOLL_OUT|UDT_EPOLL_ERR); err != nil {
+		return err
+	}
+	defer EpollRemoveUsock(eid, socket)
+
+	rsa, salen, err := udpAddrToSockaddr(raddr, socket.af)
+	if err != nil {
+		return fmt.Errorf("could not convert syscall.Sockaddr to syscall.RawSockaddrAny %s", err)
+	}
+	if cret, errno := C.udt_connect(socket.sock, (*C.struct_sockaddr)(unsafe.Pointer(rsa)), C.int(salen)); cret != 0 {
+		return udtError("connect", errno)
+	}
+
+	for {
+		ready, err := waitWritable(eid, socket, connectPollInterval)
+		if err != nil {
+			return err
+		}
+		if ready {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+
+	switch state, _ := Getsockstate(socket); state {
+	case CONNECTED:
+	case BROKEN, CLOSED:
+		//UDT reports failed asynchronous connect only by the socket state, a rejected
+		//request breaks the socket while a timed out one stays connecting
+		if reason, _ := getIntOpt(socket, C.UDT_UDT_REJECTREASON); reason != 0 {
+			return &RejectError{Reason: reason}
+		}
+		return &Error{Code: UDT_ECONNREJ, Op: "connect", Msg: UDT_ECONNREJ.String()}
+	default:
+		return &Error{Code: UDT_ENOSERVER, Op: "connect", Msg: UDT_ENOSERVER.String()}
+	}
+
+	return setBoolOpt(socket, C.UDT_UDT_RCVSYN, true)
+}
+
+//Waits on epoll eid until the socket reports write or error event or timeout expires.
+//Returns false if timeout expired.
+
+func waitWritable(eid int, socket *Socket, timeout time.Duration) (ready bool, err error) {
+
+	var wfds [1]C.UDTSOCKET
+	wnum := C.int(len(wfds))
+
+	if cret, errno := C.udt_epoll_wait2(C.int(eid), nil, nil, &wfds[0], &wnum, C.int64_t(timeout/time.Millisecond),
+		nil, nil, nil, nil); cret < 0 {
+		if err = udtError("epoll_wait", errno); errors.Is(err, ErrTimeout) {
+			return false, nil
+		}
+		return false, err
+	}
+	return wnum > 0 && wfds[0] == socket.sock, nil
+}
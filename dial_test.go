@@ -0,0 +1,213 @@
+package udtgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDialContext(t *testing.T) {
+	l, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9014))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+
+	message := "Hello from Kamlesh"
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Errorf("Unable to accept connection %s", err)
+			return
+		}
+		defer c.Close()
+		io.WriteString(c, message)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := DialContext(ctx, "udt", fmt.Sprintf("localhost:%d", PORT9014))
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+
+	state, _ := Getsockstate(c.(*Conn).Socket())
+	if state != CONNECTED {
+		t.Errorf("Socket status should be %d got :%d", CONNECTED, state)
+	}
+
+	data := make([]byte, len(message))
+	if _, err = io.ReadFull(c, data); err != nil {
+		t.Fatalf("Unable to read data %s", err)
+	}
+	if string(data) != message {
+		t.Errorf("Message should be %q got %q", message, data)
+	}
+}
+
+func TestDialContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	//nothing listens on this port, UDT would keep trying for several seconds
+	_, err := DialContext(ctx, "udt4", fmt.Sprintf("127.0.0.1:%d", PORT9015))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dial should fail with context.DeadlineExceeded got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Dial was aborted after %s", elapsed)
+	}
+}
+
+func TestInterleaveAddrs(t *testing.T) {
+	a6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::1")}
+	b6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::2")}
+	c6 := &net.UDPAddr{IP: net.ParseIP("2001:db8::3")}
+	a4 := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1)}
+	b4 := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2)}
+
+	got := interleaveAddrs([]*net.UDPAddr{a6, b6, c6, a4, b4})
+	want := []*net.UDPAddr{a6, a4, b6, b4, c6}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Addresses should be ordered %v got %v", want, got)
+	}
+}
+
+func TestDialFallback(t *testing.T) {
+	l, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9036))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+
+	//the accepted connection stays open until the test ends, closing it at once can break the
+	//connection before the dialing side sees it set up
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	defer func() {
+		select {
+		case c := <-accepted:
+			c.Close()
+		case <-time.After(time.Second):
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	//nothing listens on the IPv6 address, the IPv4 attempt starts after the attempt delay
+	raddrs := []*net.UDPAddr{
+		{IP: net.IPv6loopback, Port: PORT9036},
+		{IP: net.IPv4(127, 0, 0, 1), Port: PORT9036},
+	}
+	start := time.Now()
+	socket, raddr, err := dialParallel(ctx, raddrs, nil)
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer Close(socket)
+
+	if raddr != raddrs[1] || socket.af != syscall.AF_INET {
+		t.Errorf("Connection should use IPv4 socket to %v got %v family %d", raddrs[1], raddr, socket.af)
+	}
+	if elapsed := time.Since(start); elapsed < connectAttemptDelay {
+		t.Errorf("IPv4 attempt should wait %s got %s", connectAttemptDelay, elapsed)
+	}
+}
+
+func TestDialParallelError(t *testing.T) {
+	l, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9049))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+	if err = l.(*Listener).SetAcceptFunc(func(req *ConnRequest) int { return 403 }); err != nil {
+		t.Fatalf("Unable to set accept func %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	//the IPv4 attempt is rejected long before the IPv6 attempt fails
+	raddrs := []*net.UDPAddr{
+		{IP: net.IPv6loopback, Port: PORT9049},
+		{IP: net.IPv4(127, 0, 0, 1), Port: PORT9049},
+	}
+	_, raddr, err := dialParallel(ctx, raddrs, nil)
+	if err == nil {
+		t.Fatalf("Dial should fail")
+	}
+	if raddr != raddrs[0] || errors.Is(err, ErrConnRejected) {
+		t.Errorf("Error of the first address should be returned got %v %v", raddr, err)
+	}
+}
+
+func TestDialRendezvous(t *testing.T) {
+	addr1 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9041}
+	addr2 := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9042}
+	message := "Hello from Kamlesh"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		c, err := DialRendezvous(ctx, addr2, addr1)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer c.Close()
+		_, err = io.WriteString(c, message)
+		done <- err
+	}()
+
+	c, err := DialRendezvous(ctx, addr1, addr2)
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+
+	if rendezvous, err := c.(*Conn).Socket().Rendezvous(); err != nil || !rendezvous {
+		t.Errorf("Socket should be in rendezvous mode %v", err)
+	}
+	if raddr := c.RemoteAddr().(*net.UDPAddr); raddr.Port != PORT9042 {
+		t.Errorf("Remote address should be %v got %v", addr2, raddr)
+	}
+
+	data := make([]byte, len(message))
+	if _, err = io.ReadFull(c, data); err != nil {
+		t.Fatalf("Unable to read data %s", err)
+	}
+	if string(data) != message {
+		t.Errorf("Message should be %q got %q", message, data)
+	}
+	if err = <-done; err != nil {
+		t.Errorf("Peer failed %s", err)
+	}
+}
+
+func TestDialRendezvousTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	//the peer never shows up
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9043}
+	_, err := DialRendezvous(ctx, nil, raddr)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Dial should fail with context.DeadlineExceeded got %v", err)
+	}
+}
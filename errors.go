@@ -0,0 +1,217 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+)
+
+//ErrorCode is UDT error code (http://udt.sourceforge.net/udt4/doc/ecode.htm).
+
+type ErrorCode int
+
+const (
+	UDT_SUCCESS      ErrorCode = C.UDT_SUCCESS
+	UDT_ECONNSETUP   ErrorCode = C.UDT_ECONNSETUP
+	UDT_ENOSERVER    ErrorCode = C.UDT_ENOSERVER
+	UDT_ECONNREJ     ErrorCode = C.UDT_ECONNREJ
+	UDT_ESOCKFAIL    ErrorCode = C.UDT_ESOCKFAIL
+	UDT_ESECFAIL     ErrorCode = C.UDT_ESECFAIL
+	UDT_ECONNFAIL    ErrorCode = C.UDT_ECONNFAIL
+	UDT_ECONNLOST    ErrorCode = C.UDT_ECONNLOST
+	UDT_ENOCONN      ErrorCode = C.UDT_ENOCONN
+	UDT_ERESOURCE    ErrorCode = C.UDT_ERESOURCE
+	UDT_ETHREAD      ErrorCode = C.UDT_ETHREAD
+	UDT_ENOBUF       ErrorCode = C.UDT_ENOBUF
+	UDT_EFILE        ErrorCode = C.UDT_EFILE
+	UDT_EINVRDOFF    ErrorCode = C.UDT_EINVRDOFF
+	UDT_ERDPERM      ErrorCode = C.UDT_ERDPERM
+	UDT_EINVWROFF    ErrorCode = C.UDT_EINVWROFF
+	UDT_EWRPERM      ErrorCode = C.UDT_EWRPERM
+	UDT_EINVOP       ErrorCode = C.UDT_EINVOP
+	UDT_EBOUNDSOCK   ErrorCode = C.UDT_EBOUNDSOCK
+	UDT_ECONNSOCK    ErrorCode = C.UDT_ECONNSOCK
+	UDT_EINVPARAM    ErrorCode = C.UDT_EINVPARAM
+	UDT_EINVSOCK     ErrorCode = C.UDT_EINVSOCK
+	UDT_EUNBOUNDSOCK ErrorCode = C.UDT_EUNBOUNDSOCK
+	UDT_ENOLISTEN    ErrorCode = C.UDT_ENOLISTEN
+	UDT_ERDVNOSERV   ErrorCode = C.UDT_ERDVNOSERV
+	UDT_ERDVUNBOUND  ErrorCode = C.UDT_ERDVUNBOUND
+	UDT_ESTREAMILL   ErrorCode = C.UDT_ESTREAMILL
+	UDT_EDGRAMILL    ErrorCode = C.UDT_EDGRAMILL
+	UDT_EDUPLISTEN   ErrorCode = C.UDT_EDUPLISTEN
+	UDT_ELARGEMSG    ErrorCode = C.UDT_ELARGEMSG
+	UDT_EINVPOLLID   ErrorCode = C.UDT_EINVPOLLID
+	UDT_EASYNCFAIL   ErrorCode = C.UDT_EASYNCFAIL
+	UDT_EASYNCSND    ErrorCode = C.UDT_EASYNCSND
+	UDT_EASYNCRCV    ErrorCode = C.UDT_EASYNCRCV
+	UDT_ETIMEOUT     ErrorCode = C.UDT_ETIMEOUT
+	UDT_EPEERERR     ErrorCode = C.UDT_EPEERERR
+	UDT_EUNKNOWN     ErrorCode = C.UDT_EUNKNOWN
+)
+
+//Descriptions of UDT error codes, same as reported by UDT core.
+
+var errorMessages = map[ErrorCode]string{
+	UDT_SUCCESS:      "Success",
+	UDT_ECONNSETUP:   "Connection setup failure",
+	UDT_ENOSERVER:    "Connection setup failure: connection time out",
+	UDT_ECONNREJ:     "Connection setup failure: connection rejected",
+	UDT_ESOCKFAIL:    "Connection setup failure: unable to create/configure UDP socket",
+	UDT_ESECFAIL:     "Connection setup failure: abort for security reasons",
+	UDT_ECONNFAIL:    "Connection failure",
+	UDT_ECONNLOST:    "Connection was broken",
+	UDT_ENOCONN:      "Connection does not exist",
+	UDT_ERESOURCE:    "System resource failure",
+	UDT_ETHREAD:      "System resource failure: unable to create new threads",
+	UDT_ENOBUF:       "System resource failure: unable to allocate buffers",
+	UDT_EFILE:        "File system failure",
+	UDT_EINVRDOFF:    "File system failure: cannot seek read position",
+	UDT_ERDPERM:      "File system failure: failure in read",
+	UDT_EINVWROFF:    "File system failure: cannot seek write position",
+	UDT_EWRPERM:      "File system failure: failure in write",
+	UDT_EINVOP:       "Operation not supported",
+	UDT_EBOUNDSOCK:   "Operation not supported: Cannot do this operation on a BOUND socket",
+	UDT_ECONNSOCK:    "Operation not supported: Cannot do this operation on a CONNECTED socket",
+	UDT_EINVPARAM:    "Operation not supported: Bad parameters",
+	UDT_EINVSOCK:     "Operation not supported: Invalid socket ID",
+	UDT_EUNBOUNDSOCK: "Operation not supported: Cannot do this operation on an UNBOUND socket",
+	UDT_ENOLISTEN:    "Operation not supported: Socket is not in listening state",
+	UDT_ERDVNOSERV:   "Operation not supported: Listen/accept is not supported in rendezous connection setup",
+	UDT_ERDVUNBOUND:  "Operation not supported: Cannot call connect on UNBOUND socket in rendezvous connection setup",
+	UDT_ESTREAMILL:   "Operation not supported: This operation is not supported in SOCK_STREAM mode",
+	UDT_EDGRAMILL:    "Operation not supported: This operation is not supported in SOCK_DGRAM mode",
+	UDT_EDUPLISTEN:   "Operation not supported: Another socket is already listening on the same port",
+	UDT_ELARGEMSG:    "Operation not supported: Message is too large to send",
+	UDT_EINVPOLLID:   "Operation not supported: Invalid epoll ID",
+	UDT_EASYNCFAIL:   "Non-blocking call failure",
+	UDT_EASYNCSND:    "Non-blocking call failure: no buffer available for sending",
+	UDT_EASYNCRCV:    "Non-blocking call failure: no data available for reading",
+	UDT_ETIMEOUT:     "Non-blocking call failure: timeout",
+	UDT_EPEERERR:     "The peer side has signalled an error",
+	UDT_EUNKNOWN:     "Unknown error",
+}
+
+//Returns description of the error code.
+
+func (code ErrorCode) String() string {
+	if msg, ok := errorMessages[code]; ok {
+		return msg
+	}
+	return fmt.Sprintf("Unknown error %d", int(code))
+}
+
+//Error describes failed UDT call. Error implements net.Error and matches sentinel
+//errors such as ErrConnLost or ErrTimeout with errors.Is.
+
+type Error struct {
+	Code ErrorCode //UDT error code
+	Op   string    //UDT function which failed, e.g. "send" or "connect"
+	Msg  string    //description of the error
+}
+
+//Sentinel errors to be used with errors.Is. They match any *Error with the same code,
+//ErrWouldBlock matches all non-blocking call failures.
+
+var (
+	ErrConnLost      = &Error{Code: UDT_ECONNLOST, Msg: UDT_ECONNLOST.String()}
+	ErrNoConn        = &Error{Code: UDT_ENOCONN, Msg: UDT_ENOCONN.String()}
+	ErrTimeout       = &Error{Code: UDT_ETIMEOUT, Msg: UDT_ETIMEOUT.String()}
+	ErrWouldBlock    = &Error{Code: UDT_EASYNCFAIL, Msg: UDT_EASYNCFAIL.String()}
+	ErrInvalidSocket = &Error{Code: UDT_EINVSOCK, Msg: UDT_EINVSOCK.String()}
+	ErrMsgTooLarge   = &Error{Code: UDT_ELARGEMSG, Msg: UDT_ELARGEMSG.String()}
+	ErrConnRejected  = &Error{Code: UDT_ECONNREJ, Msg: UDT_ECONNREJ.String()}
+)
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("udt: %s (%d)", e.Msg, int(e.Code))
+	}
+	return fmt.Sprintf("udt %s: %s (%d)", e.Op, e.Msg, int(e.Code))
+}
+
+//Reports whether the error is a timeout of blocking call (UDT_ETIMEOUT).
+
+func (e *Error) Timeout() bool {
+	return e.Code == UDT_ETIMEOUT
+}
+
+//Reports whether the call may succeed when repeated, it is true for timeouts and
+//non-blocking call failures.
+
+func (e *Error) Temporary() bool {
+	return e.Timeout() || e.wouldBlock()
+}
+
+//Matches sentinel errors by error code.
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t.Op != "" {
+		return false
+	}
+	if t == ErrWouldBlock {
+		return e.wouldBlock()
+	}
+	return t.Code == e.Code
+}
+
+func (e *Error) wouldBlock() bool {
+	return e.Code == UDT_EASYNCFAIL || e.Code == UDT_EASYNCSND || e.Code == UDT_EASYNCRCV
+}
+
+//Creates error of failed UDT call op. errno is C errno returned by the cgo call, the C
+//API sets it to UDT error code so the code is read in the same call which failed. UDT
+//keeps last error per OS thread and the goroutine may have moved to another thread
+//since, the thread-local error is only used with libudt which does not set errno.
+
+func udtError(op string, errno error) error {
+	var code ErrorCode
+	if en, ok := errno.(syscall.Errno); ok && isErrorCode(int(en)) {
+		code = ErrorCode(en)
+	} else {
+		code = ErrorCode(C.udt_getlasterror_code())
+	}
+	return &Error{Code: code, Op: op, Msg: code.String()}
+}
+
+func isErrorCode(code int) bool {
+	_, ok := errorMessages[ErrorCode(code)]
+	return ok && code != int(UDT_SUCCESS)
+}
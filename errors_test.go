@@ -0,0 +1,90 @@
+package udtgo
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	err := error(&Error{Code: UDT_ECONNLOST, Op: "recv", Msg: UDT_ECONNLOST.String()})
+	if !errors.Is(err, ErrConnLost) || errors.Is(err, ErrTimeout) {
+		t.Errorf("Error should match ErrConnLost only %v", err)
+	}
+	if err.Error() != "udt recv: Connection was broken (2001)" {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	var nerr net.Error
+	err = &Error{Code: UDT_ETIMEOUT, Op: "send"}
+	if !errors.As(err, &nerr) || !nerr.Timeout() || !errors.Is(err, ErrTimeout) {
+		t.Errorf("Timeout error should implement net.Error and match ErrTimeout %v", err)
+	}
+
+	for _, code := range []ErrorCode{UDT_EASYNCFAIL, UDT_EASYNCSND, UDT_EASYNCRCV} {
+		if err = (&Error{Code: code, Op: "send"}); !errors.Is(err, ErrWouldBlock) {
+			t.Errorf("Error %d should match ErrWouldBlock", code)
+		}
+	}
+	if errors.Is(&Error{Code: UDT_EASYNCSND}, &Error{Code: UDT_EASYNCSND, Op: "send"}) {
+		t.Errorf("Only sentinel errors should match by code")
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+
+	data := make([]byte, 10)
+	_, err = Recv(s, &data[0], len(data))
+	var uerr *Error
+	if !errors.As(err, &uerr) || uerr.Code != UDT_ENOCONN || uerr.Op != "recv" {
+		t.Fatalf("Recv on unconnected socket should fail with %d got %v", UDT_ENOCONN, err)
+	}
+	if !errors.Is(err, ErrNoConn) {
+		t.Errorf("Error should match ErrNoConn %v", err)
+	}
+
+	if _, err = EpollRelease(-1); !errors.As(err, &uerr) || uerr.Code != UDT_EINVPOLLID {
+		t.Errorf("EpollRelease with invalid ID should fail with %d got %v", UDT_EINVPOLLID, err)
+	}
+}
+
+//Failing calls from many goroutines must report their own error codes.
+
+func TestErrorCodeConcurrent(t *testing.T) {
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := make([]byte, 10)
+			for j := 0; j < 500; j++ {
+				var err error
+				want := UDT_ENOCONN
+				if i%2 == 0 {
+					_, err = Recv(s, &data[0], len(data))
+				} else {
+					want = UDT_EUNBOUNDSOCK
+					_, err = Listen(s, 1)
+				}
+				var uerr *Error
+				if !errors.As(err, &uerr) || uerr.Code != want {
+					t.Errorf("Expected error %d got %v", want, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -37,14 +37,6 @@ func main()  {
 
 	fmt.Printf("staring client to %s %d \n", host, portno)
 
-	s, err := startClient(network, host, portno, isStream)
-
-	if err != nil {
-		fmt.Printf("Unable to start client %s %d error:%s", host, portno, err)
-		return
-	}
-	defer udtgo.Close(s)
-
 	fi, err := os.Lstat(fileName)
 	if err != nil {
 		fmt.Printf("Unable read file %s error:%s", fileName, err)
@@ -62,12 +54,14 @@ func main()  {
 		return
 	}
 
-	n, err := udtgo.Send(s, &msg[0], len(msg))
+	//the request travels in the connection handshake as the stream ID
+	s, err := startClient(network, host, portno, isStream, string(msg))
 
 	if err != nil {
-		fmt.Printf("Unable to send request %s %d", err, n)
+		fmt.Printf("Unable to start client %s %d error:%s", host, portno, err)
 		return
 	}
+	defer udtgo.Close(s)
 
 	fmt.Printf("Request sent %s \n", string(msg))
 
@@ -83,9 +77,9 @@ func main()  {
 
 }
 
-func startClient(network string, host string, portno int, isStream bool) (socket *udtgo.Socket, err error) {
+func startClient(network string, host string, portno int, isStream bool, request string) (socket *udtgo.Socket, err error) {
 
-	socket, err = udtgo.CreateSocket(network, isStream)
+	socket, err = udtgo.CreateSocket(network, isStream, udtgo.WithStreamID(request))
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create socket :%s", err)
 	}
@@ -57,8 +57,12 @@ func main() {
 func handleRequest(socket *udtgo.Socket, uploadDir string) {
 
 	defer udtgo.Close(socket)
-	//receive message
-	request, err := receiveRequest(socket)
+	//the request arrives as the handshake stream ID, older clients send it after connecting
+	request, err := socket.StreamID()
+
+	if err == nil && request == "" {
+		request, err = receiveRequest(socket)
+	}
 
 	if err != nil {
 		fmt.Printf("Unable to get request %s", err)
@@ -128,6 +132,15 @@ func receiveRequest(socket *udtgo.Socket) (request string, err error){
 
 func startServer(portno int, network string, isStream bool) (socket *udtgo.Socket, err error) {
 
+	//take over the socket passed by systemd socket activation, if any
+	listeners, err := udtgo.SystemdListeners()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to use systemd socket :%s", err)
+	}
+	if len(listeners) > 0 {
+		return listeners[0].Socket(), nil
+	}
+
 	socket, err = udtgo.CreateSocket(network, isStream)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create socket :%s", err)
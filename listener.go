@@ -0,0 +1,150 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+import (
+	"net"
+	"sync"
+)
+
+//Number of pending connections of the sockets created by NewListener.
+
+const listenBacklog = 1024
+
+//Listener accepts UDT stream connections and implements net.Listener.
+
+type Listener struct {
+	socket *Socket
+	laddr  *net.UDPAddr
+
+	mu     sync.Mutex
+	closed bool
+}
+
+//Use this function to create listener bound to the passed address in form of host:port.
+//Network must be udt, udt4 or udt6. The function creates UDT stream socket, binds it and
+//turns it into listening state. Empty host listens on wildcard address, IPv4 for udt and
+//udt4 networks and IPv6 for udt6 network.
+
+func NewListener(network, address string) (net.Listener, error) {
+
+	family, addr, err := resolveUDTAddr(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Err: err}
+	}
+
+	socket, err := CreateSocket(family, true)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt", Addr: addr, Err: err}
+	}
+
+	if err = BindAddr(socket, addr); err != nil {
+		Close(socket)
+		return nil, &net.OpError{Op: "listen", Net: "udt", Addr: addr, Err: err}
+	}
+
+	if _, err = Listen(socket, listenBacklog); err != nil {
+		Close(socket)
+		return nil, &net.OpError{Op: "listen", Net: "udt", Addr: addr, Err: err}
+	}
+
+	laddr, err := getUDPAddr(socket, false)
+	if err != nil {
+		laddr = addr
+	}
+
+	return &Listener{
+		socket: socket,
+		laddr:  laddr,
+	}, nil
+}
+
+//Waits for and returns the next connection as *Conn. Accept returns error wrapping
+//net.ErrClosed once the listener is closed, including Accept calls blocked at that time.
+
+func (l *Listener) Accept() (net.Conn, error) {
+
+	socket, err := Accept(l.socket)
+	if err != nil {
+		if l.isClosed() {
+			err = net.ErrClosed
+		}
+		return nil, &net.OpError{Op: "accept", Net: "udt", Addr: l.laddr, Err: err}
+	}
+
+	return NewConn(socket), nil
+}
+
+//Closes the listener and its UDT socket. Already accepted connections are not closed.
+
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return &net.OpError{Op: "close", Net: "udt", Addr: l.laddr, Err: net.ErrClosed}
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	if _, err := Close(l.socket); err != nil {
+		return &net.OpError{Op: "close", Net: "udt", Addr: l.laddr, Err: err}
+	}
+	return nil
+}
+
+//Returns listener's network address, it is *net.UDPAddr.
+
+func (l *Listener) Addr() net.Addr {
+	return l.laddr
+}
+
+//Sets function deciding about connection requests before Accept returns them, see
+//Socket.SetAcceptFunc.
+
+func (l *Listener) SetAcceptFunc(fn AcceptFunc) error {
+	return l.socket.SetAcceptFunc(fn)
+}
+
+//Returns underlying listening UDT socket.
+
+func (l *Listener) Socket() *Socket {
+	return l.socket
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
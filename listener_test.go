@@ -0,0 +1,76 @@
+package udtgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenerAccept(t *testing.T) {
+	l, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9012))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+	defer l.Close()
+
+	message := "Hello from Kamlesh"
+
+	go sendData(t, "ip4", "localhost", PORT9012, true, message)
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept connection %s", err)
+	}
+	defer c.Close()
+
+	addr, ok := c.RemoteAddr().(*net.UDPAddr)
+	if !ok || !addr.IP.Equal(net.IPv4(127, 0, 0, 1)) || addr.Port == 0 {
+		t.Errorf("Remote address should be 127.0.0.1 with port got %v", c.RemoteAddr())
+	}
+	if af := c.(*Conn).Socket().af; af != syscall.AF_INET {
+		t.Errorf("Accepted socket family should be %d got %d", syscall.AF_INET, af)
+	}
+
+	data := make([]byte, len(message))
+	if _, err = io.ReadFull(c, data); err != nil {
+		t.Fatalf("Unable to read data %s", err)
+	}
+	if string(data) != message {
+		t.Errorf("Message should be %q got %q", message, data)
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := NewListener("udt", fmt.Sprintf(":%d", PORT9013))
+	if err != nil {
+		t.Fatalf("Unable to create listener %s", err)
+	}
+
+	if addr, ok := l.Addr().(*net.UDPAddr); !ok || addr.Port != PORT9013 {
+		t.Errorf("Listener address should have port %d got %v", PORT9013, l.Addr())
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err = l.Close(); err != nil {
+		t.Fatalf("Unable to close listener %s", err)
+	}
+
+	select {
+	case err = <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Accept should return net.ErrClosed got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Accept was not unblocked by Close")
+	}
+}
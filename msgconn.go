@@ -0,0 +1,193 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+	"unsafe"
+)
+
+//Options of a single message sent by MsgConn.WriteMsg. Zero TTL uses default TTL of
+//the socket set by SetMsgTTL, which is infinite unless changed.
+
+type MsgOptions struct {
+	TTL     time.Duration //time to live of the message
+	InOrder bool          //deliver message in order of sending
+}
+
+//TruncatedMsgError is returned by ReadMsg when the received message is larger than
+//the passed buffer. The buffer holds beginning of the message, rest of the message
+//is discarded.
+
+type TruncatedMsgError struct {
+	BufLen int //size of the buffer passed to ReadMsg
+}
+
+func (e *TruncatedMsgError) Error() string {
+	return fmt.Sprintf("message truncated to %d bytes buffer", e.BufLen)
+}
+
+//TruncatedMsgError matches io.ErrShortBuffer with errors.Is.
+
+func (e *TruncatedMsgError) Is(target error) bool {
+	return target == io.ErrShortBuffer
+}
+
+//MsgConn wraps connected UDT message socket (SOCK_DGRAM). Message boundaries are
+//preserved, each WriteMsg on one side is received by exactly one ReadMsg on the other side.
+//MsgConn implements net.Conn, Read and Write operate on whole messages.
+
+type MsgConn struct {
+	udtConn
+	rbuf []byte //receive buffer one byte larger than the caller's buffer, guarded by rmu
+}
+
+//Use this function to wrap connected UDT message socket created with
+//CreateSocket(network, false) into MsgConn. MsgConn takes ownership of the socket,
+//closing MsgConn closes the socket.
+
+func NewMsgConn(socket *Socket) *MsgConn {
+	c := &MsgConn{}
+	c.init(socket)
+	return c
+}
+
+//Sends b as a single message. If the message is not sent out before TTL expires
+//it is dropped. If successful returns size of the message.
+
+func (c *MsgConn) WriteMsg(b []byte, opts MsgOptions) (n int, err error) {
+	if c.isClosed() {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	ttl := -1
+	if opts.TTL > 0 {
+		ttl = int((opts.TTL + time.Millisecond - 1) / time.Millisecond)
+	}
+	var inorder C.int
+	if opts.InOrder {
+		inorder = 1
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	for {
+		if err = c.applyWriteDeadline(); err != nil {
+			return 0, c.opError("write", err)
+		}
+
+		retval, errno := C.udt_sendmsg(c.socket.sock, (*C.char)(unsafe.Pointer(&b[0])),
+			C.int(len(b)), C.int(ttl), inorder)
+		if retval >= 0 {
+			return int(retval), nil
+		}
+		err = udtError("sendmsg", errno)
+
+		if errors.Is(err, ErrTimeout) {
+			continue
+		}
+		if c.isClosed() {
+			err = net.ErrClosed
+		}
+		return 0, c.opError("write", err)
+	}
+}
+
+//Receives a single message into b. If the message is larger than b, ReadMsg fills b and
+//returns *TruncatedMsgError. ReadMsg returns io.EOF once the peer closed the connection.
+
+func (c *MsgConn) ReadMsg(b []byte) (n int, err error) {
+	if c.isClosed() {
+		return 0, c.opError("read", net.ErrClosed)
+	}
+
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	//UDT silently truncates messages, one extra byte shows that the message did not fit
+	if cap(c.rbuf) < len(b)+1 {
+		c.rbuf = make([]byte, len(b)+1)
+	}
+	buf := c.rbuf[:len(b)+1]
+
+	for {
+		if err = c.applyReadDeadline(); err != nil {
+			return 0, c.opError("read", err)
+		}
+
+		retval, errno := C.udt_recvmsg(c.socket.sock, (*C.char)(unsafe.Pointer(&buf[0])), C.int(len(buf)))
+		if retval >= 0 {
+			n = copy(b, buf[:retval])
+			if int(retval) > len(b) {
+				return n, c.opError("read", &TruncatedMsgError{BufLen: len(b)})
+			}
+			return n, nil
+		}
+		err = udtError("recvmsg", errno)
+
+		switch {
+		case errors.Is(err, ErrTimeout):
+			continue
+		case c.isClosed():
+			return 0, c.opError("read", net.ErrClosed)
+		case errors.Is(err, ErrConnLost) || errors.Is(err, ErrNoConn):
+			return 0, io.EOF
+		}
+		return 0, c.opError("read", err)
+	}
+}
+
+//Receives a single message, same as ReadMsg.
+
+func (c *MsgConn) Read(b []byte) (n int, err error) {
+	return c.ReadMsg(b)
+}
+
+//Sends b as a single message with socket default TTL and out of order delivery.
+
+func (c *MsgConn) Write(b []byte) (n int, err error) {
+	return c.WriteMsg(b, MsgOptions{})
+}
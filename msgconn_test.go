@@ -0,0 +1,76 @@
+package udtgo
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMsgConn(t *testing.T) {
+	s, err := startServer(PORT9016, "ip4", false)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	messages := []string{"Hello", "from", "Kamlesh", "message larger than the buffer"}
+
+	//UDT drops unacknowledged messages when the sender closes, keep client open until the end
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		sc, err := startClient("ip4", "localhost", PORT9016, false)
+		if err != nil {
+			t.Errorf("Unable to start client %s", err)
+			return
+		}
+		c := NewMsgConn(sc)
+		defer c.Close()
+
+		for _, message := range messages {
+			n, err := c.WriteMsg([]byte(message), MsgOptions{TTL: time.Second, InOrder: true})
+			if err != nil || n != len(message) {
+				t.Errorf("Unable to write message %s %d", err, n)
+			}
+		}
+		<-done
+	}()
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept request on socket %s", err)
+	}
+	c := NewMsgConn(ns)
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	data := make([]byte, 10)
+	for _, message := range messages[:3] {
+		n, err := c.ReadMsg(data)
+		if err != nil {
+			t.Fatalf("Unable to read message %s", err)
+		}
+		if string(data[:n]) != message {
+			t.Errorf("Message should be %q got %q", message, data[:n])
+		}
+	}
+
+	n, err := c.ReadMsg(data)
+	var terr *TruncatedMsgError
+	if !errors.As(err, &terr) || !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("ReadMsg should return TruncatedMsgError got %v", err)
+	}
+	if n != len(data) || string(data) != messages[3][:len(data)] {
+		t.Errorf("Truncated message should be %q got %q", messages[3][:len(data)], data[:n])
+	}
+
+	c.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = c.ReadMsg(data)
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Errorf("ReadMsg should time out got %v", err)
+	}
+}
@@ -0,0 +1,773 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+	"unsafe"
+)
+
+//Limits of UDT socket options as documented at http://udt.sourceforge.net/udt4/doc/opt.htm
+
+const (
+	MinMSS        = 28 + 48 //IP and UDP headers plus UDT handshake
+	MaxMSS        = 65535
+	MaxPassphrase = 256
+
+	MinPreSharedKey  = 16 //minimum length of pre-shared key in bytes
+	MaxPreSharedKey  = 64 //maximum length of pre-shared key in bytes
+	MaxPreSharedKeys = 16 //maximum number of pre-shared keys of a socket
+
+	DefaultHandshakeRate = 0 //default handshakes per second accepted from one source IP address, no limit
+
+	MaxStreamID = 512 //maximum length of stream ID in bytes
+)
+
+//SocketState is the state of UDT socket reported by State.
+
+type SocketState int
+
+const (
+	StateInit       = SocketState(INIT)
+	StateOpened     = SocketState(OPENED)
+	StateListening  = SocketState(LISTENING)
+	StateConnecting = SocketState(CONNECTING)
+	StateConnected  = SocketState(CONNECTED)
+	StateBroken     = SocketState(BROKEN)
+	StateClosing    = SocketState(CLOSING)
+	StateClosed     = SocketState(CLOSED)
+	StateNonexist   = SocketState(NONEXIST)
+)
+
+var socketStateNames = map[SocketState]string{
+	StateInit:       "INIT",
+	StateOpened:     "OPENED",
+	StateListening:  "LISTENING",
+	StateConnecting: "CONNECTING",
+	StateConnected:  "CONNECTED",
+	StateBroken:     "BROKEN",
+	StateClosing:    "CLOSING",
+	StateClosed:     "CLOSED",
+	StateNonexist:   "NONEXIST",
+}
+
+func (s SocketState) String() string {
+	if name, ok := socketStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SocketState(%d)", int(s))
+}
+
+//SocketOption configures UDT socket when it is created, see CreateSocket.
+
+type SocketOption func(socket *Socket) error
+
+//PreSharedKey authenticates connection handshakes, see Socket.SetPreSharedKeys.
+
+type PreSharedKey struct {
+	ID  uint16 //key identifier sent with signed handshakes
+	Key []byte //secret of MinPreSharedKey to MaxPreSharedKey bytes
+}
+
+//Sets maximum packet size including UDT, UDP and IP headers, UDT_MSS.
+//Must be set before the socket is bound.
+
+func WithMSS(mss int) SocketOption {
+	return func(socket *Socket) error { return socket.SetMSS(mss) }
+}
+
+//Sets blocking mode of sending and receiving calls, UDT_SNDSYN and UDT_RCVSYN.
+
+func WithBlocking(send, recv bool) SocketOption {
+	return func(socket *Socket) error { return socket.SetBlocking(send, recv) }
+}
+
+//Sets maximum flow window size in packets, UDT_FC.
+
+func WithFlowWindow(packets int) SocketOption {
+	return func(socket *Socket) error { return socket.SetFlowWindow(packets) }
+}
+
+//Sets UDT sender buffer size in bytes, UDT_SNDBUF.
+
+func WithSendBuffer(bytes int) SocketOption {
+	return func(socket *Socket) error { return socket.SetSendBuffer(bytes) }
+}
+
+//Sets UDT receiver buffer size in bytes, UDT_RCVBUF.
+
+func WithRecvBuffer(bytes int) SocketOption {
+	return func(socket *Socket) error { return socket.SetRecvBuffer(bytes) }
+}
+
+//Sets UDP socket sender buffer size in bytes, UDP_SNDBUF.
+
+func WithUDPSendBuffer(bytes int) SocketOption {
+	return func(socket *Socket) error { return socket.SetUDPSendBuffer(bytes) }
+}
+
+//Sets UDP socket receiver buffer size in bytes, UDP_RCVBUF.
+
+func WithUDPRecvBuffer(bytes int) SocketOption {
+	return func(socket *Socket) error { return socket.SetUDPRecvBuffer(bytes) }
+}
+
+//Sets linger time on close, UDT_LINGER.
+
+func WithLinger(on bool, timeout time.Duration) SocketOption {
+	return func(socket *Socket) error { return socket.SetLinger(on, timeout) }
+}
+
+//Sets rendezvous connection setup, UDT_RENDEZVOUS.
+
+func WithRendezvous(rendezvous bool) SocketOption {
+	return func(socket *Socket) error { return socket.SetRendezvous(rendezvous) }
+}
+
+//Sets sending and receiving call timeouts, UDT_SNDTIMEO and UDT_RCVTIMEO.
+
+func WithTimeouts(send, recv time.Duration) SocketOption {
+	return func(socket *Socket) error {
+		if err := socket.SetSendTimeout(send); err != nil {
+			return err
+		}
+		return socket.SetRecvTimeout(recv)
+	}
+}
+
+//Sets reuse of an existing address, UDT_REUSEADDR.
+
+func WithReuseAddr(reuse bool) SocketOption {
+	return func(socket *Socket) error { return socket.SetReuseAddr(reuse) }
+}
+
+//Sets IPV6_V6ONLY of the UDP socket of an IPv6 socket, UDT_IPV6ONLY.
+
+func WithIPv6Only(only bool) SocketOption {
+	return func(socket *Socket) error { return socket.SetIPv6Only(only) }
+}
+
+//Sets maximum bandwidth of the connection in bytes per second, UDT_MAXBW.
+
+func WithMaxBandwidth(bytesPerSec int64) SocketOption {
+	return func(socket *Socket) error { return socket.SetMaxBandwidth(bytesPerSec) }
+}
+
+//Sets maximum size of datagram message, UDT_MAXMSG.
+
+func WithMaxMsgSize(bytes int) SocketOption {
+	return func(socket *Socket) error { return socket.SetMaxMsgSize(bytes) }
+}
+
+//Sets default time to live of datagram messages, UDT_MSGTTL.
+
+func WithMsgTTL(ttl time.Duration) SocketOption {
+	return func(socket *Socket) error { return socket.SetMsgTTL(ttl) }
+}
+
+//Sets AES-GCM encryption of data packets with a key derived from passphrase, UDT_PASSPHRASE.
+
+func WithPassphrase(passphrase string) SocketOption {
+	return func(socket *Socket) error { return socket.SetPassphrase(passphrase) }
+}
+
+//Sets AES-GCM encryption of data packets with a raw key, UDT_CRYPTOKEY.
+
+func WithEncryptionKey(key []byte) SocketOption {
+	return func(socket *Socket) error { return socket.SetEncryptionKey(key) }
+}
+
+//Sets pre-shared keys authenticating connection handshakes, UDT_PSK.
+
+func WithPreSharedKeys(keys ...PreSharedKey) SocketOption {
+	return func(socket *Socket) error { return socket.SetPreSharedKeys(keys...) }
+}
+
+//Sets application data sent with connection request, UDT_STREAMID.
+
+func WithStreamID(id string) SocketOption {
+	return func(socket *Socket) error { return socket.SetStreamID(id) }
+}
+
+//Sets handshakes per second accepted from one source IP address by listening socket, UDT_HSRATE.
+
+func WithHandshakeRate(perSec int) SocketOption {
+	return func(socket *Socket) error { return socket.SetHandshakeRate(perSec) }
+}
+
+//Sets maximum packet size in bytes including UDT, UDP and IP headers (UDT_MSS). Value must be
+//between MinMSS and MaxMSS, default is 1500. Must be set before the socket is bound.
+
+func (socket *Socket) SetMSS(mss int) error {
+	if mss < MinMSS || mss > MaxMSS {
+		return optRangeError(UDT_MSS, int64(mss), MinMSS, MaxMSS)
+	}
+	return setIntOpt(socket, C.UDT_UDT_MSS, mss)
+}
+
+//Returns maximum packet size in bytes (UDT_MSS).
+
+func (socket *Socket) MSS() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_MSS)
+}
+
+//Sets blocking mode of sending (UDT_SNDSYN) and receiving (UDT_RCVSYN) calls.
+//Sockets are blocking by default.
+
+func (socket *Socket) SetBlocking(send, recv bool) error {
+	if err := setBoolOpt(socket, C.UDT_UDT_SNDSYN, send); err != nil {
+		return err
+	}
+	return setBoolOpt(socket, C.UDT_UDT_RCVSYN, recv)
+}
+
+//Returns blocking mode of sending (UDT_SNDSYN) and receiving (UDT_RCVSYN) calls.
+
+func (socket *Socket) Blocking() (send, recv bool, err error) {
+	if send, err = getBoolOpt(socket, C.UDT_UDT_SNDSYN); err != nil {
+		return false, false, err
+	}
+	recv, err = getBoolOpt(socket, C.UDT_UDT_RCVSYN)
+	return send, recv, err
+}
+
+//Sets maximum flow window size in packets (UDT_FC), default is 25600. UDT uses at
+//least 32 packets. Must be set before connecting and before buffer sizes are changed.
+
+func (socket *Socket) SetFlowWindow(packets int) error {
+	if packets < 1 || packets > math.MaxInt32 {
+		return optRangeError(UDT_FC, int64(packets), 1, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDT_FC, packets)
+}
+
+//Returns maximum flow window size in packets (UDT_FC).
+
+func (socket *Socket) FlowWindow() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_FC)
+}
+
+//Sets UDT sender buffer size in bytes (UDT_SNDBUF). UDT rounds the size down to whole
+//packets. Must be set before the socket is bound.
+
+func (socket *Socket) SetSendBuffer(bytes int) error {
+	if bytes < 1 || bytes > math.MaxInt32 {
+		return optRangeError(UDT_SNDBUF, int64(bytes), 1, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDT_SNDBUF, bytes)
+}
+
+//Returns UDT sender buffer size in bytes (UDT_SNDBUF).
+
+func (socket *Socket) SendBuffer() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_SNDBUF)
+}
+
+//Sets UDT receiver buffer size in bytes (UDT_RCVBUF). UDT uses at least 32 packets and
+//at most flow window size. Must be set before the socket is bound.
+
+func (socket *Socket) SetRecvBuffer(bytes int) error {
+	if bytes < 1 || bytes > math.MaxInt32 {
+		return optRangeError(UDT_RCVBUF, int64(bytes), 1, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDT_RCVBUF, bytes)
+}
+
+//Returns UDT receiver buffer size in bytes (UDT_RCVBUF).
+
+func (socket *Socket) RecvBuffer() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_RCVBUF)
+}
+
+//Sets UDP socket sender buffer size in bytes (UDP_SNDBUF). UDT uses at least MSS bytes.
+//Must be set before the socket is bound.
+
+func (socket *Socket) SetUDPSendBuffer(bytes int) error {
+	if bytes < 1 || bytes > math.MaxInt32 {
+		return optRangeError(UDP_SNDBUF, int64(bytes), 1, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDP_SNDBUF, bytes)
+}
+
+//Returns UDP socket sender buffer size in bytes (UDP_SNDBUF).
+
+func (socket *Socket) UDPSendBuffer() (int, error) {
+	return getIntOpt(socket, C.UDT_UDP_SNDBUF)
+}
+
+//Sets UDP socket receiver buffer size in bytes (UDP_RCVBUF). UDT uses at least MSS bytes.
+//Must be set before the socket is bound.
+
+func (socket *Socket) SetUDPRecvBuffer(bytes int) error {
+	if bytes < 1 || bytes > math.MaxInt32 {
+		return optRangeError(UDP_RCVBUF, int64(bytes), 1, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDP_RCVBUF, bytes)
+}
+
+//Returns UDP socket receiver buffer size in bytes (UDP_RCVBUF).
+
+func (socket *Socket) UDPRecvBuffer() (int, error) {
+	return getIntOpt(socket, C.UDT_UDP_RCVBUF)
+}
+
+//Sets linger on close (UDT_LINGER). When on, Close waits up to timeout for unsent data
+//to be delivered. Timeout is applied in whole seconds, default is on with 180 seconds.
+
+func (socket *Socket) SetLinger(on bool, timeout time.Duration) error {
+	seconds := int64(timeout / time.Second)
+	if timeout < 0 || seconds > math.MaxInt32 {
+		return optRangeError(UDT_LINGER, seconds, 0, math.MaxInt32)
+	}
+
+	var clinger C.struct_linger
+	if on {
+		clinger.l_onoff = 1
+	}
+	clinger.l_linger = C.int(seconds)
+	if cret, errno := C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
+		unsafe.Pointer(&clinger), C.int(unsafe.Sizeof(clinger))); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Returns linger time and whether linger on close is on (UDT_LINGER).
+
+func (socket *Socket) Linger() (time.Duration, bool, error) {
+	var clinger C.struct_linger
+	clinger_len := C.int(unsafe.Sizeof(clinger))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
+		unsafe.Pointer(&clinger), &clinger_len); cret < 0 {
+		return 0, false, udtError("getsockopt", errno)
+	}
+	return time.Duration(clinger.l_linger) * time.Second, clinger.l_onoff != 0, nil
+}
+
+//Sets rendezvous connection setup (UDT_RENDEZVOUS). Must be set before connecting.
+
+func (socket *Socket) SetRendezvous(rendezvous bool) error {
+	return setBoolOpt(socket, C.UDT_UDT_RENDEZVOUS, rendezvous)
+}
+
+//Returns true if the socket uses rendezvous connection setup (UDT_RENDEZVOUS).
+
+func (socket *Socket) Rendezvous() (bool, error) {
+	return getBoolOpt(socket, C.UDT_UDT_RENDEZVOUS)
+}
+
+//Sets timeout of sending calls (UDT_SNDTIMEO) in milliseconds precision. Negative
+//timeout means infinite, which is the default. Conn and MsgConn manage this option
+//themselves to apply deadlines.
+
+func (socket *Socket) SetSendTimeout(timeout time.Duration) error {
+	ms, err := timeoutMillis(UDT_SNDTIMEO, timeout)
+	if err != nil {
+		return err
+	}
+	return setIntOpt(socket, C.UDT_UDT_SNDTIMEO, ms)
+}
+
+//Returns timeout of sending calls (UDT_SNDTIMEO), negative value means infinite.
+
+func (socket *Socket) SendTimeout() (time.Duration, error) {
+	ms, err := getIntOpt(socket, C.UDT_UDT_SNDTIMEO)
+	if err != nil {
+		return 0, err
+	}
+	return millisTimeout(ms), nil
+}
+
+//Sets timeout of receiving calls (UDT_RCVTIMEO) in milliseconds precision. Negative
+//timeout means infinite, which is the default. Conn and MsgConn manage this option
+//themselves to apply deadlines.
+
+func (socket *Socket) SetRecvTimeout(timeout time.Duration) error {
+	ms, err := timeoutMillis(UDT_RCVTIMEO, timeout)
+	if err != nil {
+		return err
+	}
+	return setIntOpt(socket, C.UDT_UDT_RCVTIMEO, ms)
+}
+
+//Returns timeout of receiving calls (UDT_RCVTIMEO), negative value means infinite.
+
+func (socket *Socket) RecvTimeout() (time.Duration, error) {
+	ms, err := getIntOpt(socket, C.UDT_UDT_RCVTIMEO)
+	if err != nil {
+		return 0, err
+	}
+	return millisTimeout(ms), nil
+}
+
+//Sets reuse of an existing address (UDT_REUSEADDR), default is true.
+//Must be set before the socket is bound.
+
+func (socket *Socket) SetReuseAddr(reuse bool) error {
+	return setBoolOpt(socket, C.UDT_UDT_REUSEADDR, reuse)
+}
+
+//Returns true if the socket may reuse an existing address (UDT_REUSEADDR).
+
+func (socket *Socket) ReuseAddr() (bool, error) {
+	return getBoolOpt(socket, C.UDT_UDT_REUSEADDR)
+}
+
+//Sets IPV6_V6ONLY of the UDP socket of an IPv6 socket (UDT_IPV6ONLY). With true socket bound
+//to :: accepts IPv6 peers only, with false IPv4 peers too as IPv4-mapped addresses. If it is
+//not set the system default applies. Must be set before the socket is bound.
+
+func (socket *Socket) SetIPv6Only(only bool) error {
+	value := 0
+	if only {
+		value = 1
+	}
+	return setIntOpt(socket, C.UDT_UDT_IPV6ONLY, value)
+}
+
+//Returns true if IPV6_V6ONLY of the socket is set (UDT_IPV6ONLY).
+
+func (socket *Socket) IPv6Only() (bool, error) {
+	value, err := getIntOpt(socket, C.UDT_UDT_IPV6ONLY)
+	return value == 1, err
+}
+
+//Sets maximum bandwidth of the connection in bytes per second (UDT_MAXBW).
+//-1 means no limit, which is the default.
+
+func (socket *Socket) SetMaxBandwidth(bytesPerSec int64) error {
+	if bytesPerSec < -1 || bytesPerSec == 0 {
+		return fmt.Errorf("invalid value %d for %s, must be -1 or positive", bytesPerSec, UDT_MAXBW)
+	}
+	value := C.int64_t(bytesPerSec)
+	if cret, errno := C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW,
+		unsafe.Pointer(&value), C.int(unsafe.Sizeof(value))); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Returns maximum bandwidth in bytes per second (UDT_MAXBW), -1 means no limit.
+
+func (socket *Socket) MaxBandwidth() (int64, error) {
+	var value C.int64_t
+	optlen := C.int(unsafe.Sizeof(value))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW, unsafe.Pointer(&value), &optlen); cret < 0 {
+		return 0, udtError("getsockopt", errno)
+	}
+	return int64(value), nil
+}
+
+//Sets maximum size of datagram message in bytes (UDT_MAXMSG). Larger messages are
+//rejected by SendMsg. Zero, the default, limits messages by sender buffer size only.
+
+func (socket *Socket) SetMaxMsgSize(bytes int) error {
+	if bytes < 0 || bytes > math.MaxInt32 {
+		return optRangeError(UDT_MAXMSG, int64(bytes), 0, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDT_MAXMSG, bytes)
+}
+
+//Returns maximum size of datagram message in bytes (UDT_MAXMSG).
+
+func (socket *Socket) MaxMsgSize() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_MAXMSG)
+}
+
+//Sets default time to live of datagram messages (UDT_MSGTTL) in milliseconds precision.
+//It applies to messages sent without TTL. Negative value means infinite, which is the default.
+
+func (socket *Socket) SetMsgTTL(ttl time.Duration) error {
+	ms, err := timeoutMillis(UDT_MSGTTL, ttl)
+	if err != nil {
+		return err
+	}
+	return setIntOpt(socket, C.UDT_UDT_MSGTTL, ms)
+}
+
+//Returns default time to live of datagram messages (UDT_MSGTTL), negative value means infinite.
+
+func (socket *Socket) MsgTTL() (time.Duration, error) {
+	ms, err := getIntOpt(socket, C.UDT_UDT_MSGTTL)
+	if err != nil {
+		return 0, err
+	}
+	return millisTimeout(ms), nil
+}
+
+//Turns on AES-GCM encryption of data packets (UDT_PASSPHRASE). The 256-bit key is derived
+//from passphrase with PBKDF2-HMAC-SHA256. Peers must use the same key, otherwise the
+//connection is rejected during handshake. Empty passphrase turns encryption off. Must be set
+//before connecting, accepted sockets use the key of the listening socket.
+
+func (socket *Socket) SetPassphrase(passphrase string) error {
+	if len(passphrase) > MaxPassphrase {
+		return optRangeError(UDT_PASSPHRASE, int64(len(passphrase)), 0, MaxPassphrase)
+	}
+	return setBytesOpt(socket, C.UDT_UDT_PASSPHRASE, []byte(passphrase))
+}
+
+//Turns on AES-GCM encryption of data packets with a raw 16, 24 or 32 bytes AES key
+//(UDT_CRYPTOKEY). Empty key turns encryption off. Same rules as for SetPassphrase apply.
+
+func (socket *Socket) SetEncryptionKey(key []byte) error {
+	switch len(key) {
+	case 0, 16, 24, 32:
+	default:
+		return fmt.Errorf("invalid key length %d for %s, must be 16, 24 or 32 bytes", len(key), UDT_CRYPTOKEY)
+	}
+	return setBytesOpt(socket, C.UDT_UDT_CRYPTOKEY, key)
+}
+
+//Returns length of the data encryption key in bytes (UDT_CRYPTOKEY), 0 if encryption is off.
+//The key itself cannot be read back.
+
+func (socket *Socket) EncryptionKeyLength() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_CRYPTOKEY)
+}
+
+//Sets pre-shared keys authenticating connection handshakes (UDT_PSK). Every handshake is
+//signed with HMAC-SHA256 over its fields, including SYN cookie, initial sequence number and
+//peer address, using the first key. Incoming handshakes must be signed with any of the keys,
+//looked up by ID, so keys are rotated by adding the new key to listeners first and removing
+//the old one once all peers use the new one. Listening sockets silently drop handshakes
+//which fail verification, connecting sockets ignore such responses, so a peer with a wrong
+//key only sees the connect time out. No keys turn authentication off. Listening sockets can
+//change keys at any time, other sockets before connecting.
+
+func (socket *Socket) SetPreSharedKeys(keys ...PreSharedKey) error {
+	if len(keys) > MaxPreSharedKeys {
+		return fmt.Errorf("too many pre-shared keys %d, at most %d are allowed", len(keys), MaxPreSharedKeys)
+	}
+	var buf []byte
+	ids := make(map[uint16]bool)
+	for _, key := range keys {
+		if len(key.Key) < MinPreSharedKey || len(key.Key) > MaxPreSharedKey {
+			return optRangeError(UDT_PSK, int64(len(key.Key)), MinPreSharedKey, MaxPreSharedKey)
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("duplicate pre-shared key ID %d", key.ID)
+		}
+		ids[key.ID] = true
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(key.ID))
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(len(key.Key)))
+		buf = append(buf, key.Key...)
+	}
+	return setBytesOpt(socket, C.UDT_UDT_PSK, buf)
+}
+
+//Returns number of pre-shared keys (UDT_PSK), 0 if handshakes are not authenticated.
+//The keys themselves cannot be read back.
+
+func (socket *Socket) PreSharedKeyCount() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_PSK)
+}
+
+//Sets application data sent with connection request (UDT_STREAMID), such as a stream ID or
+//resource name of at most MaxStreamID bytes. AcceptFunc of the listener gets it to decide
+//about the connection and the accepted socket returns it from StreamID. Must be set before
+//connecting.
+
+func (socket *Socket) SetStreamID(id string) error {
+	if len(id) > MaxStreamID {
+		return optRangeError(UDT_STREAMID, int64(len(id)), 0, MaxStreamID)
+	}
+	return setBytesOpt(socket, C.UDT_UDT_STREAMID, []byte(id))
+}
+
+//Returns application data of connection request (UDT_STREAMID), the one sent by connecting
+//socket or received by accepted socket.
+
+func (socket *Socket) StreamID() (string, error) {
+	buf := make([]byte, MaxStreamID)
+	optlen := C.int(len(buf))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_STREAMID, unsafe.Pointer(&buf[0]), &optlen); cret < 0 {
+		return "", udtError("getsockopt", errno)
+	}
+	return string(buf[:optlen]), nil
+}
+
+//Sets handshakes per second accepted from one source IP address (UDT_HSRATE), default is
+//DefaultHandshakeRate. It is also the burst size, 0 means no limit. Listening socket silently
+//drops handshakes above the rate before checking SYN cookie or signature, connecting peers
+//retry until their connect times out. Listening sockets can change the rate at any time.
+
+func (socket *Socket) SetHandshakeRate(perSec int) error {
+	if perSec < 0 || perSec > math.MaxInt32 {
+		return optRangeError(UDT_HSRATE, int64(perSec), 0, math.MaxInt32)
+	}
+	return setIntOpt(socket, C.UDT_UDT_HSRATE, perSec)
+}
+
+//Returns handshakes per second accepted from one source IP address (UDT_HSRATE), 0 means no limit.
+
+func (socket *Socket) HandshakeRate() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_HSRATE)
+}
+
+//Limits connections waiting for Accept on all listening sockets of the process. Handshakes of
+//new connections above the limit are dropped, so peers retry until earlier connections are
+//accepted or their connect times out. Each listener still refuses connections above its own
+//backlog. 0, the default, means no limit.
+
+func SetMaxPendingConns(n int) error {
+	if n < 0 || n > math.MaxInt32 {
+		return fmt.Errorf("invalid maximum of pending connections %d, must be between 0 and %d", n, math.MaxInt32)
+	}
+	if cret, errno := C.udt_setmaxpending(C.int(n)); cret < 0 {
+		return udtError("setmaxpending", errno)
+	}
+	return nil
+}
+
+//Returns current state of the socket (UDT_STATE). StateNonexist is returned if the
+//state cannot be read.
+
+func (socket *Socket) State() SocketState {
+	var value C.int32_t
+	optlen := C.int(unsafe.Sizeof(value))
+	if C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_STATE, unsafe.Pointer(&value), &optlen) < 0 {
+		return StateNonexist
+	}
+	return SocketState(value)
+}
+
+//Returns epoll events currently available on the socket (UDT_EVENT), combination of
+//UDT_EPOLL_IN, UDT_EPOLL_OUT and UDT_EPOLL_ERR.
+
+func (socket *Socket) Events() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_EVENT)
+}
+
+//Returns size of pending data in the sending buffer in bytes (UDT_SNDDATA).
+
+func (socket *Socket) SendData() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_SNDDATA)
+}
+
+//Returns size of data available to read in the receiving buffer in bytes (UDT_RCVDATA).
+
+func (socket *Socket) RecvData() (int, error) {
+	return getIntOpt(socket, C.UDT_UDT_RCVDATA)
+}
+
+//Sets int UDT socket option.
+
+func setIntOpt(socket *Socket, option C.int, value int) error {
+	cvalue := C.int(value)
+	if cret, errno := C.udt_setsockopt(socket.sock, C.int(0), option, unsafe.Pointer(&cvalue), C.int(unsafe.Sizeof(cvalue))); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Reads int UDT socket option.
+
+func getIntOpt(socket *Socket, option C.int) (int, error) {
+	var cvalue C.int
+	optlen := C.int(unsafe.Sizeof(cvalue))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), option, unsafe.Pointer(&cvalue), &optlen); cret < 0 {
+		return 0, udtError("getsockopt", errno)
+	}
+	return int(cvalue), nil
+}
+
+//Sets UDT socket option with variable length value such as UDT_PASSPHRASE.
+
+func setBytesOpt(socket *Socket, option C.int, value []byte) error {
+	var ptr unsafe.Pointer
+	if len(value) > 0 {
+		ptr = unsafe.Pointer(&value[0])
+	}
+	if cret, errno := C.udt_setsockopt(socket.sock, C.int(0), option, ptr, C.int(len(value))); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Sets boolean UDT socket option such as UDT_SNDSYN or UDT_RCVSYN. udt_setsockopt reads
+//UDT_SNDSYN as int, other options as bool, little endian int covers both.
+
+func setBoolOpt(socket *Socket, option C.int, value bool) error {
+	var cvalue C.int
+	if value {
+		cvalue = 1
+	}
+	if cret, errno := C.udt_setsockopt(socket.sock, C.int(0), option, unsafe.Pointer(&cvalue), C.int(unsafe.Sizeof(cvalue))); cret < 0 {
+		return udtError("setsockopt", errno)
+	}
+	return nil
+}
+
+//Reads boolean UDT socket option.
+
+func getBoolOpt(socket *Socket, option C.int) (bool, error) {
+	var cvalue C.char
+	optlen := C.int(unsafe.Sizeof(cvalue))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), option, unsafe.Pointer(&cvalue), &optlen); cret < 0 {
+		return false, udtError("getsockopt", errno)
+	}
+	return cvalue != 0, nil
+}
+
+//Converts timeout to milliseconds, rounding up. Negative timeout is converted to -1.
+
+func timeoutMillis(option string, timeout time.Duration) (int, error) {
+	if timeout < 0 {
+		return -1, nil
+	}
+	ms := (timeout + time.Millisecond - 1) / time.Millisecond
+	if ms > math.MaxInt32 {
+		return 0, optRangeError(option, int64(ms), -1, math.MaxInt32)
+	}
+	return int(ms), nil
+}
+
+func millisTimeout(ms int) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func optRangeError(option string, value, min, max int64) error {
+	return fmt.Errorf("invalid value %d for %s, must be between %d and %d", value, option, min, max)
+}
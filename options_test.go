@@ -0,0 +1,745 @@
+package udtgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSocketOptions(t *testing.T) {
+	s, err := CreateSocket("ip4", true,
+		WithMSS(1400),
+		WithFlowWindow(1024),
+		WithSendBuffer(1<<20),
+		WithRecvBuffer(1<<20),
+		WithLinger(true, 3*time.Second),
+		WithMaxBandwidth(10<<20),
+		WithTimeouts(1500*time.Microsecond, -1))
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+
+	if mss, err := s.MSS(); err != nil || mss != 1400 {
+		t.Errorf("MSS should be 1400 got %d %v", mss, err)
+	}
+	if fc, err := s.FlowWindow(); err != nil || fc != 1024 {
+		t.Errorf("Flow window should be 1024 got %d %v", fc, err)
+	}
+	if bw, err := s.MaxBandwidth(); err != nil || bw != 10<<20 {
+		t.Errorf("Max bandwidth should be %d got %d %v", 10<<20, bw, err)
+	}
+	if d, on, err := s.Linger(); err != nil || !on || d != 3*time.Second {
+		t.Errorf("Linger should be on with 3s got %v %v %v", on, d, err)
+	}
+	if d, err := s.SendTimeout(); err != nil || d != 2*time.Millisecond {
+		t.Errorf("Send timeout should be rounded up to 2ms got %v %v", d, err)
+	}
+	if d, err := s.RecvTimeout(); err != nil || d >= 0 {
+		t.Errorf("Receive timeout should be infinite got %v %v", d, err)
+	}
+	if send, recv, err := s.Blocking(); err != nil || !send || !recv {
+		t.Errorf("Socket should be blocking got %v %v %v", send, recv, err)
+	}
+	if err = s.SetBlocking(false, true); err != nil {
+		t.Fatalf("Unable to set blocking %s", err)
+	}
+	if send, recv, err := s.Blocking(); err != nil || send || !recv {
+		t.Errorf("Sending should be non blocking got %v %v %v", send, recv, err)
+	}
+	if err = s.SetReuseAddr(false); err != nil {
+		t.Errorf("Unable to set reuse address %s", err)
+	}
+	if reuse, err := s.ReuseAddr(); err != nil || reuse {
+		t.Errorf("Reuse address should be off got %v %v", reuse, err)
+	}
+	if state := s.State(); state != StateInit {
+		t.Errorf("State should be %s got %s", StateInit, state)
+	}
+
+	if err = s.SetMSS(MinMSS - 1); err == nil {
+		t.Errorf("MSS below %d should be rejected", MinMSS)
+	}
+	if err = s.SetFlowWindow(0); err == nil {
+		t.Errorf("Zero flow window should be rejected")
+	}
+	if err = s.SetSendBuffer(-1); err == nil {
+		t.Errorf("Negative sender buffer should be rejected")
+	}
+	if err = s.SetMaxBandwidth(0); err == nil {
+		t.Errorf("Zero bandwidth should be rejected")
+	}
+	if err = s.SetLinger(true, -time.Second); err == nil {
+		t.Errorf("Negative linger should be rejected")
+	}
+
+	if _, err = CreateSocket("ip4", true, WithMSS(MaxMSS+1)); err == nil {
+		t.Errorf("CreateSocket should fail with invalid option")
+	}
+}
+
+func TestSocketState(t *testing.T) {
+	if StateConnected.String() != "CONNECTED" || SocketState(100).String() != "SocketState(100)" {
+		t.Errorf("Unexpected state names %s %s", StateConnected, SocketState(100))
+	}
+
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	Close(s)
+	if state := s.State(); state != StateNonexist && state != StateClosed {
+		t.Errorf("Closed socket state should be %s got %s", StateNonexist, state)
+	}
+	if _, err = s.MSS(); !errors.Is(err, ErrInvalidSocket) {
+		t.Errorf("Reading option of closed socket should fail with %v got %v", ErrInvalidSocket, err)
+	}
+}
+
+func TestMaxMsgSize(t *testing.T) {
+	s, err := startServer(PORT9017, "ip4", false)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ns, err := Accept(s)
+		if err != nil {
+			t.Errorf("Unable to accept request on socket %s", err)
+			return
+		}
+		defer Close(ns)
+		<-done
+	}()
+
+	sc, err := startClient("ip4", "localhost", PORT9017, false)
+	if err != nil {
+		t.Fatalf("Unable to start client %s", err)
+	}
+	if err = sc.SetMaxMsgSize(16); err != nil {
+		t.Fatalf("Unable to set max message size %s", err)
+	}
+	if err = sc.SetMsgTTL(1500 * time.Millisecond); err != nil {
+		t.Fatalf("Unable to set message TTL %s", err)
+	}
+	if size, err := sc.MaxMsgSize(); err != nil || size != 16 {
+		t.Errorf("Max message size should be 16 got %d %v", size, err)
+	}
+	if ttl, err := sc.MsgTTL(); err != nil || ttl != 1500*time.Millisecond {
+		t.Errorf("Message TTL should be 1.5s got %v %v", ttl, err)
+	}
+	if state := sc.State(); state != StateConnected {
+		t.Errorf("State should be %s got %s", StateConnected, state)
+	}
+	if err = sc.SetMaxMsgSize(-1); err == nil {
+		t.Errorf("Negative max message size should be rejected")
+	}
+
+	c := NewMsgConn(sc)
+	defer c.Close()
+
+	if _, err = c.Write(make([]byte, 16)); err != nil {
+		t.Errorf("Message of max size should be sent %s", err)
+	}
+	if _, err = c.Write(make([]byte, 17)); err == nil {
+		t.Errorf("Message larger than max size should be rejected")
+	}
+}
+
+//Returns listening socket on port created with opts.
+
+func startServerOpts(port int, isStream bool, opts ...SocketOption) (*Socket, error) {
+	s, err := CreateSocket("ip4", isStream, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = Bind(s, port); err != nil {
+		Close(s)
+		return nil, err
+	}
+	if _, err = Listen(s, 4); err != nil {
+		Close(s)
+		return nil, err
+	}
+	return s, nil
+}
+
+func TestEncryption(t *testing.T) {
+	for i, isStream := range []bool{true, false} {
+		port := PORT9027 + i
+		s, err := startServerOpts(port, isStream, WithPassphrase("correct horse battery staple"))
+		if err != nil {
+			t.Fatalf("Unable to start server %s", err)
+		}
+		defer Close(s)
+
+		accepted := make(chan *Socket, 1)
+		go func() {
+			ns, err := Accept(s)
+			if err != nil {
+				t.Errorf("Unable to accept request on socket %s", err)
+			}
+			accepted <- ns
+		}()
+
+		sc, err := CreateSocket("ip4", isStream, WithPassphrase("correct horse battery staple"))
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		if _, err = Connect(sc, "localhost", port); err != nil {
+			t.Fatalf("Unable to connect %s", err)
+		}
+		ns := <-accepted
+		if ns == nil {
+			t.FailNow()
+		}
+		if n, err := ns.EncryptionKeyLength(); err != nil || n != 32 {
+			t.Errorf("Accepted socket key length should be 32 got %d %v", n, err)
+		}
+
+		if isStream {
+			testEncryptedStream(t, NewConn(sc), NewConn(ns))
+		} else {
+			testEncryptedMsgs(t, NewMsgConn(sc), NewMsgConn(ns))
+		}
+	}
+}
+
+func testEncryptedStream(t *testing.T, client, server *Conn) {
+	defer client.Close()
+	defer server.Close()
+
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(17)).Read(data)
+	go func() {
+		if _, err := client.Write(data); err != nil {
+			t.Errorf("Unable to write data %s", err)
+		}
+	}()
+
+	server.SetReadDeadline(time.Now().Add(10 * time.Second))
+	received := make([]byte, len(data))
+	if _, err := io.ReadFull(server, received); err != nil {
+		t.Fatalf("Unable to read data %s", err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Errorf("Decrypted data differs from sent data")
+	}
+}
+
+func testEncryptedMsgs(t *testing.T, client, server *MsgConn) {
+	defer client.Close()
+	defer server.Close()
+
+	//a message of several packets and messages filling the reduced packet payload exactly
+	messages := [][]byte{[]byte("Hello"), bytes.Repeat([]byte("udt"), 3000), make([]byte, 1500-28-16-16), make([]byte, 2*(1500-28-16-16))}
+	for _, message := range messages {
+		if _, err := client.WriteMsg(message, MsgOptions{InOrder: true}); err != nil {
+			t.Fatalf("Unable to write message %s", err)
+		}
+	}
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 16<<10)
+	for _, message := range messages {
+		n, err := server.ReadMsg(buf)
+		if err != nil {
+			t.Fatalf("Unable to read message %s", err)
+		}
+		if !bytes.Equal(buf[:n], message) {
+			t.Errorf("Decrypted message of %d bytes differs from sent message of %d bytes", n, len(message))
+		}
+	}
+}
+
+func TestEncryptionKeyMismatch(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	s, err := startServerOpts(PORT9029, true, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	go func() {
+		for {
+			ns, err := Accept(s)
+			if err != nil {
+				return
+			}
+			Close(ns)
+		}
+	}()
+
+	wrong := bytes.Repeat([]byte{8}, 32)
+	for _, opts := range [][]SocketOption{{WithEncryptionKey(wrong)}, {WithEncryptionKey(key[:16])}, {WithPassphrase("secret")}, nil} {
+		sc, err := CreateSocket("ip4", true, opts...)
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		n, _ := sc.EncryptionKeyLength()
+		_, err = Connect(sc, "localhost", PORT9029)
+		Close(sc)
+		if !errors.Is(err, ErrConnRejected) {
+			t.Errorf("Connect with key of length %d should be rejected got %v", n, err)
+		}
+	}
+
+	//asynchronous connect of an unencrypted client fails as soon as it is rejected
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err = DialContext(ctx, "udt4", fmt.Sprintf("127.0.0.1:%d", PORT9029)); !errors.Is(err, ErrConnRejected) {
+		t.Errorf("Dial without key should be rejected got %v", err)
+	}
+
+	sc, err := CreateSocket("ip4", true, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(sc)
+	if _, err = Connect(sc, "localhost", PORT9029); err != nil {
+		t.Errorf("Connect with the same key should succeed %s", err)
+	}
+}
+
+//Forwards UDP packets between the first client and the server at port and passes payloads
+//of data packets to seen. Returns the port of the relay.
+
+func startRelay(t *testing.T, port int, seen func(payload []byte)) int {
+	relay, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Unable to start relay %s", err)
+	}
+	t.Cleanup(func() { relay.Close() })
+
+	server := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	go func() {
+		var client *net.UDPAddr
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := relay.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			//data packets have the control bit cleared and 16 bytes of header
+			if n > 16 && buf[0]&0x80 == 0 {
+				seen(buf[16:n])
+			}
+			if from.Port == server.Port {
+				if client != nil {
+					relay.WriteToUDP(buf[:n], client)
+				}
+			} else {
+				client = from
+				relay.WriteToUDP(buf[:n], server)
+			}
+		}
+	}()
+	return relay.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestEncryptionOnWire(t *testing.T) {
+	marker := []byte("plaintext visible on the wire")
+	data := bytes.Repeat(marker, 1<<20/len(marker))
+
+	for i, encrypt := range []bool{false, true} {
+		var opts []SocketOption
+		if encrypt {
+			opts = append(opts, WithPassphrase("correct horse battery staple"))
+		}
+		s, err := startServerOpts(PORT9046+i, true, opts...)
+		if err != nil {
+			t.Fatalf("Unable to start server %s", err)
+		}
+		defer Close(s)
+
+		var packets, plain atomic.Int64
+		port := startRelay(t, PORT9046+i, func(payload []byte) {
+			packets.Add(1)
+			if bytes.Contains(payload, marker) {
+				plain.Add(1)
+			}
+		})
+
+		accepted := make(chan *Socket, 1)
+		go func() {
+			ns, err := Accept(s)
+			if err != nil {
+				t.Errorf("Unable to accept request on socket %s", err)
+			}
+			accepted <- ns
+		}()
+		sc, err := CreateSocket("ip4", true, opts...)
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		if _, err = Connect(sc, "127.0.0.1", port); err != nil {
+			Close(sc)
+			t.Fatalf("Unable to connect through relay %s", err)
+		}
+		ns := <-accepted
+		if ns == nil {
+			Close(sc)
+			t.FailNow()
+		}
+
+		client, server := NewConn(sc), NewConn(ns)
+		go client.Write(data)
+		server.SetReadDeadline(time.Now().Add(10 * time.Second))
+		received := make([]byte, len(data))
+		_, err = io.ReadFull(server, received)
+		client.Close()
+		server.Close()
+		if err != nil || !bytes.Equal(received, data) {
+			t.Fatalf("Data through relay differs from sent data %v", err)
+		}
+
+		if packets.Load() == 0 {
+			t.Errorf("Relay should see data packets")
+		}
+		if encrypt && plain.Load() != 0 {
+			t.Errorf("%d of %d encrypted data packets contain plaintext", plain.Load(), packets.Load())
+		}
+		if !encrypt && plain.Load() == 0 {
+			t.Errorf("Unencrypted data packets should contain plaintext")
+		}
+	}
+}
+
+func TestEncryptionOptions(t *testing.T) {
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+
+	if n, err := s.EncryptionKeyLength(); err != nil || n != 0 {
+		t.Errorf("Encryption should be off by default got key length %d %v", n, err)
+	}
+	if err = s.SetEncryptionKey(make([]byte, 24)); err != nil {
+		t.Errorf("Unable to set 24 bytes key %s", err)
+	}
+	if n, err := s.EncryptionKeyLength(); err != nil || n != 24 {
+		t.Errorf("Key length should be 24 got %d %v", n, err)
+	}
+	if err = s.SetEncryptionKey(make([]byte, 20)); err == nil {
+		t.Errorf("Key of 20 bytes should be rejected")
+	}
+	if err = s.SetPassphrase(strings.Repeat("x", MaxPassphrase+1)); err == nil {
+		t.Errorf("Too long passphrase should be rejected")
+	}
+	if err = s.SetPassphrase(""); err != nil {
+		t.Errorf("Unable to set empty passphrase %s", err)
+	}
+	if n, err := s.EncryptionKeyLength(); err != nil || n != 0 {
+		t.Errorf("Empty passphrase should turn encryption off got key length %d %v", n, err)
+	}
+}
+
+func TestPreSharedKeys(t *testing.T) {
+	oldKey := PreSharedKey{ID: 1, Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := PreSharedKey{ID: 2, Key: bytes.Repeat([]byte{2}, 32)}
+	s, err := startServerOpts(PORT9030, true, WithPreSharedKeys(newKey, oldKey))
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+	if n, err := s.PreSharedKeyCount(); err != nil || n != 2 {
+		t.Errorf("Listener should have 2 keys got %d %v", n, err)
+	}
+
+	accepted := make(chan *Socket, 8)
+	go func() {
+		for {
+			ns, err := Accept(s)
+			if err != nil {
+				return
+			}
+			accepted <- ns
+		}
+	}()
+
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9030}
+	dial := func(timeout time.Duration, keys ...PreSharedKey) error {
+		sc, err := CreateSocket("ip4", true, WithPreSharedKeys(keys...))
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		defer Close(sc)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return connectContext(ctx, sc, raddr)
+	}
+
+	//the current and the previous key are both accepted during rotation
+	for _, key := range []PreSharedKey{newKey, oldKey} {
+		if err = dial(5*time.Second, key); err != nil {
+			t.Errorf("Connect with key %d should succeed %s", key.ID, err)
+		}
+		select {
+		case ns := <-accepted:
+			Close(ns)
+		case <-time.After(5 * time.Second):
+			t.Errorf("Connection with key %d should be accepted", key.ID)
+		}
+	}
+
+	//wrong key, unknown key ID and unsigned handshakes are dropped, the peer never gets a response
+	wrongKey := PreSharedKey{ID: 2, Key: bytes.Repeat([]byte{3}, 32)}
+	unknownID := PreSharedKey{ID: 3, Key: newKey.Key}
+	for i, keys := range [][]PreSharedKey{{wrongKey}, {unknownID}, nil} {
+		if err = dial(time.Second, keys...); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Connect %d with wrong keys should time out got %v", i, err)
+		}
+	}
+
+	//retire the previous key on the running listener
+	if err = s.SetPreSharedKeys(newKey); err != nil {
+		t.Fatalf("Unable to change keys %s", err)
+	}
+	if err = dial(time.Second, oldKey); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect with retired key should time out got %v", err)
+	}
+
+	select {
+	case ns := <-accepted:
+		Close(ns)
+		t.Errorf("Listener should not accept unauthenticated peers")
+	default:
+	}
+
+	if err = s.SetPreSharedKeys(PreSharedKey{ID: 1, Key: make([]byte, 8)}); err == nil {
+		t.Errorf("Short key should be rejected")
+	}
+	if err = s.SetPreSharedKeys(newKey, PreSharedKey{ID: newKey.ID, Key: oldKey.Key}); err == nil {
+		t.Errorf("Duplicate key ID should be rejected")
+	}
+}
+
+//Returns UDT connection handshake packet as sent on the wire.
+
+func TestPreSharedKeysEncryption(t *testing.T) {
+	//handshakes carry pre-shared key signatures over the encryption fields
+	psk := PreSharedKey{ID: 9, Key: bytes.Repeat([]byte{9}, 16)}
+	passphrase := WithPassphrase("correct horse battery staple")
+	s, err := startServerOpts(PORT9045, true, passphrase, WithPreSharedKeys(psk))
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	accepted := make(chan *Socket, 4)
+	go func() {
+		for {
+			ns, err := Accept(s)
+			if err != nil {
+				return
+			}
+			accepted <- ns
+		}
+	}()
+
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9045}
+	dial := func(timeout time.Duration, opts ...SocketOption) (*Socket, error) {
+		sc, err := CreateSocket("ip4", true, opts...)
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err = connectContext(ctx, sc, raddr); err != nil {
+			Close(sc)
+			return nil, err
+		}
+		return sc, nil
+	}
+
+	//a signed handshake with the wrong passphrase is rejected, an unsigned one is dropped
+	if _, err = dial(5*time.Second, WithPassphrase("secret"), WithPreSharedKeys(psk)); !errors.Is(err, ErrConnRejected) {
+		t.Errorf("Connect with wrong passphrase should be rejected got %v", err)
+	}
+	if _, err = dial(time.Second, passphrase); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect without key should time out got %v", err)
+	}
+
+	sc, err := dial(5*time.Second, passphrase, WithPreSharedKeys(psk))
+	if err != nil {
+		t.Fatalf("Unable to connect %s", err)
+	}
+	var ns *Socket
+	select {
+	case ns = <-accepted:
+	case <-time.After(5 * time.Second):
+		Close(sc)
+		t.Fatalf("Connection should be accepted")
+	}
+	if n, err := ns.EncryptionKeyLength(); err != nil || n != 32 {
+		t.Errorf("Accepted socket key length should be 32 got %d %v", n, err)
+	}
+	testEncryptedStream(t, NewConn(sc), NewConn(ns))
+}
+
+func handshakePacket(reqType int32, cookie uint32) []byte {
+	words := []uint32{
+		0x80000000, 0, 0, 0, //control packet of type 0, destination socket 0
+		4, 1, 1000, 1500, 25600, uint32(reqType), 12345, cookie, //version, stream, ISN, MSS, flow window
+		0x0100007f, 0, 0, 0, //peer IP
+	}
+	pkt := make([]byte, 0, 4*len(words))
+	for _, w := range words {
+		pkt = binary.BigEndian.AppendUint32(pkt, w)
+	}
+	return pkt
+}
+
+func TestHandshakeShortCookie(t *testing.T) {
+	s, err := startServerOpts(PORT9051, true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9051}
+	peer, err := net.DialUDP("udp4", nil, raddr)
+	if err != nil {
+		t.Fatalf("Unable to open UDP socket %s", err)
+	}
+	defer peer.Close()
+	exchange := func(reqType int32, cookie uint32) []byte {
+		if _, err := peer.Write(handshakePacket(reqType, cookie)); err != nil {
+			t.Fatalf("Unable to send handshake %s", err)
+		}
+		peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 1500)
+		n, err := peer.Read(buf)
+		if err != nil || n < 64 {
+			t.Fatalf("Handshake %d should be answered got %d bytes %v", reqType, n, err)
+		}
+		return buf[:n]
+	}
+
+	//a stock UDT4 peer returns the 32 bits of the cookie it knows, without the extension
+	resp := exchange(1, 0)
+	cookie := binary.BigEndian.Uint32(resp[44:])
+	resp = exchange(-1, cookie)
+	if reqType := int32(binary.BigEndian.Uint32(resp[36:])); reqType != -1 {
+		t.Errorf("Connection request should be answered with -1 got %d", reqType)
+	}
+	if hs, err := s.HandshakeStats(); err != nil || hs.Dropped != 0 {
+		t.Errorf("No handshake should be dropped got %+v %v", hs, err)
+	}
+}
+
+func TestHandshakeProtection(t *testing.T) {
+	s, err := startServerOpts(PORT9031, true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+	if rate, err := s.HandshakeRate(); err != nil || rate != DefaultHandshakeRate {
+		t.Errorf("Listener should have default handshake rate got %d %v", rate, err)
+	}
+
+	raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9031}
+	flood, err := net.DialUDP("udp4", nil, raddr)
+	if err != nil {
+		t.Fatalf("Unable to open UDP socket %s", err)
+	}
+	defer flood.Close()
+	send := func(n int, reqType int32) {
+		for i := 0; i < n; i++ {
+			if _, err := flood.Write(handshakePacket(reqType, rand.Uint32())); err != nil {
+				t.Fatalf("Unable to send handshake %s", err)
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	//guessed cookies are dropped
+	send(10, -1)
+	hs, err := s.HandshakeStats()
+	if err != nil {
+		t.Fatalf("Unable to read handshake stats %s", err)
+	}
+	if hs.Dropped != 10 || hs.Limited != 0 {
+		t.Errorf("10 handshakes with wrong cookie should be dropped got %+v", hs)
+	}
+
+	//requests above the rate of the source are dropped before they get a cookie
+	if err = s.SetHandshakeRate(5); err != nil {
+		t.Fatalf("Unable to set handshake rate %s", err)
+	}
+	send(20, 1)
+	if hs, _ = s.HandshakeStats(); hs.Dropped != 10 || hs.Limited < 14 {
+		t.Errorf("Handshakes above rate should be limited got %+v", hs)
+	}
+
+	if err = s.SetHandshakeRate(0); err != nil {
+		t.Fatalf("Unable to turn handshake rate off %s", err)
+	}
+	if err = s.SetHandshakeRate(-1); err == nil {
+		t.Errorf("Negative handshake rate should be rejected")
+	}
+
+	//connections above the limit of pending connections wait until earlier ones are accepted
+	if err = SetMaxPendingConns(1); err != nil {
+		t.Fatalf("Unable to limit pending connections %s", err)
+	}
+	defer SetMaxPendingConns(0)
+
+	dial := func(timeout time.Duration) (*Socket, error) {
+		sc, err := CreateSocket("ip4", true)
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err = connectContext(ctx, sc, raddr); err != nil {
+			Close(sc)
+			return nil, err
+		}
+		return sc, nil
+	}
+
+	first, err := dial(5 * time.Second)
+	if err != nil {
+		t.Fatalf("First connect should succeed %s", err)
+	}
+	defer Close(first)
+
+	limited := hs.Limited
+	if _, err = dial(time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect above pending limit should time out got %v", err)
+	}
+	if hs, _ = s.HandshakeStats(); hs.Limited <= limited {
+		t.Errorf("Handshakes above pending limit should be counted got %+v", hs)
+	}
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept %s", err)
+	}
+	Close(ns)
+
+	second, err := dial(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Connect after accept should succeed %s", err)
+	}
+	Close(second)
+
+	if err = SetMaxPendingConns(-1); err == nil {
+		t.Errorf("Negative pending limit should be rejected")
+	}
+}
@@ -0,0 +1,333 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//Event reports readiness of a connection watched by Poller.
+
+type Event struct {
+	Conn   interface{} //value passed to Poller.Add
+	Events int         //ready events, combination of UDT_EPOLL_IN, UDT_EPOLL_OUT and UDT_EPOLL_ERR
+}
+
+//Poller waits for readiness of UDT sockets and system descriptors using UDT epoll.
+//UDT sockets are added as *Socket or any value with Socket() *Socket method such as
+//*Conn, *MsgConn or *Listener, system descriptors as syscall.Conn such as *net.UDPConn
+//or *os.File. Broken UDT sockets are reported with UDT_EPOLL_ERR.
+
+type Poller struct {
+	eid int
+
+	mu      sync.Mutex
+	closed  bool
+	entries map[interface{}]*pollEntry
+	socks   map[C.UDTSOCKET]*pollEntry
+	fds     map[C.SYSSOCKET]*pollEntry
+}
+
+type pollEntry struct {
+	conn   interface{}
+	isUDT  bool
+	sock   C.UDTSOCKET
+	fd     C.SYSSOCKET
+	events int
+}
+
+//Creates new Poller. Poller holds UDT epoll id until it is closed.
+
+func NewPoller() (*Poller, error) {
+	eid, err := EpollCreate()
+	if err != nil {
+		return nil, err
+	}
+	return &Poller{
+		eid:     eid,
+		entries: make(map[interface{}]*pollEntry),
+		socks:   make(map[C.UDTSOCKET]*pollEntry),
+		fds:     make(map[C.SYSSOCKET]*pollEntry),
+	}, nil
+}
+
+//Starts watching conn for events, combination of UDT_EPOLL_IN, UDT_EPOLL_OUT and UDT_EPOLL_ERR.
+
+func (p *Poller) Add(conn interface{}, events int) error {
+	entry, err := newPollEntry(conn, events)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return net.ErrClosed
+	}
+	if _, ok := p.entries[conn]; ok {
+		return fmt.Errorf("%T is already added to poller", conn)
+	}
+	if err = p.register(entry); err != nil {
+		return err
+	}
+	p.entries[conn] = entry
+	if entry.isUDT {
+		p.socks[entry.sock] = entry
+	} else {
+		p.fds[entry.fd] = entry
+	}
+	return nil
+}
+
+//Changes events watched for conn.
+
+func (p *Poller) Modify(conn interface{}, events int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return net.ErrClosed
+	}
+	entry, ok := p.entries[conn]
+	if !ok {
+		return fmt.Errorf("%T is not added to poller", conn)
+	}
+
+	//UDT epoll has no modify operation
+	if err := p.unregister(entry); err != nil {
+		return err
+	}
+	entry.events = events
+	if err := p.register(entry); err != nil {
+		p.forget(entry)
+		return err
+	}
+	return nil
+}
+
+//Stops watching conn.
+
+func (p *Poller) Remove(conn interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return net.ErrClosed
+	}
+	entry, ok := p.entries[conn]
+	if !ok {
+		return fmt.Errorf("%T is not added to poller", conn)
+	}
+	p.forget(entry)
+	return p.unregister(entry)
+}
+
+//Waits until at least one watched connection is ready or ctx is done. Wait on
+//poller without connections waits for ctx. UDT epoll cannot be woken up, so Wait
+//sleeps in slices of maxBlockTime (250ms): deadline of ctx is met on time, but
+//cancellation of ctx and connections added or removed during Wait are noticed only
+//when the current slice ends.
+
+func (p *Poller) Wait(ctx context.Context) ([]Event, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, net.ErrClosed
+		}
+		readfds := make([]C.UDTSOCKET, len(p.socks))
+		writefds := make([]C.UDTSOCKET, len(p.socks))
+		lrfds := make([]C.SYSSOCKET, len(p.fds))
+		lwfds := make([]C.SYSSOCKET, len(p.fds))
+		p.mu.Unlock()
+
+		wait := maxBlockTime
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining < wait {
+				wait = remaining
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if wait < 0 {
+			wait = 0
+		}
+
+		rnum, wnum, lrnum, lwnum, err := epollWait(p.eid, readfds, writefds,
+			int64((wait+time.Millisecond-1)/time.Millisecond), lrfds, lwfds)
+		if err != nil {
+			if errors.Is(err, ErrTimeout) {
+				continue
+			}
+			if p.isClosed() {
+				return nil, net.ErrClosed
+			}
+			return nil, err
+		}
+
+		if events := p.events(readfds[:rnum], writefds[:wnum], lrfds[:lrnum], lwfds[:lwnum]); len(events) > 0 {
+			return events, nil
+		}
+	}
+}
+
+//Stops watching all connections and releases UDT epoll id. Pending Wait returns net.ErrClosed.
+
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return net.ErrClosed
+	}
+	p.closed = true
+	_, err := EpollRelease(p.eid)
+	return err
+}
+
+func (p *Poller) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+//Collects events of ready sockets, sockets removed since the wait started are skipped.
+
+func (p *Poller) events(readfds, writefds []C.UDTSOCKET, lrfds, lwfds []C.SYSSOCKET) []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []Event
+	index := make(map[*pollEntry]int)
+	add := func(entry *pollEntry, event int) {
+		if entry == nil {
+			return
+		}
+		i, ok := index[entry]
+		if !ok {
+			i = len(events)
+			index[entry] = i
+			events = append(events, Event{Conn: entry.conn})
+		}
+		events[i].Events |= event
+	}
+
+	for _, sock := range readfds {
+		add(p.socks[sock], UDT_EPOLL_IN)
+	}
+	for _, sock := range writefds {
+		add(p.socks[sock], UDT_EPOLL_OUT)
+	}
+	for _, fd := range lrfds {
+		add(p.fds[fd], UDT_EPOLL_IN)
+	}
+	for _, fd := range lwfds {
+		add(p.fds[fd], UDT_EPOLL_OUT)
+	}
+
+	//UDT reports broken sockets as readable and writable
+	for i := range events {
+		entry := p.entries[events[i].Conn]
+		if !entry.isUDT {
+			continue
+		}
+		switch SocketState(C.udt_getsockstate(entry.sock)) {
+		case StateBroken, StateClosing, StateClosed, StateNonexist:
+			events[i].Events = UDT_EPOLL_ERR | events[i].Events&entry.events
+		}
+	}
+	return events
+}
+
+func (p *Poller) register(entry *pollEntry) (err error) {
+	if entry.isUDT {
+		_, err = EpollAddUsock(p.eid, &Socket{sock: entry.sock}, entry.events|UDT_EPOLL_ERR)
+	} else {
+		_, err = EpollAddSsock(p.eid, entry.fd, entry.events)
+	}
+	return
+}
+
+func (p *Poller) unregister(entry *pollEntry) (err error) {
+	if entry.isUDT {
+		_, err = EpollRemoveUsock(p.eid, &Socket{sock: entry.sock})
+	} else {
+		_, err = EpollRemoveSsock(p.eid, entry.fd)
+	}
+	return
+}
+
+func (p *Poller) forget(entry *pollEntry) {
+	delete(p.entries, entry.conn)
+	if entry.isUDT {
+		delete(p.socks, entry.sock)
+	} else {
+		delete(p.fds, entry.fd)
+	}
+}
+
+//Resolves UDT socket or system descriptor of conn.
+
+func newPollEntry(conn interface{}, events int) (*pollEntry, error) {
+	if events&^(UDT_EPOLL_IN|UDT_EPOLL_OUT|UDT_EPOLL_ERR) != 0 {
+		return nil, fmt.Errorf("invalid poll events %#x", events)
+	}
+
+	entry := &pollEntry{conn: conn, events: events}
+	switch c := conn.(type) {
+	case *Socket:
+		entry.isUDT, entry.sock = true, c.sock
+	case interface{ Socket() *Socket }:
+		entry.isUDT, entry.sock = true, c.Socket().sock
+	case syscall.Conn:
+		raw, err := c.SyscallConn()
+		if err != nil {
+			return nil, err
+		}
+		if err = raw.Control(func(fd uintptr) { entry.fd = C.SYSSOCKET(fd) }); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unable to poll %T", conn)
+	}
+	return entry, nil
+}
@@ -0,0 +1,186 @@
+package udtgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPollerEmpty(t *testing.T) {
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatalf("Unable to create poller %s", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err = p.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait on empty poller should wait for context got %v", err)
+	}
+
+	eid, err := EpollCreate()
+	if err != nil {
+		t.Fatalf("Unable to create Epoll id %s", err)
+	}
+	defer EpollRelease(eid)
+	wsocks := CreateSockets(1)
+	if _, err = EpollWait2(eid, nil, wsocks.socks, 10, nil, nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("EpollWait2 with empty sets should time out got %v", err)
+	}
+}
+
+func TestPollerConn(t *testing.T) {
+	l, err := NewListener("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9019))
+	if err != nil {
+		t.Fatalf("Unable to listen %s", err)
+	}
+	defer l.Close()
+
+	client, err := DialContext(context.Background(), "udt4", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer client.Close()
+
+	server, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Unable to accept %s", err)
+	}
+	defer server.Close()
+
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatalf("Unable to create poller %s", err)
+	}
+	defer p.Close()
+
+	if err = p.Add(server, UDT_EPOLL_IN); err != nil {
+		t.Fatalf("Unable to add conn %s", err)
+	}
+	if err = p.Add(server, UDT_EPOLL_IN); err == nil {
+		t.Errorf("Adding conn twice should fail")
+	}
+
+	if _, err = client.Write([]byte("ping")); err != nil {
+		t.Fatalf("Unable to write %s", err)
+	}
+	events := waitEvents(t, p, time.Second)
+	if len(events) != 1 || events[0].Conn != server || events[0].Events != UDT_EPOLL_IN {
+		t.Fatalf("Server should be readable got %+v", events)
+	}
+
+	if err = p.Modify(server, UDT_EPOLL_OUT); err != nil {
+		t.Fatalf("Unable to modify conn %s", err)
+	}
+	events = waitEvents(t, p, time.Second)
+	if len(events) != 1 || events[0].Events != UDT_EPOLL_OUT {
+		t.Fatalf("Server should be writable got %+v", events)
+	}
+
+	if err = p.Remove(server); err != nil {
+		t.Fatalf("Unable to remove conn %s", err)
+	}
+	if events = waitEvents(t, p, 100*time.Millisecond); len(events) != 0 {
+		t.Errorf("Removed conn should not be reported got %+v", events)
+	}
+
+	buf := make([]byte, 10)
+	if n, err := server.Read(buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("Unable to read %s %q", err, buf[:n])
+	}
+	if err = p.Add(server, UDT_EPOLL_IN); err != nil {
+		t.Fatalf("Unable to add conn %s", err)
+	}
+	client.Close()
+	events = waitEvents(t, p, 5*time.Second)
+	if len(events) != 1 || events[0].Events&UDT_EPOLL_ERR == 0 {
+		t.Errorf("Closed connection should be reported with error got %+v", events)
+	}
+}
+
+func TestPollerSysConn(t *testing.T) {
+	uc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Unable to listen UDP %s", err)
+	}
+	defer uc.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Unable to create pipe %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	p, err := NewPoller()
+	if err != nil {
+		t.Fatalf("Unable to create poller %s", err)
+	}
+
+	if err = p.Add(uc, UDT_EPOLL_IN); err != nil {
+		t.Fatalf("Unable to add UDP conn %s", err)
+	}
+	if err = p.Add(r, UDT_EPOLL_IN); err != nil {
+		t.Fatalf("Unable to add file %s", err)
+	}
+	if events := waitEvents(t, p, 50*time.Millisecond); len(events) != 0 {
+		t.Errorf("Nothing should be ready got %+v", events)
+	}
+
+	if _, err = uc.WriteTo([]byte("ping"), uc.LocalAddr()); err != nil {
+		t.Fatalf("Unable to send datagram %s", err)
+	}
+	events := waitEvents(t, p, time.Second)
+	if len(events) != 1 || events[0].Conn != uc || events[0].Events != UDT_EPOLL_IN {
+		t.Errorf("UDP conn should be readable got %+v", events)
+	}
+	if err = p.Remove(uc); err != nil {
+		t.Errorf("Unable to remove UDP conn %s", err)
+	}
+
+	if _, err = w.Write([]byte("ping")); err != nil {
+		t.Fatalf("Unable to write pipe %s", err)
+	}
+	events = waitEvents(t, p, time.Second)
+	if len(events) != 1 || events[0].Conn != r || events[0].Events != UDT_EPOLL_IN {
+		t.Errorf("Pipe should be readable got %+v", events)
+	}
+
+	if err = p.Remove(r); err != nil {
+		t.Errorf("Unable to remove file %s", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := p.Wait(context.Background())
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Close()
+	select {
+	case err = <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Wait should return net.ErrClosed got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Close should unblock Wait")
+	}
+	if _, err = EpollRelease(p.eid); !errors.Is(err, &Error{Code: UDT_EINVPOLLID}) {
+		t.Errorf("Epoll id should be released got %v", err)
+	}
+}
+
+func waitEvents(t *testing.T, p *Poller, timeout time.Duration) []Event {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	events, err := p.Wait(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unable to wait %s", err)
+	}
+	return events
+}
@@ -0,0 +1,250 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+//Progress of a file transfer reported by SendFileContext and RecvFileContext.
+
+type Progress struct {
+	Offset    int64         //file offset reached, the receiving side can resume the transfer from it
+	Done      int64         //bytes transferred by this call, the sending side counts bytes queued in UDT
+	Total     int64         //bytes to transfer by this call, negative if unknown
+	Rate      float64       //bytes per second since the previous report
+	Bandwidth float64       //estimated bandwidth of the connection in bytes per second, see Stats
+	ETA       time.Duration //estimated time to transfer remaining bytes, 0 if unknown
+}
+
+//Options of SendFileContext and RecvFileContext, nil options use defaults.
+
+type FileTransferOptions struct {
+	OnProgress func(Progress) //called by the transferring goroutine every Interval and once at the end
+	Interval   time.Duration  //interval between progress reports, default 1s
+	BufferSize int            //size of file reads and writes, default 1MB
+}
+
+const (
+	defaultProgressInterval = time.Second
+	defaultFileBufferSize   = 1 << 20
+)
+
+//Sends size bytes of the file at path starting at offset. If size is negative, the rest of
+//the file is sent. Returns number of bytes queued in UDT sender buffer, which may be more than
+//the peer received when the transfer fails. Cancelling ctx stops the transfer within
+//maxBlockTime and returns ctx.Err(); the connection stays usable. A transfer aborted with the
+//connection has to be resumed from the offset reached by RecvFileContext of the receiver.
+
+func SendFileContext(ctx context.Context, conn *Conn, path string, offset, size int64,
+	opts *FileTransferOptions) (n int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if size < 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if size = fi.Size() - offset; size < 0 {
+			size = 0
+		}
+	}
+
+	p := newProgressReporter(conn, offset, size, opts)
+	stop := conn.watchContext(ctx, false)
+	defer stop()
+
+	buf := make([]byte, p.bufferSize)
+	for n < size && err == nil {
+		chunk := buf
+		if rest := size - n; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		m, rerr := f.ReadAt(chunk, offset+n)
+		if m > 0 {
+			var w int
+			w, err = conn.Write(chunk[:m])
+			n += int64(w)
+		}
+		switch {
+		case err != nil:
+		case rerr != nil && rerr != io.EOF:
+			err = rerr
+		case m < len(chunk):
+			err = io.ErrUnexpectedEOF
+		}
+		p.update(n, false)
+	}
+	err = contextError(ctx, err)
+	p.update(n, true)
+	return n, err
+}
+
+//Receives size bytes and writes them to the file at path starting at offset. The file is
+//created if it does not exist, existing content is kept. If size is negative, RecvFileContext
+//receives until the peer closes the connection, like RecvTo. Cancelling ctx stops the transfer
+//within maxBlockTime and returns ctx.Err(); the transfer can be resumed from offset+n.
+//Returns io.ErrUnexpectedEOF if the peer closes the connection before size bytes arrive.
+
+func RecvFileContext(ctx context.Context, conn *Conn, path string, offset, size int64,
+	opts *FileTransferOptions) (n int64, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	p := newProgressReporter(conn, offset, size, opts)
+	stop := conn.watchContext(ctx, true)
+	defer stop()
+
+	buf := make([]byte, p.bufferSize)
+	for (size < 0 || n < size) && err == nil {
+		chunk := buf
+		if rest := size - n; size >= 0 && rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		m, rerr := conn.Read(chunk)
+		if m > 0 {
+			var w int
+			w, err = f.WriteAt(chunk[:m], offset+n)
+			n += int64(w)
+		}
+		switch {
+		case err != nil:
+		case rerr == io.EOF && size < 0:
+			p.update(n, true)
+			return n, nil
+		case rerr == io.EOF:
+			err = io.ErrUnexpectedEOF
+		case rerr != nil:
+			err = rerr
+		}
+		p.update(n, false)
+	}
+	err = contextError(ctx, err)
+	p.update(n, true)
+	return n, err
+}
+
+//Returns ctx.Err() if err was caused by ctx. Deadline of ctx applied to the connection may
+//expire just before ctx itself is done.
+
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if d, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(d) {
+		<-ctx.Done()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+//Calls OnProgress at most once per interval and once at the end of transfer.
+
+type progressReporter struct {
+	conn       *Conn
+	opts       FileTransferOptions
+	bufferSize int
+	progress   Progress
+	last       time.Time
+}
+
+func newProgressReporter(conn *Conn, offset, size int64, opts *FileTransferOptions) *progressReporter {
+	p := &progressReporter{
+		conn:     conn,
+		progress: Progress{Offset: offset, Total: size},
+		last:     time.Now(),
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.Interval <= 0 {
+		p.opts.Interval = defaultProgressInterval
+	}
+	p.bufferSize = p.opts.BufferSize
+	if p.bufferSize <= 0 {
+		p.bufferSize = defaultFileBufferSize
+	}
+	return p
+}
+
+func (p *progressReporter) update(done int64, final bool) {
+	if p.opts.OnProgress == nil {
+		return
+	}
+	now := time.Now()
+	elapsed := now.Sub(p.last)
+	if !final && elapsed < p.opts.Interval {
+		return
+	}
+
+	if elapsed > 0 {
+		p.progress.Rate = float64(done-p.progress.Done) / elapsed.Seconds()
+	}
+	p.progress.Offset += done - p.progress.Done
+	p.progress.Done = done
+	if stats, err := p.conn.Socket().Stats(false); err == nil {
+		p.progress.Bandwidth = stats.BandwidthMbps * 1e6 / 8
+	}
+
+	//measured rate reflects the actual throughput, bandwidth is only an upper bound
+	rate := p.progress.Rate
+	if rate <= 0 {
+		rate = p.progress.Bandwidth
+	}
+	p.progress.ETA = 0
+	if remaining := p.progress.Total - done; remaining > 0 && rate > 0 {
+		p.progress.ETA = time.Duration(float64(remaining) / rate * float64(time.Second))
+	}
+
+	p.last = now
+	p.opts.OnProgress(p.progress)
+}
@@ -0,0 +1,135 @@
+package udtgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, size int, seed int64) (string, []byte) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	path := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	return path, data
+}
+
+func TestSendFileContext(t *testing.T) {
+	client, server := connPair(t, PORT9023, WithSendBuffer(256<<10), WithMaxBandwidth(16<<20))
+	defer client.Close()
+	defer server.Close()
+
+	src, data := writeTestFile(t, 4<<20, 3)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	var reports []Progress
+	opts := &FileTransferOptions{
+		OnProgress: func(p Progress) { reports = append(reports, p) },
+		Interval:   20 * time.Millisecond,
+		BufferSize: 64 << 10,
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := SendFileContext(context.Background(), client, src, 0, -1, opts)
+		done <- err
+	}()
+
+	if n, err := RecvFileContext(context.Background(), server, dst, 0, int64(len(data)), nil); err != nil || n != int64(len(data)) {
+		t.Fatalf("Unable to receive file %d %s", n, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Unable to send file %s", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Errorf("Received file differs from sent file")
+	}
+
+	if len(reports) < 3 {
+		t.Fatalf("Expected several progress reports got %d", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last.Done != int64(len(data)) || last.Offset != int64(len(data)) || last.ETA != 0 {
+		t.Errorf("Unexpected final progress %+v", last)
+	}
+	mid := reports[len(reports)/2]
+	if mid.Rate <= 0 || mid.ETA <= 0 || mid.Done <= 0 || mid.Done >= int64(len(data)) {
+		t.Errorf("Unexpected progress %+v", mid)
+	}
+}
+
+func TestSendFileContextCancel(t *testing.T) {
+	client, server := connPair(t, PORT9024, WithSendBuffer(256<<10), WithMaxBandwidth(4<<20))
+	defer client.Close()
+	defer server.Close()
+
+	src, data := writeTestFile(t, 4<<20, 4)
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	received := make(chan error, 1)
+	go func() {
+		_, err := RecvFileContext(context.Background(), server, dst, 0, int64(len(data)), nil)
+		received <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	n, err := SendFileContext(ctx, client, src, 0, -1, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Transfer should be cancelled got %d %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond+2*maxBlockTime {
+		t.Errorf("Cancellation took %v", elapsed)
+	}
+	if n <= 0 || n >= int64(len(data)) {
+		t.Fatalf("Cancelled transfer should be partial got %d", n)
+	}
+
+	//resume on the same connection
+	m, err := SendFileContext(context.Background(), client, src, n, -1, nil)
+	if err != nil || n+m != int64(len(data)) {
+		t.Fatalf("Unable to resume transfer %d %s", m, err)
+	}
+	if err = <-received; err != nil {
+		t.Fatalf("Unable to receive file %s", err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, data) {
+		t.Errorf("Received file differs from sent file")
+	}
+}
+
+func TestRecvFileContextUntilClose(t *testing.T) {
+	client, server := connPair(t, PORT9050)
+	defer server.Close()
+
+	src, data := writeTestFile(t, 1<<20, 5)
+	dst := filepath.Join(t.TempDir(), "dst")
+	if err := os.WriteFile(dst, []byte("head"), 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	go func() {
+		SendFileContext(context.Background(), client, src, 0, -1, nil)
+		client.Close()
+	}()
+
+	var last Progress
+	opts := &FileTransferOptions{OnProgress: func(p Progress) { last = p }}
+	n, err := RecvFileContext(context.Background(), server, dst, 4, -1, opts)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("Unable to receive file until close %d %v", n, err)
+	}
+	if got, _ := os.ReadFile(dst); !bytes.Equal(got, append([]byte("head"), data...)) {
+		t.Errorf("Received file differs from sent file")
+	}
+	if last.Done != n || last.Offset != 4+n || last.Total >= 0 {
+		t.Errorf("Unexpected final progress %+v", last)
+	}
+}
@@ -0,0 +1,405 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+// #include "udtc.h"
+import "C"
+
+import (
+	"sync"
+	"time"
+	"unsafe"
+)
+
+//Size of IP, UDP and UDT headers of data packet. UDT carries MSS - udtHeaderSize bytes
+//of data in a packet.
+
+const (
+	udpHeaderSize = 28
+	udtHeaderSize = udpHeaderSize + 16
+)
+
+//Stats is a snapshot of UDT performance counters of a socket, see
+//http://udt.sourceforge.net/udt4/doc/trace.htm. Totals count from the socket start,
+//local counters count from the last snapshot taken with clear set.
+
+type Stats struct {
+	Time    time.Time     //local time of the snapshot
+	Elapsed time.Duration //time since the UDT socket was started
+
+	//global measurements
+	PktSentTotal     int64         //sent data packets, including retransmissions
+	PktRecvTotal     int64         //received packets
+	PktSndLossTotal  int64         //lost packets reported by the receiver (sender side)
+	PktRcvLossTotal  int64         //lost packets detected by the receiver
+	PktRetransTotal  int64         //retransmitted packets
+	PktSentACKTotal  int64         //sent ACK packets
+	PktRecvACKTotal  int64         //received ACK packets
+	PktSentNAKTotal  int64         //sent NAK packets
+	PktRecvNAKTotal  int64         //received NAK packets
+	SndDurationTotal time.Duration //time spent sending data, idle time exclusive
+
+	//local measurements
+	PktSent      int64         //sent data packets, including retransmissions
+	PktRecv      int64         //received packets
+	PktSndLoss   int64         //lost packets (sender side)
+	PktRcvLoss   int64         //lost packets (receiver side)
+	PktRetrans   int64         //retransmitted packets
+	PktSentACK   int64         //sent ACK packets
+	PktRecvACK   int64         //received ACK packets
+	PktSentNAK   int64         //sent NAK packets
+	PktRecvNAK   int64         //received NAK packets
+	SendRateMbps float64       //sending rate in Mb/s
+	RecvRateMbps float64       //receiving rate in Mb/s
+	SndDuration  time.Duration //time spent sending data, idle time exclusive
+
+	//instant measurements
+	PktSndPeriod     time.Duration //packet sending period
+	FlowWindow       int           //flow window size in packets
+	CongestionWindow int           //congestion window size in packets
+	FlightSize       int           //packets on flight
+	RTT              time.Duration //round trip time
+	BandwidthMbps    float64       //estimated link bandwidth in Mb/s
+	SndBufAvailBytes int64         //available UDT sender buffer
+	RcvBufAvailBytes int64         //available UDT receiver buffer
+
+	//socket configuration
+	PayloadSize int64 //data bytes carried by a packet
+	SndBufBytes int64 //UDT sender buffer size, in units of SndBufAvailBytes
+	RcvBufBytes int64 //UDT receiver buffer size, in units of RcvBufAvailBytes
+}
+
+//Takes snapshot of performance counters of the socket. If clear is true local
+//counters are reset after the snapshot.
+
+func (socket *Socket) Stats(clear bool) (stats Stats, err error) {
+	var cClear C.int
+	if clear {
+		cClear = 1
+	}
+
+	var perf C.UDT_TRACEINFO
+	if retval, errno := C.udt_perfmon(socket.sock, (*C.UDT_TRACEINFO)(unsafe.Pointer(&perf)), cClear); retval < 0 {
+		return stats, udtError("perfmon", errno)
+	}
+
+	stats = Stats{
+		Time:    time.Now(),
+		Elapsed: time.Duration(perf.msTimeStamp) * time.Millisecond,
+
+		PktSentTotal:     int64(perf.pktSentTotal),
+		PktRecvTotal:     int64(perf.pktRecvTotal),
+		PktSndLossTotal:  int64(perf.pktSndLossTotal),
+		PktRcvLossTotal:  int64(perf.pktRcvLossTotal),
+		PktRetransTotal:  int64(perf.pktRetransTotal),
+		PktSentACKTotal:  int64(perf.pktSentACKTotal),
+		PktRecvACKTotal:  int64(perf.pktRecvACKTotal),
+		PktSentNAKTotal:  int64(perf.pktSentNAKTotal),
+		PktRecvNAKTotal:  int64(perf.pktRecvNAKTotal),
+		SndDurationTotal: time.Duration(perf.usSndDurationTotal) * time.Microsecond,
+
+		PktSent:      int64(perf.pktSent),
+		PktRecv:      int64(perf.pktRecv),
+		PktSndLoss:   int64(perf.pktSndLoss),
+		PktRcvLoss:   int64(perf.pktRcvLoss),
+		PktRetrans:   int64(perf.pktRetrans),
+		PktSentACK:   int64(perf.pktSentACK),
+		PktRecvACK:   int64(perf.pktRecvACK),
+		PktSentNAK:   int64(perf.pktSentNAK),
+		PktRecvNAK:   int64(perf.pktRecvNAK),
+		SendRateMbps: float64(perf.mbpsSendRate),
+		RecvRateMbps: float64(perf.mbpsRecvRate),
+		SndDuration:  time.Duration(perf.usSndDuration) * time.Microsecond,
+
+		PktSndPeriod:     time.Duration(float64(perf.usPktSndPeriod) * float64(time.Microsecond)),
+		FlowWindow:       int(perf.pktFlowWindow),
+		CongestionWindow: int(perf.pktCongestionWindow),
+		FlightSize:       int(perf.pktFlightSize),
+		RTT:              time.Duration(float64(perf.msRTT) * float64(time.Millisecond)),
+		BandwidthMbps:    float64(perf.mbpsBandwidth),
+		SndBufAvailBytes: int64(perf.byteAvailSndBuf),
+		RcvBufAvailBytes: int64(perf.byteAvailRcvBuf),
+	}
+
+	//UDT reports buffer sizes in data bytes but available buffer in whole packets
+	mss, err := socket.MSS()
+	if err != nil {
+		return stats, err
+	}
+	sndBuf, err := socket.SendBuffer()
+	if err != nil {
+		return stats, err
+	}
+	rcvBuf, err := socket.RecvBuffer()
+	if err != nil {
+		return stats, err
+	}
+	if mss := int64(mss); mss > udtHeaderSize {
+		stats.PayloadSize = mss - udtHeaderSize
+		stats.SndBufBytes = int64(sndBuf) / (mss - udpHeaderSize) * mss
+		stats.RcvBufBytes = int64(rcvBuf) / (mss - udpHeaderSize) * mss
+	}
+	return stats, nil
+}
+
+//HandshakeStats counts handshakes a listening socket dropped without answering them.
+
+type HandshakeStats struct {
+	Dropped int64 //wrong SYN cookie or pre-shared key signature
+	Limited int64 //above handshake rate of the source or limit of pending connections
+}
+
+//Returns handshake counters of listening socket (UDT_HSDROPPED and UDT_HSLIMITED), counted
+//from the start of the socket.
+
+func (socket *Socket) HandshakeStats() (stats HandshakeStats, err error) {
+	for _, opt := range []struct {
+		option C.int
+		value  *int64
+	}{{C.UDT_UDT_HSDROPPED, &stats.Dropped}, {C.UDT_UDT_HSLIMITED, &stats.Limited}} {
+		var value C.int64_t
+		optlen := C.int(unsafe.Sizeof(value))
+		if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), opt.option, unsafe.Pointer(&value), &optlen); cret < 0 {
+			return HandshakeStats{}, udtError("getsockopt", errno)
+		}
+		*opt.value = int64(value)
+	}
+	return stats, nil
+}
+
+//Returns used fraction of UDT sender buffer, between 0 and 1.
+
+func (s *Stats) SendBufferUtilization() float64 {
+	return utilization(s.SndBufAvailBytes, s.SndBufBytes)
+}
+
+//Returns used fraction of UDT receiver buffer, between 0 and 1.
+
+func (s *Stats) RecvBufferUtilization() float64 {
+	return utilization(s.RcvBufAvailBytes, s.RcvBufBytes)
+}
+
+func utilization(avail, size int64) float64 {
+	if size <= 0 || avail >= size {
+		return 0
+	}
+	if avail <= 0 {
+		return 1
+	}
+	return 1 - float64(avail)/float64(size)
+}
+
+//StatsDelta holds change of total counters between two snapshots of the same socket.
+
+type StatsDelta struct {
+	Interval    time.Duration //wall time between the snapshots
+	PktSent     int64
+	PktRecv     int64
+	PktSndLoss  int64
+	PktRcvLoss  int64
+	PktRetrans  int64
+	PktSentACK  int64
+	PktRecvACK  int64
+	PktSentNAK  int64
+	PktRecvNAK  int64
+	SndDuration time.Duration
+	PayloadSize int64 //data bytes carried by a packet
+}
+
+//Returns change of counters since prev, an earlier snapshot of the same socket.
+
+func (s *Stats) Delta(prev *Stats) StatsDelta {
+	return StatsDelta{
+		Interval:    s.Time.Sub(prev.Time),
+		PktSent:     s.PktSentTotal - prev.PktSentTotal,
+		PktRecv:     s.PktRecvTotal - prev.PktRecvTotal,
+		PktSndLoss:  s.PktSndLossTotal - prev.PktSndLossTotal,
+		PktRcvLoss:  s.PktRcvLossTotal - prev.PktRcvLossTotal,
+		PktRetrans:  s.PktRetransTotal - prev.PktRetransTotal,
+		PktSentACK:  s.PktSentACKTotal - prev.PktSentACKTotal,
+		PktRecvACK:  s.PktRecvACKTotal - prev.PktRecvACKTotal,
+		PktSentNAK:  s.PktSentNAKTotal - prev.PktSentNAKTotal,
+		PktRecvNAK:  s.PktRecvNAKTotal - prev.PktRecvNAKTotal,
+		SndDuration: s.SndDurationTotal - prev.SndDurationTotal,
+		PayloadSize: s.PayloadSize,
+	}
+}
+
+//Returns sum of counters of d and o, deltas of sockets transferring in parallel. Interval
+//is the longer of the two, so rates of the sum are aggregate rates of the sockets.
+
+func (d StatsDelta) Add(o StatsDelta) StatsDelta {
+	d.Interval = max(d.Interval, o.Interval)
+	d.PktSent += o.PktSent
+	d.PktRecv += o.PktRecv
+	d.PktSndLoss += o.PktSndLoss
+	d.PktRcvLoss += o.PktRcvLoss
+	d.PktRetrans += o.PktRetrans
+	d.PktSentACK += o.PktSentACK
+	d.PktRecvACK += o.PktRecvACK
+	d.PktSentNAK += o.PktSentNAK
+	d.PktRecvNAK += o.PktRecvNAK
+	d.SndDuration += o.SndDuration
+	if d.PayloadSize == 0 {
+		d.PayloadSize = o.PayloadSize
+	}
+	return d
+}
+
+//Returns fraction of sent packets reported lost by the receiver.
+
+func (d StatsDelta) LossRate() float64 {
+	return ratio(d.PktSndLoss, d.PktSent)
+}
+
+//Returns fraction of packets lost on the way to this side.
+
+func (d StatsDelta) RecvLossRate() float64 {
+	return ratio(d.PktRcvLoss, d.PktRecv+d.PktRcvLoss)
+}
+
+//Returns fraction of sent packets which were retransmissions.
+
+func (d StatsDelta) RetransRatio() float64 {
+	return ratio(d.PktRetrans, d.PktSent)
+}
+
+//Returns sending rate in bytes per second including retransmissions. Packets are
+//counted as full, the rate is an upper estimate when messages are small.
+
+func (d StatsDelta) Throughput() float64 {
+	return rate(d.PktSent*d.PayloadSize, d.Interval)
+}
+
+//Returns sending rate of new data in bytes per second, retransmissions excluded.
+
+func (d StatsDelta) Goodput() float64 {
+	return rate((d.PktSent-d.PktRetrans)*d.PayloadSize, d.Interval)
+}
+
+//Returns receiving rate in bytes per second.
+
+func (d StatsDelta) RecvThroughput() float64 {
+	return rate(d.PktRecv*d.PayloadSize, d.Interval)
+}
+
+func ratio(part, total int64) float64 {
+	if total <= 0 || part <= 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+func rate(bytes int64, interval time.Duration) float64 {
+	if interval <= 0 || bytes <= 0 {
+		return 0
+	}
+	return float64(bytes) / interval.Seconds()
+}
+
+//StatsSampler takes snapshots of socket performance counters at fixed interval and
+//delivers them on channel C. Like time.Ticker, it drops snapshots the receiver is not
+//ready for. C is closed when the sampler is stopped or the socket is closed.
+
+type StatsSampler struct {
+	C <-chan Stats
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+//Starts sampling the socket every interval. Local counters are not cleared, deltas
+//between snapshots are computed from totals with Stats.Delta.
+
+func NewStatsSampler(socket *Socket, interval time.Duration) *StatsSampler {
+	if interval <= 0 {
+		panic("non-positive interval for NewStatsSampler")
+	}
+	c := make(chan Stats, 1)
+	s := &StatsSampler{
+		C:    c,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run(socket, interval, c)
+	return s
+}
+
+func (s *StatsSampler) run(socket *Socket, interval time.Duration, c chan<- Stats) {
+	defer close(s.done)
+	defer close(c)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		stats, err := socket.Stats(false)
+		if err != nil {
+			s.err = err
+			return
+		}
+		select {
+		case c <- stats:
+		default:
+		}
+	}
+}
+
+//Stops sampling and waits until the sampling goroutine exits. A snapshot already
+//buffered in C can still be received before C reports closed.
+
+func (s *StatsSampler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+//Returns error which ended sampling, e.g. *Error for closed socket. It is nil while
+//the sampler runs or if it was stopped by Stop.
+
+func (s *StatsSampler) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
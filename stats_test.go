@@ -0,0 +1,105 @@
+package udtgo
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStatsDelta(t *testing.T) {
+	prev := Stats{Time: time.Unix(0, 0), PktSentTotal: 100, PktRetransTotal: 10, PktSndLossTotal: 5, PayloadSize: 1000}
+	cur := Stats{Time: time.Unix(2, 0), PktSentTotal: 300, PktRetransTotal: 30, PktSndLossTotal: 25, PayloadSize: 1000,
+		SndBufBytes: 4000, SndBufAvailBytes: 1000}
+
+	d := cur.Delta(&prev)
+	if d.Interval != 2*time.Second || d.PktSent != 200 {
+		t.Fatalf("Unexpected delta %+v", d)
+	}
+	if d.LossRate() != 0.1 || d.RetransRatio() != 0.1 {
+		t.Errorf("Loss rate and retransmission ratio should be 0.1 got %f %f", d.LossRate(), d.RetransRatio())
+	}
+	if d.Throughput() != 100000 || d.Goodput() != 90000 {
+		t.Errorf("Throughput should be 100000 and goodput 90000 got %f %f", d.Throughput(), d.Goodput())
+	}
+	sum := StatsDelta{}.Add(d).Add(StatsDelta{Interval: time.Second, PktSent: 200, PktRetrans: 20, PayloadSize: 1000})
+	if sum.Interval != 2*time.Second || sum.PktSent != 400 || sum.Throughput() != 200000 {
+		t.Errorf("Unexpected sum of deltas %+v", sum)
+	}
+	if u := cur.SendBufferUtilization(); u != 0.75 {
+		t.Errorf("Sender buffer utilization should be 0.75 got %f", u)
+	}
+	if u := prev.RecvBufferUtilization(); u != 0 {
+		t.Errorf("Unknown buffer size should give zero utilization got %f", u)
+	}
+}
+
+func TestStatsSampler(t *testing.T) {
+	s, err := startServer(PORT9018, "ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to start server %s", err)
+	}
+	defer Close(s)
+
+	dataSize := 1 << 20
+	read := make(chan struct{})
+	go func() {
+		sc, err := startClient("ip4", "localhost", PORT9018, true)
+		if err != nil {
+			t.Errorf("Unable to start client %s", err)
+			return
+		}
+		c := NewConn(sc)
+		defer c.Close()
+		if _, err = c.Write(make([]byte, dataSize)); err != nil {
+			t.Errorf("Unable to write data %s", err)
+		}
+		<-read
+	}()
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept request on socket %s", err)
+	}
+	c := NewConn(ns)
+
+	first, err := ns.Stats(false)
+	if err != nil {
+		t.Fatalf("Unable to get stats %s", err)
+	}
+	if first.PayloadSize != 1500-udtHeaderSize || first.RcvBufBytes <= 0 {
+		t.Errorf("Unexpected payload size %d and receiver buffer %d", first.PayloadSize, first.RcvBufBytes)
+	}
+
+	sampler := NewStatsSampler(ns, 5*time.Millisecond)
+	if n, err := io.CopyN(io.Discard, c, int64(dataSize)); err != nil || n != int64(dataSize) {
+		t.Fatalf("Unable to read data %s %d", err, n)
+	}
+
+	//sampler may still hold a snapshot taken before data arrived, compare with a fresh one
+	select {
+	case <-sampler.C:
+	case <-time.After(time.Second):
+		t.Fatalf("Sampler did not deliver stats")
+	}
+	last, err := ns.Stats(false)
+	close(read)
+	if err != nil {
+		t.Fatalf("Unable to get stats %s", err)
+	}
+	c.Close()
+
+	for range sampler.C {
+	}
+	if sampler.Err() == nil {
+		t.Errorf("Sampler should stop with error after the socket is closed")
+	}
+	sampler.Stop()
+
+	d := last.Delta(&first)
+	if d.PktRecv <= 0 || d.RecvThroughput() <= 0 {
+		t.Errorf("Received packets should be counted %+v", d)
+	}
+	if last.Elapsed <= 0 || last.RTT < 0 {
+		t.Errorf("Unexpected stats %+v", last)
+	}
+}
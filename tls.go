@@ -0,0 +1,146 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package udtgo
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+//TLSConn is a TLS connection over UDT stream connection. It embeds *tls.Conn, so it
+//implements net.Conn and exposes the TLS methods such as ConnectionState and
+//HandshakeContext.
+
+type TLSConn struct {
+	*tls.Conn
+	udt *Conn
+}
+
+//TLSInfo holds negotiated TLS state together with UDT performance counters of the
+//underlying connection.
+
+type TLSInfo struct {
+	TLS   tls.ConnectionState
+	Stats Stats
+}
+
+//DialTLS connects to the address like DialContext and runs TLS client handshake over the
+//connection. If config.ServerName is empty, host of the address is used like by
+//tls.Dial. Client certificates of config are sent when the server requests them. Deadline
+//and cancellation of ctx apply to both connect and handshake, on failure the connection is
+//closed.
+
+func DialTLS(ctx context.Context, network, address string, config *tls.Config) (*TLSConn, error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: "udt", Err: err}
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	c, err := DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn := &TLSConn{Conn: tls.Client(c, config), udt: c.(*Conn)}
+	if err = conn.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, &net.OpError{Op: "dial", Net: "udt", Addr: c.RemoteAddr(), Err: err}
+	}
+	return conn, nil
+}
+
+//TLSListener accepts UDT stream connections and returns them as server side *TLSConn.
+//Like tls.Listener it does not run the handshake in Accept, the handshake runs on the first
+//Read or Write or on HandshakeContext.
+
+type TLSListener struct {
+	*Listener
+	config *tls.Config
+}
+
+//ListenTLS creates listener like NewListener which serves TLS over accepted connections.
+//config must hold at least one certificate or set GetCertificate or GetConfigForClient.
+//Client certificates are requested and verified according to config.ClientAuth and
+//config.ClientCAs.
+
+func ListenTLS(network, address string, config *tls.Config) (*TLSListener, error) {
+	if config == nil || len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, &net.OpError{Op: "listen", Net: "udt",
+			Err: errors.New("tls: neither Certificates, GetCertificate, nor GetConfigForClient set in Config")}
+	}
+	l, err := NewListener(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &TLSListener{Listener: l.(*Listener), config: config}, nil
+}
+
+//Waits for and returns the next connection as *TLSConn.
+
+func (l *TLSListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &TLSConn{Conn: tls.Server(c, l.config), udt: c.(*Conn)}, nil
+}
+
+//Returns the UDT stream connection carrying TLS records.
+
+func (c *TLSConn) UDTConn() *Conn {
+	return c.udt
+}
+
+//Returns UDT socket of the connection.
+
+func (c *TLSConn) Socket() *Socket {
+	return c.udt.Socket()
+}
+
+//Returns negotiated TLS state and snapshot of UDT performance counters, see
+//Socket.Stats for clear. The TLS state is incomplete until the handshake finished.
+
+func (c *TLSConn) Info(clear bool) (TLSInfo, error) {
+	stats, err := c.udt.Socket().Stats(clear)
+	return TLSInfo{TLS: c.ConnectionState(), Stats: stats}, err
+}
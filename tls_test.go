@@ -0,0 +1,131 @@
+package udtgo
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	mathbig "math/big" //the package declares constant big
+	"net"
+	"testing"
+	"time"
+)
+
+//Creates a certificate signed by parent, or self-signed CA certificate if parent is nil.
+
+func testCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: mathbig.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	issuer, signer := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatalf("Unable to create certificate %s", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestDialTLS(t *testing.T) {
+	ca := testCert(t, "ca", nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	l, err := ListenTLS("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9025), &tls.Config{
+		Certificates: []tls.Certificate{testCert(t, "localhost", &ca)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatalf("Unable to listen %s", err)
+	}
+	defer l.Close()
+
+	message := "Hello from Kamlesh"
+	peers := make(chan TLSInfo, 1)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				tc := c.(*TLSConn)
+				if err := tc.HandshakeContext(context.Background()); err != nil {
+					return
+				}
+				io.WriteString(tc, message)
+				info, _ := tc.Info(false)
+				peers <- info
+				io.Copy(io.Discard, tc)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	address := fmt.Sprintf("localhost:%d", PORT9025)
+	c, err := DialTLS(ctx, "udt4", address, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{testCert(t, "client", &ca)},
+	})
+	if err != nil {
+		t.Fatalf("Unable to dial %s", err)
+	}
+	defer c.Close()
+
+	data := make([]byte, len(message))
+	if _, err = io.ReadFull(c, data); err != nil || string(data) != message {
+		t.Fatalf("Message should be %q got %q %v", message, data, err)
+	}
+	info, err := c.Info(false)
+	if err != nil {
+		t.Fatalf("Unable to get connection info %s", err)
+	}
+	if !info.TLS.HandshakeComplete || info.TLS.ServerName != "localhost" || info.Stats.PktRecvTotal == 0 {
+		t.Errorf("Unexpected connection info %+v", info)
+	}
+	if peer := <-peers; len(peer.TLS.PeerCertificates) == 0 || peer.TLS.PeerCertificates[0].Subject.CommonName != "client" {
+		t.Errorf("Server should verify client certificate %+v", peer.TLS)
+	}
+
+	//the server requires a client certificate
+	c2, err := DialTLS(ctx, "udt4", address, &tls.Config{RootCAs: pool})
+	if err == nil {
+		//TLS 1.3 client finishes handshake before the server verified it
+		_, err = c2.Read(data)
+		c2.Close()
+	}
+	if err == nil {
+		t.Errorf("Connection without client certificate should fail")
+	}
+}
+
+func TestListenTLSConfig(t *testing.T) {
+	if _, err := ListenTLS("udt4", fmt.Sprintf("127.0.0.1:%d", PORT9026), &tls.Config{}); err == nil {
+		t.Errorf("Listener without certificate should fail")
+	}
+}
@@ -0,0 +1,435 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kambeena/udtgo"
+)
+
+//Files smaller than packLimit are packed into one continuous stream written through a
+//buffer of packBuffer bytes, larger files are sent by UDT sendfile.
+
+const (
+	packLimit  = 1 << 20
+	packBuffer = 1 << 20
+)
+
+//Result of a directory transfer.
+
+type DirResult struct {
+	ID          string //slash separated path of the directory relative to the receiver directory
+	Dirs        int    //number of directories including the directory itself
+	Files       int    //number of regular files
+	Symlinks    int    //number of symbolic links
+	Size        int64  //total size of files
+	Skipped     int    //files the receiver already had with the same size and modification time
+	Transferred int64  //bytes of file data transferred over the connection
+}
+
+//Sends the directory tree at dir under id, "." stores it in the receiver directory itself.
+//Regular files, directories and symbolic links are sent with their permissions and
+//modification times, other files are skipped. Files the receiver already has with the same
+//size and modification time are not sent again, so an interrupted transfer continues with
+//the remaining files when SendDir is called again. Progress of opts is reported for each
+//file sent by UDT sendfile, cancelling ctx during such a file closes the connection. The
+//connection must be closed after an error other than ErrRejected.
+
+func SendDir(ctx context.Context, conn *udtgo.Conn, dir, id string, opts *udtgo.FileTransferOptions) (*DirResult, error) {
+	res := &DirResult{ID: id}
+	m, paths, err := readTree(dir, id, res)
+	if err != nil {
+		return res, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	//hide Conn.ReadFrom from the buffer, small files are copied into it
+	bw := bufio.NewWriterSize(struct{ io.Writer }{conn}, packBuffer)
+	if err = writeManifest(bw, m); err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return res, ctxError(ctx, err)
+	}
+	resp, err := readResponse(conn)
+	if err != nil {
+		return res, ctxError(ctx, err)
+	}
+	if err = resp.err(); err != nil {
+		return res, err
+	}
+	needed, err := readIndexes(conn, len(m.Entries))
+	if err != nil {
+		return res, ctxError(ctx, err)
+	}
+	res.Skipped = res.Files - len(needed)
+
+	for _, i := range needed {
+		e := &m.Entries[i]
+		if e.Type != entryFile {
+			return res, fmt.Errorf("%w: entry %q is not a file", ErrProtocol, e.Path)
+		}
+		if err = ctx.Err(); err != nil {
+			return res, err
+		}
+		if e.Size < packLimit {
+			err = packFile(bw, paths[i], e.Size)
+			if err == nil {
+				res.Transferred += e.Size
+			}
+		} else if err = bw.Flush(); err == nil {
+			var n int64
+			n, err = sendData(ctx, conn, paths[i], 0, e.Size, opts)
+			res.Transferred += n
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				err = fmt.Errorf("transfer: file %s changed during transfer", paths[i])
+			}
+		}
+		if err != nil {
+			return res, ctxError(ctx, err)
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return res, ctxError(ctx, err)
+	}
+
+	if resp, err = readResponse(conn); err != nil {
+		return res, ctxError(ctx, err)
+	}
+	return res, resp.err()
+}
+
+//Returns manifest of the tree at dir and local paths of its entries.
+
+func readTree(dir, id string, res *DirResult) (*manifest, []string, error) {
+	m := &manifest{ID: id}
+	var paths []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := entry{
+			Path:    filepath.ToSlash(rel),
+			Mode:    uint32(fi.Mode().Perm()),
+			ModTime: fi.ModTime().UnixNano(),
+		}
+		switch {
+		case fi.IsDir():
+			e.Type = entryDir
+			res.Dirs++
+		case fi.Mode().IsRegular():
+			e.Type = entryFile
+			e.Size = fi.Size()
+			res.Files++
+			res.Size += e.Size
+		case fi.Mode()&fs.ModeSymlink != 0:
+			e.Type = entrySymlink
+			if e.Target, err = os.Readlink(p); err != nil {
+				return err
+			}
+			res.Symlinks++
+		default:
+			return nil
+		}
+		m.Entries = append(m.Entries, e)
+		paths = append(paths, p)
+		return nil
+	})
+	return m, paths, err
+}
+
+//Writes exactly size bytes of the file at path to w.
+
+func packFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.CopyN(w, f, size); err == io.EOF {
+		err = fmt.Errorf("transfer: file %s changed during transfer", path)
+	}
+	return err
+}
+
+//Returns ctx.Err() instead of err if the deadline of the connection was moved because
+//ctx is done.
+
+func ctxError(ctx context.Context, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+//Receives a directory sent by SendDir. Returns io.EOF if the peer closed the connection
+//instead of sending another directory. Entries must stay inside the directory and parents
+//of entries must be directories of the manifest, otherwise the directory is rejected. The
+//connection must be closed after an error other than ErrRejected.
+
+func (r *Receiver) ReceiveDir(ctx context.Context, conn *udtgo.Conn) (*DirResult, error) {
+	kind, err := readHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	if kind != dirMagic {
+		return nil, fmt.Errorf("%w: expected directory manifest got %q", ErrProtocol, kind)
+	}
+	return r.receiveDir(ctx, conn)
+}
+
+//Receives a directory after the manifest header.
+
+func (r *Receiver) receiveDir(ctx context.Context, conn *udtgo.Conn) (*DirResult, error) {
+	m, err := readManifest(conn)
+	if err != nil {
+		return nil, err
+	}
+	res := &DirResult{ID: m.ID}
+
+	paths, err := r.checkManifest(m, res)
+	if err != nil {
+		writeResponse(conn, &response{Status: statusRejected, Message: err.Error()})
+		return res, fmt.Errorf("%w: %s", ErrRejected, err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	needed, err := makeDirs(m, paths)
+	if err != nil {
+		writeResponse(conn, &response{Status: statusFailed, Message: err.Error()})
+		return res, err
+	}
+	if err = writeResponse(conn, &response{Status: statusOK}); err == nil {
+		err = writeIndexes(conn, needed)
+	}
+	if err != nil {
+		return res, ctxError(ctx, err)
+	}
+	res.Skipped = res.Files - len(needed)
+
+	for _, i := range needed {
+		e := &m.Entries[i]
+		n, err := r.recvFile(ctx, conn, paths[i], e)
+		res.Transferred += n
+		if err != nil {
+			return res, ctxError(ctx, err)
+		}
+	}
+
+	if err = finishDirs(m, paths); err != nil {
+		writeResponse(conn, &response{Status: statusFailed, Message: err.Error()})
+		return res, err
+	}
+	return res, writeResponse(conn, &response{Status: statusOK})
+}
+
+//Validates entries of the manifest and returns their destination paths.
+
+func (r *Receiver) checkManifest(m *manifest, res *DirResult) ([]string, error) {
+	root, err := r.path(m.ID)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(m.Entries))
+	dirs := make(map[string]bool)
+	seen := make(map[string]bool, len(m.Entries))
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		name := filepath.FromSlash(e.Path)
+		if e.Path != path.Clean(e.Path) || strings.ContainsRune(e.Path, '\\') || !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("invalid path %q", e.Path)
+		}
+		if seen[e.Path] {
+			return nil, fmt.Errorf("duplicate path %q", e.Path)
+		}
+		seen[e.Path] = true
+		//links are created last, so no path is resolved through a link of the manifest
+		if (e.Path == "." && e.Type != entryDir) || (e.Path != "." && !dirs[path.Dir(e.Path)]) {
+			return nil, fmt.Errorf("parent of %q is not a directory", e.Path)
+		}
+		paths[i] = filepath.Join(root, name)
+
+		switch e.Type {
+		case entryDir:
+			dirs[e.Path] = true
+			res.Dirs++
+		case entryFile:
+			if r.Accept != nil {
+				info := FileInfo{ID: path.Join(m.ID, e.Path), Size: e.Size, ModTime: time.Unix(0, e.ModTime)}
+				if err = r.Accept(info); err != nil {
+					return nil, err
+				}
+			}
+			res.Files++
+			res.Size += e.Size
+		case entrySymlink:
+			res.Symlinks++
+		}
+	}
+	return paths, nil
+}
+
+//Creates the directory and its subdirectories. Returns indexes of files which are not
+//complete. A directory which exists as a link, for example received by an earlier transfer,
+//fails the transfer, nothing is written through it.
+
+func makeDirs(m *manifest, paths []string) ([]int, error) {
+	var needed []int
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		switch e.Type {
+		case entryDir:
+			if err := os.MkdirAll(paths[i], 0755); err != nil {
+				return nil, err
+			}
+			if fi, err := os.Lstat(paths[i]); err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("%s is not a directory", paths[i])
+			}
+			//writable until finishDirs sets the permissions
+			if err := os.Chmod(paths[i], 0700); err != nil {
+				return nil, err
+			}
+		case entryFile:
+			if !isComplete(paths[i], &request{Size: e.Size, ModTime: e.ModTime}) {
+				needed = append(needed, i)
+			}
+		}
+	}
+	return needed, nil
+}
+
+//Receives data of the file e into a temporary file and renames it to final.
+
+func (r *Receiver) recvFile(ctx context.Context, conn *udtgo.Conn, final string, e *entry) (n int64, err error) {
+	part := partPath(final, &request{ID: e.Path, Size: e.Size, ModTime: e.ModTime})
+	defer func() {
+		if err != nil {
+			os.Remove(part)
+		}
+	}()
+
+	if e.Size < packLimit {
+		f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return 0, err
+		}
+		//hide the file from RecvTo, packed data is read through Go buffers
+		n, err = udtgo.RecvTo(conn, struct{ io.Writer }{f}, e.Size)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	} else {
+		if err = os.Remove(part); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+		n, err = recvData(ctx, conn, part, 0, e.Size, r.Options)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	modTime := time.Unix(0, e.ModTime)
+	if err = os.Chmod(part, fs.FileMode(e.Mode)&fs.ModePerm); err != nil {
+		return n, err
+	}
+	if err = os.Chtimes(part, modTime, modTime); err != nil {
+		return n, err
+	}
+	return n, os.Rename(part, final)
+}
+
+//Creates symbolic links and sets permissions and modification times of directories,
+//deepest first so setting them on children does not change the parent.
+
+func finishDirs(m *manifest, paths []string) error {
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		if e.Type != entrySymlink {
+			continue
+		}
+		if target, err := os.Readlink(paths[i]); err == nil && target == e.Target {
+			continue
+		}
+		if fi, err := os.Lstat(paths[i]); err == nil {
+			if fi.IsDir() {
+				return fmt.Errorf("%s is a directory", paths[i])
+			}
+			if err = os.Remove(paths[i]); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(e.Target, paths[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		e := &m.Entries[i]
+		if e.Type != entryDir {
+			continue
+		}
+		modTime := time.Unix(0, e.ModTime)
+		if err := os.Chmod(paths[i], fs.FileMode(e.Mode)&fs.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Chtimes(paths[i], modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Creates a tree with many small files, a large file, an empty file, a symbolic link and
+//directories with various permissions and modification times.
+
+func TestSendDirThroughLink(t *testing.T) {
+	dir := t.TempDir()
+	serve(t, PORT9206, &Receiver{Dir: dir})
+	outside := t.TempDir()
+
+	//the first transfer creates a link out of the receiver directory
+	first := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(first, "a")); err != nil {
+		t.Fatalf("Unable to create link %s", err)
+	}
+	second := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(second, "a"), 0755); err != nil {
+		t.Fatalf("Unable to create directory %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(second, "a", "x"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+
+	c := dial(t, PORT9206)
+	defer c.Close()
+	if _, err := SendDir(context.Background(), c, first, "d", nil); err != nil {
+		t.Fatalf("Unable to send directory %s", err)
+	}
+
+	//later transfers neither go through the link by their id nor by their entries
+	if _, err := SendDir(context.Background(), c, second, "d/a/sub", nil); !errors.Is(err, ErrRejected) {
+		t.Errorf("Directory through link should be rejected got %v", err)
+	}
+	c2 := dial(t, PORT9206)
+	defer c2.Close()
+	if _, err := SendDir(context.Background(), c2, second, "d", nil); err == nil {
+		t.Errorf("Directory replacing link should fail")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Nothing should be written through the link %v", entries)
+	}
+}
+
+func writeTestTree(t *testing.T) string {
+	root := filepath.Join(t.TempDir(), "tree")
+	rnd := rand.New(rand.NewSource(1))
+	write := func(name string, size int, mode os.FileMode) {
+		data := make([]byte, size)
+		rnd.Read(data)
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Unable to create directory %s", err)
+		}
+		if err := os.WriteFile(p, data, mode); err != nil {
+			t.Fatalf("Unable to write file %s", err)
+		}
+	}
+	for i := 0; i < 300; i++ {
+		write(filepath.Join("small", strconv.Itoa(i/100), strconv.Itoa(i)+".txt"), rnd.Intn(8<<10), 0644)
+	}
+	write("large.bin", 3<<20+100, 0600)
+	write("empty", 0, 0640)
+	write("bin/run.sh", 100, 0755)
+	if err := os.Symlink("bin/run.sh", filepath.Join(root, "run")); err != nil {
+		t.Fatalf("Unable to create link %s", err)
+	}
+	if err := os.Chmod(filepath.Join(root, "bin"), 0750); err != nil {
+		t.Fatalf("Unable to change mode %s", err)
+	}
+
+	//set times last, creating entries changes times of directories
+	modTime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type()&fs.ModeSymlink == 0 {
+			err = os.Chtimes(p, modTime, modTime)
+		}
+		return err
+	})
+	return root
+}
+
+//Compares trees at a and b.
+
+func compareTrees(t *testing.T, a, b string) {
+	count := 0
+	err := filepath.WalkDir(a, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(a, p)
+		want, _ := d.Info()
+		got, err := os.Lstat(filepath.Join(b, rel))
+		if err != nil {
+			t.Errorf("Missing %s", rel)
+			return nil
+		}
+		count++
+		if got.Mode() != want.Mode() {
+			t.Errorf("Mode of %s should be %v got %v", rel, want.Mode(), got.Mode())
+		}
+		switch {
+		case want.Mode()&fs.ModeSymlink != 0:
+			wt, _ := os.Readlink(p)
+			gt, _ := os.Readlink(filepath.Join(b, rel))
+			if wt != gt {
+				t.Errorf("Link %s should point to %s got %s", rel, wt, gt)
+			}
+			return nil
+		case want.Mode().IsRegular():
+			wd, _ := os.ReadFile(p)
+			gd, _ := os.ReadFile(filepath.Join(b, rel))
+			if !bytes.Equal(wd, gd) {
+				t.Errorf("Content of %s differs", rel)
+			}
+		}
+		if !got.ModTime().Equal(want.ModTime()) {
+			t.Errorf("Modification time of %s should be %v got %v", rel, want.ModTime(), got.ModTime())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to compare trees %s", err)
+	}
+	if count < 300 {
+		t.Errorf("Too few entries compared %d", count)
+	}
+}
+
+func TestSendDir(t *testing.T) {
+	dir := t.TempDir()
+	serve(t, PORT9203, &Receiver{Dir: dir})
+	src := writeTestTree(t)
+
+	c := dial(t, PORT9203)
+	defer c.Close()
+	res, err := SendDir(context.Background(), c, src, "copy", nil)
+	if err != nil {
+		t.Fatalf("Unable to send directory %s", err)
+	}
+	if res.Files != 303 || res.Symlinks != 1 || res.Dirs != 6 || res.Skipped != 0 || res.Transferred != res.Size {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	compareTrees(t, src, filepath.Join(dir, "copy"))
+
+	//only the changed file is sent again
+	changed := filepath.Join(src, "small", "1", "150.txt")
+	if err = os.WriteFile(changed, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	res, err = SendDir(context.Background(), c, src, "copy", nil)
+	if err != nil {
+		t.Fatalf("Unable to send directory %s", err)
+	}
+	if res.Skipped != res.Files-1 || res.Transferred != int64(len("changed")) {
+		t.Errorf("Only the changed file should be sent %+v", res)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "copy", "small", "1", "150.txt")); string(got) != "changed" {
+		t.Errorf("Changed file was not received %q", got)
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, "copy", "*", ".*.part")); len(parts) != 0 {
+		t.Errorf("Temporary files should be removed %v", parts)
+	}
+}
+
+func TestSendDirRejected(t *testing.T) {
+	dir := t.TempDir()
+	serve(t, PORT9204, &Receiver{Dir: dir})
+	c := dial(t, PORT9204)
+	defer c.Close()
+
+	manifests := []*manifest{
+		{ID: "../up", Entries: []entry{{Type: entryDir, Path: "."}}},
+		{ID: "d", Entries: []entry{{Type: entryDir, Path: "."}, {Type: entryFile, Path: "../x"}}},
+		{ID: "d", Entries: []entry{{Type: entryDir, Path: "."}, {Type: entryFile, Path: "a/./x"}}},
+		//no file may be written through a link of the manifest
+		{ID: "d", Entries: []entry{
+			{Type: entryDir, Path: "."},
+			{Type: entrySymlink, Path: "a", Target: "/tmp"},
+			{Type: entryFile, Path: "a/x"},
+		}},
+		{ID: "d", Entries: []entry{{Type: entryFile, Path: "x"}}},
+	}
+	for _, m := range manifests {
+		w := bufio.NewWriter(c)
+		if err := writeManifest(w, m); err != nil {
+			t.Fatalf("Unable to write manifest %s", err)
+		}
+		w.Flush()
+		resp, err := readResponse(c)
+		if err != nil {
+			t.Fatalf("Unable to read response %s", err)
+		}
+		if err = resp.err(); !errors.Is(err, ErrRejected) {
+			t.Errorf("Manifest %+v should be rejected got %v", m, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Nothing should be created %v", entries)
+	}
+}
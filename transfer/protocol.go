@@ -0,0 +1,550 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//Wire protocol, all integers are big endian:
+//
+//	request  = magic "UDTF" | version uint8 | id length uint16 | id | size int64 | modtime int64 |
+//	           chunk size uint32
+//	response = status uint8 | offset int64 | message length uint16 | message
+//	digests  = count uint32 | count * SHA-256 digest of a chunk
+//	indexes  = count uint32 | count * index uint32
+//	final    = response | SHA-256 digest of the whole file
+//
+//The sender writes a request, the receiver replies with a response holding the offset it
+//already has. The sender then writes the file from that offset to the end followed by
+//digests of all chunks. The receiver hashes its copy and replies with indexes of chunks
+//which do not match, the sender writes data of those chunks in the listed order and the
+//receiver replies with a new list. Once the list is empty the receiver stores the file under
+//its final name and replies with final. Further requests may follow on the same connection.
+//
+//A directory is sent as a manifest instead of a request:
+//
+//	manifest = magic "UDTD" | version uint8 | id length uint16 | id | count uint32 | count * entry
+//	entry    = type uint8 | path length uint16 | path | mode uint32 | size int64 | modtime int64 |
+//	           target length uint16 | target
+//
+//Paths are slash separated and relative to the directory, target is the target of a symbolic
+//link. The receiver replies with a response followed by indexes of file entries it does not
+//have yet. The sender writes data of those files in the listed order, files smaller than
+//packLimit as one continuous stream. The receiver replies with a response once all files,
+//links and metadata are stored.
+//
+//A file striped over several connections starts with a striped request on the first one:
+//
+//	striped = magic "UDTS" | version uint8 | token [16]byte | stripes uint16 |
+//	          request without magic and version
+//	join    = magic "UDTJ" | version uint8 | token [16]byte
+//	range   = offset int64 | size int64
+//
+//After the response the sender writes join on each other connection. Every connection,
+//the first one included, then carries ranges each followed by size bytes of the file at
+//offset, a range with zero size ends the stripe. Once all stripes end, the file is verified
+//on the first connection as above.
+
+const (
+	magic       = "UDTF"
+	dirMagic    = "UDTD"
+	stripeMagic = "UDTS"
+	joinMagic   = "UDTJ"
+	version     = 1
+
+	maxIDLen      = 4096
+	maxMessageLen = 4096
+
+	minChunkSize = 64 << 10
+	maxChunkSize = 64 << 20
+
+	maxEntries = 1 << 24
+	maxStripes = 256
+)
+
+//Type of a manifest entry.
+
+const (
+	entryDir     = 0
+	entryFile    = 1
+	entrySymlink = 2
+)
+
+//Status of a response.
+
+const (
+	statusOK       = 0
+	statusRejected = 1
+	statusFailed   = 2
+)
+
+//ErrRejected is returned by the sender when the receiver refused the file.
+
+var ErrRejected = errors.New("transfer: file rejected by receiver")
+
+//ErrProtocol is returned when the peer sends malformed protocol messages.
+
+var ErrProtocol = errors.New("transfer: protocol error")
+
+type request struct {
+	ID        string
+	Size      int64
+	ModTime   int64 //unix nanoseconds
+	ChunkSize int   //size of hashed chunks
+}
+
+//Returns number of chunks of the file.
+
+func (req *request) chunks() int {
+	return int((req.Size + int64(req.ChunkSize) - 1) / int64(req.ChunkSize))
+}
+
+//Returns offset and size of chunk i.
+
+func (req *request) chunk(i int) (offset, size int64) {
+	offset = int64(i) * int64(req.ChunkSize)
+	size = req.Size - offset
+	if size > int64(req.ChunkSize) {
+		size = int64(req.ChunkSize)
+	}
+	return
+}
+
+type digest = [sha256.Size]byte
+
+type entry struct {
+	Type    uint8
+	Path    string //slash separated path relative to the directory, "." is the directory itself
+	Mode    uint32 //permission bits
+	Size    int64
+	ModTime int64  //unix nanoseconds
+	Target  string //target of a symbolic link
+}
+
+type manifest struct {
+	ID      string
+	Entries []entry
+}
+
+type response struct {
+	Status  uint8
+	Offset  int64
+	Message string
+}
+
+func writeRequest(w io.Writer, req *request) error {
+	if len(req.ID) == 0 || len(req.ID) > maxIDLen {
+		return fmt.Errorf("transfer: invalid file id length %d", len(req.ID))
+	}
+	b := make([]byte, 0, len(magic)+1+2+len(req.ID)+8+8+4)
+	b = append(b, magic...)
+	b = append(b, version)
+	_, err := w.Write(appendRequest(b, req))
+	return err
+}
+
+//Appends request without magic and version to b.
+
+func appendRequest(b []byte, req *request) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(req.ID)))
+	b = append(b, req.ID...)
+	b = binary.BigEndian.AppendUint64(b, uint64(req.Size))
+	b = binary.BigEndian.AppendUint64(b, uint64(req.ModTime))
+	return binary.BigEndian.AppendUint32(b, uint32(req.ChunkSize))
+}
+
+//Reads magic and version which start a request or manifest and returns the magic. Returns
+//io.EOF if the connection is closed before a new request starts.
+
+func readHeader(r io.Reader) (string, error) {
+	var hdr [len(magic) + 1]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", err
+	}
+	kind := string(hdr[:len(magic)])
+	if kind != magic && kind != dirMagic && kind != stripeMagic && kind != joinMagic {
+		return "", fmt.Errorf("%w: bad magic %q", ErrProtocol, kind)
+	}
+	if hdr[len(magic)] != version {
+		return "", fmt.Errorf("%w: unsupported version %d", ErrProtocol, hdr[len(magic)])
+	}
+	return kind, nil
+}
+
+//Reads a string with uint16 length of at most max bytes. Empty strings are accepted if
+//empty is true.
+
+func readString(r io.Reader, max int, empty bool, what string) (string, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if (n == 0 && !empty) || n > max {
+		return "", fmt.Errorf("%w: invalid %s length %d", ErrProtocol, what, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	return string(b), nil
+}
+
+//Reads a request following the header.
+
+func readRequest(r io.Reader) (*request, error) {
+	id, err := readString(r, maxIDLen, false, "file id")
+	if err != nil {
+		return nil, err
+	}
+	var b [20]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	req := &request{
+		ID:        id,
+		Size:      int64(binary.BigEndian.Uint64(b[:])),
+		ModTime:   int64(binary.BigEndian.Uint64(b[8:])),
+		ChunkSize: int(binary.BigEndian.Uint32(b[16:])),
+	}
+	if req.Size < 0 {
+		return nil, fmt.Errorf("%w: negative file size %d", ErrProtocol, req.Size)
+	}
+	if req.ChunkSize < minChunkSize || req.ChunkSize > maxChunkSize {
+		return nil, fmt.Errorf("%w: chunk size %d", ErrProtocol, req.ChunkSize)
+	}
+	return req, nil
+}
+
+//Reads a striped request following the header.
+
+func readStripedRequest(r io.Reader) (token [16]byte, stripes int, req *request, err error) {
+	var b [18]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return token, 0, nil, unexpectedEOF(err)
+	}
+	copy(token[:], b[:])
+	if stripes = int(binary.BigEndian.Uint16(b[16:])); stripes == 0 || stripes > maxStripes {
+		return token, 0, nil, fmt.Errorf("%w: %d stripes", ErrProtocol, stripes)
+	}
+	req, err = readRequest(r)
+	return token, stripes, req, err
+}
+
+func writeStripedRequest(w io.Writer, token [16]byte, stripes int, req *request) error {
+	if len(req.ID) == 0 || len(req.ID) > maxIDLen {
+		return fmt.Errorf("transfer: invalid file id length %d", len(req.ID))
+	}
+	b := make([]byte, 0, len(stripeMagic)+1+16+2+2+len(req.ID)+8+8+4)
+	b = append(b, stripeMagic...)
+	b = append(b, version)
+	b = append(b, token[:]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(stripes))
+	_, err := w.Write(appendRequest(b, req))
+	return err
+}
+
+func writeJoin(w io.Writer, token [16]byte) error {
+	b := make([]byte, 0, len(joinMagic)+1+16)
+	b = append(b, joinMagic...)
+	b = append(b, version)
+	_, err := w.Write(append(b, token[:]...))
+	return err
+}
+
+func readJoin(r io.Reader) (token [16]byte, err error) {
+	if _, err = io.ReadFull(r, token[:]); err != nil {
+		err = unexpectedEOF(err)
+	}
+	return
+}
+
+func writeRange(w io.Writer, offset, size int64) error {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:], uint64(offset))
+	binary.BigEndian.PutUint64(b[8:], uint64(size))
+	_, err := w.Write(b[:])
+	return err
+}
+
+//Reads a range, which must be inside a file of fileSize bytes.
+
+func readRange(r io.Reader, fileSize int64) (offset, size int64, err error) {
+	var b [16]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return 0, 0, unexpectedEOF(err)
+	}
+	offset = int64(binary.BigEndian.Uint64(b[:]))
+	size = int64(binary.BigEndian.Uint64(b[8:]))
+	if offset < 0 || size < 0 || offset > fileSize || size > fileSize-offset {
+		return 0, 0, fmt.Errorf("%w: range %d+%d of %d bytes", ErrProtocol, offset, size, fileSize)
+	}
+	return offset, size, nil
+}
+
+//Writes the manifest to w, which should be buffered.
+
+func writeManifest(w io.Writer, m *manifest) error {
+	if len(m.ID) == 0 || len(m.ID) > maxIDLen {
+		return fmt.Errorf("transfer: invalid directory id length %d", len(m.ID))
+	}
+	if len(m.Entries) > maxEntries {
+		return fmt.Errorf("transfer: too many directory entries %d", len(m.Entries))
+	}
+	b := make([]byte, 0, 4096)
+	b = append(b, dirMagic...)
+	b = append(b, version)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(m.ID)))
+	b = append(b, m.ID...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Entries)))
+	for i := range m.Entries {
+		e := &m.Entries[i]
+		if len(e.Path) == 0 || len(e.Path) > maxIDLen || len(e.Target) > maxIDLen {
+			return fmt.Errorf("transfer: path %q too long", e.Path)
+		}
+		b = append(b, e.Type)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(e.Path)))
+		b = append(b, e.Path...)
+		b = binary.BigEndian.AppendUint32(b, e.Mode)
+		b = binary.BigEndian.AppendUint64(b, uint64(e.Size))
+		b = binary.BigEndian.AppendUint64(b, uint64(e.ModTime))
+		b = binary.BigEndian.AppendUint16(b, uint16(len(e.Target)))
+		b = append(b, e.Target...)
+		if len(b) >= 4096 {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			b = b[:0]
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+//Reads a manifest following the header.
+
+func readManifest(r io.Reader) (*manifest, error) {
+	id, err := readString(r, maxIDLen, false, "directory id")
+	if err != nil {
+		return nil, err
+	}
+	var hdr [4]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	count := int(binary.BigEndian.Uint32(hdr[:]))
+	if count > maxEntries {
+		return nil, fmt.Errorf("%w: %d directory entries", ErrProtocol, count)
+	}
+
+	m := &manifest{ID: id, Entries: make([]entry, 0, min(count, 1<<16))}
+	for len(m.Entries) < count {
+		var e entry
+		var t [1]byte
+		if _, err = io.ReadFull(r, t[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if e.Type = t[0]; e.Type > entrySymlink {
+			return nil, fmt.Errorf("%w: entry type %d", ErrProtocol, e.Type)
+		}
+		if e.Path, err = readString(r, maxIDLen, false, "path"); err != nil {
+			return nil, err
+		}
+		var b [20]byte
+		if _, err = io.ReadFull(r, b[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		e.Mode = binary.BigEndian.Uint32(b[:])
+		e.Size = int64(binary.BigEndian.Uint64(b[4:]))
+		e.ModTime = int64(binary.BigEndian.Uint64(b[12:]))
+		if e.Size < 0 {
+			return nil, fmt.Errorf("%w: negative file size %d", ErrProtocol, e.Size)
+		}
+		if e.Target, err = readString(r, maxIDLen, e.Type != entrySymlink, "link target"); err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	return m, nil
+}
+
+func writeResponse(w io.Writer, resp *response) error {
+	msg := resp.Message
+	if len(msg) > maxMessageLen {
+		msg = msg[:maxMessageLen]
+	}
+	b := make([]byte, 0, 1+8+2+len(msg))
+	b = append(b, resp.Status)
+	b = binary.BigEndian.AppendUint64(b, uint64(resp.Offset))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(msg)))
+	b = append(b, msg...)
+	_, err := w.Write(b)
+	return err
+}
+
+func readResponse(r io.Reader) (*response, error) {
+	var hdr [1 + 8 + 2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	resp := &response{
+		Status: hdr[0],
+		Offset: int64(binary.BigEndian.Uint64(hdr[1:])),
+	}
+	msgLen := int(binary.BigEndian.Uint16(hdr[9:]))
+	if msgLen > maxMessageLen {
+		return nil, fmt.Errorf("%w: message length %d", ErrProtocol, msgLen)
+	}
+	if msgLen > 0 {
+		b := make([]byte, msgLen)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		resp.Message = string(b)
+	}
+	return resp, nil
+}
+
+func writeDigests(w io.Writer, digests []digest) error {
+	b := make([]byte, 0, 4+len(digests)*sha256.Size)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(digests)))
+	for i := range digests {
+		b = append(b, digests[i][:]...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+//Reads digests of exactly count chunks.
+
+func readDigests(r io.Reader, count int) ([]digest, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if n := int(binary.BigEndian.Uint32(hdr[:])); n != count {
+		return nil, fmt.Errorf("%w: %d digests for %d chunks", ErrProtocol, n, count)
+	}
+	//count comes from the announced file size, grow with data actually received
+	digests := make([]digest, 0, min(count, 1<<16))
+	for len(digests) < count {
+		var d digest
+		if _, err := io.ReadFull(r, d[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
+
+func writeIndexes(w io.Writer, indexes []int) error {
+	b := make([]byte, 0, 4+len(indexes)*4)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(indexes)))
+	for _, i := range indexes {
+		b = binary.BigEndian.AppendUint32(b, uint32(i))
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+//Reads indexes of chunks or manifest entries, all of them must be lower than count.
+
+func readIndexes(r io.Reader, count int) ([]int, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	n := int(binary.BigEndian.Uint32(hdr[:]))
+	if n > count {
+		return nil, fmt.Errorf("%w: %d indexes for %d items", ErrProtocol, n, count)
+	}
+	b := make([]byte, n*4)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	indexes := make([]int, n)
+	for i := range indexes {
+		if indexes[i] = int(binary.BigEndian.Uint32(b[i*4:])); indexes[i] >= count {
+			return nil, fmt.Errorf("%w: index %d of %d items", ErrProtocol, indexes[i], count)
+		}
+	}
+	return indexes, nil
+}
+
+func writeFinal(w io.Writer, resp *response, sum digest) error {
+	if err := writeResponse(w, resp); err != nil {
+		return err
+	}
+	_, err := w.Write(sum[:])
+	return err
+}
+
+func readFinal(r io.Reader) (*response, digest, error) {
+	var sum digest
+	resp, err := readResponse(r)
+	if err != nil {
+		return nil, sum, err
+	}
+	if _, err = io.ReadFull(r, sum[:]); err != nil {
+		return nil, sum, unexpectedEOF(err)
+	}
+	return resp, sum, nil
+}
+
+//Converts error of the response into Go error.
+
+func (resp *response) err() error {
+	switch resp.Status {
+	case statusOK:
+		return nil
+	case statusRejected:
+		return fmt.Errorf("%w: %s", ErrRejected, resp.Message)
+	case statusFailed:
+		return fmt.Errorf("transfer: receiver failed: %s", resp.Message)
+	}
+	return fmt.Errorf("%w: unknown status %d", ErrProtocol, resp.Status)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,473 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kambeena/udtgo"
+)
+
+//A striped file is sent in ranges of minRange to maxRange bytes, about remaining bytes
+//divided by rangeDivisor times number of stripes. A stripe takes the next range once it
+//sent the previous one, so faster stripes send more ranges, and ranges get smaller towards
+//the end of the file so stripes finish at about the same time.
+
+const (
+	minRange     = 1 << 20
+	maxRange     = 64 << 20
+	rangeDivisor = 4
+)
+
+//Time the receiver waits for all connections of a striped file to join.
+
+const stripeJoinTimeout = 30 * time.Second
+
+//Result of one connection of a striped transfer.
+
+type StripeResult struct {
+	Transferred int64            //bytes of the file sent on the connection
+	Ranges      int              //ranges sent on the connection
+	Stats       udtgo.StatsDelta //UDT counters of the connection during the data transfer
+}
+
+//Result of a striped file transfer.
+
+type StripedResult struct {
+	Result
+	Stripes []StripeResult   //results of connections in the order they were passed
+	Stats   udtgo.StatsDelta //UDT counters of all connections during the data transfer
+}
+
+//Sends the file at path under id striped over conns, which must be connected to the same
+//receiver serving each of them with Serve. Ranges of the file are sent on all connections
+//in parallel by UDT sendfile and the receiver writes each of them at its offset. The file is
+//verified like by SendFile on the first connection, which carries the request as well.
+//
+//The receiver does not resume striped files, data it has from an interrupted transfer is
+//only used to skip a complete file. OnProgress of opts is called from a separate goroutine
+//with data transferred on all connections, Offset of the progress is not set. Cancelling
+//ctx or a failure of any stripe closes all connections, since UDT sendfile is only
+//interrupted by Close.
+
+func SendFileStriped(ctx context.Context, conns []*udtgo.Conn, path, id string, opts *udtgo.FileTransferOptions) (*StripedResult, error) {
+	if len(conns) == 0 || len(conns) > maxStripes {
+		return nil, fmt.Errorf("transfer: %d connections, 1 to %d supported", len(conns), maxStripes)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("transfer: %s is not a regular file", path)
+	}
+	res := &StripedResult{
+		Result:  Result{FileInfo: FileInfo{ID: id, Size: fi.Size(), ModTime: fi.ModTime()}},
+		Stripes: make([]StripeResult, len(conns)),
+	}
+
+	var token [16]byte
+	if _, err = rand.Read(token[:]); err != nil {
+		return res, err
+	}
+	req := &request{ID: id, Size: res.Size, ModTime: res.ModTime.UnixNano(), ChunkSize: ChunkSize}
+	if err = writeStripedRequest(conns[0], token, len(conns), req); err != nil {
+		return res, err
+	}
+	resp, err := readResponse(conns[0])
+	if err != nil {
+		return res, err
+	}
+	if err = resp.err(); err != nil {
+		return res, err
+	}
+	if resp.Offset != 0 && resp.Offset != res.Size {
+		return res, fmt.Errorf("%w: offset %d of striped file", ErrProtocol, resp.Offset)
+	}
+	res.Offset = resp.Offset
+
+	if res.Offset < res.Size {
+		if err = sendStripes(ctx, conns, path, token, res, opts); err != nil {
+			return res, err
+		}
+	}
+	return res, verifySent(ctx, conns[0], path, req, &res.Result)
+}
+
+//Hands out ranges of the file to stripes.
+
+type rangeQueue struct {
+	mu      sync.Mutex
+	next    int64
+	size    int64
+	stripes int
+}
+
+//Returns the next range, size is zero when the whole file was taken.
+
+func (q *rangeQueue) take() (offset, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	remaining := q.size - q.next
+	size = min(max(remaining/int64(q.stripes*rangeDivisor), minRange), maxRange, remaining)
+	offset = q.next
+	q.next += size
+	return offset, size
+}
+
+//Sends the file on all connections. Returns error of the first stripe which failed.
+
+func sendStripes(ctx context.Context, conns []*udtgo.Conn, path string, token [16]byte,
+	res *StripedResult, opts *udtgo.FileTransferOptions) error {
+	for _, c := range conns[1:] {
+		if err := writeJoin(c, token); err != nil {
+			return err
+		}
+	}
+	before := make([]udtgo.Stats, len(conns))
+	for i, c := range conns {
+		before[i], _ = c.Socket().Stats(false)
+	}
+
+	stripeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(stripeCtx, func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	defer stop()
+
+	q := &rangeQueue{size: res.Size, stripes: len(conns)}
+	var done atomic.Int64
+	stopProgress := reportProgress(conns, -1, res.Size, &done, opts)
+	errs := make([]error, len(conns))
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if errs[i] = sendStripe(conns[i], path, q, &res.Stripes[i], &done); errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	stopProgress()
+
+	for i, c := range conns {
+		if after, err := c.Socket().Stats(false); err == nil {
+			res.Stripes[i].Stats = after.Delta(&before[i])
+			res.Stats = res.Stats.Add(res.Stripes[i].Stats)
+		}
+		res.Transferred += res.Stripes[i].Transferred
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	//other stripes fail with net.ErrClosed after the first failure closed the connections
+	var first error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+//Sends ranges taken from q on conn until the file is done.
+
+func sendStripe(conn *udtgo.Conn, path string, q *rangeQueue, sr *StripeResult, done *atomic.Int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		offset, size := q.take()
+		if err = writeRange(conn, offset, size); err != nil || size == 0 {
+			return err
+		}
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		n, err := udtgo.SendFrom(conn, f, size)
+		sr.Transferred += n
+		done.Add(n)
+		if err != nil {
+			return err
+		}
+		sr.Ranges++
+	}
+}
+
+//Calls OnProgress of opts every Interval with data sent on all connections until the
+//returned function is called, which reports the final progress. Offset of the progress is
+//offset plus data sent, it is not set if offset is negative.
+
+func reportProgress(conns []*udtgo.Conn, offset, total int64, done *atomic.Int64, opts *udtgo.FileTransferOptions) (stop func()) {
+	if opts == nil || opts.OnProgress == nil {
+		return func() {}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	var p udtgo.Progress
+	p.Total = total
+	last := time.Now()
+	report := func() {
+		now := time.Now()
+		n := done.Load()
+		if elapsed := now.Sub(last); elapsed > 0 {
+			p.Rate = float64(n-p.Done) / elapsed.Seconds()
+		}
+		p.Done = n
+		if offset >= 0 {
+			p.Offset = offset + n
+		}
+		p.Bandwidth = 0
+		for _, c := range conns {
+			if stats, err := c.Socket().Stats(false); err == nil {
+				p.Bandwidth += stats.BandwidthMbps * 1e6 / 8
+			}
+		}
+		p.ETA = 0
+		if remaining := total - n; remaining > 0 && p.Rate > 0 {
+			p.ETA = time.Duration(float64(remaining) / p.Rate * float64(time.Second))
+		}
+		last = now
+		opts.OnProgress(p)
+	}
+
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				report()
+			case <-quit:
+				report()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-finished
+	}
+}
+
+//Striped file being received, shared by its connections.
+
+type stripeSet struct {
+	req    *request
+	part   string
+	count  int            //number of stripes including the first connection
+	joined int            //stripes joined besides the first connection, guarded by Receiver.mu
+	done   chan stripeEnd //results of joined stripes
+}
+
+type stripeEnd struct {
+	n   int64
+	err error
+}
+
+//Receives a striped file after the striped request header.
+
+func (r *Receiver) receiveStriped(ctx context.Context, conn *udtgo.Conn) (*Result, error) {
+	token, count, req, err := readStripedRequest(conn)
+	if err != nil {
+		return nil, err
+	}
+	res, final, err := r.open(conn, req)
+	if err != nil {
+		return res, err
+	}
+
+	//ranges arrive in any order, so data of an interrupted transfer is kept and verified
+	target := final
+	if !isComplete(final, req) {
+		res.Offset = 0
+		target = partPath(final, req)
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE, 0644); err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			writeResponse(conn, &response{Status: statusFailed, Message: err.Error()})
+			return res, err
+		}
+	}
+
+	var set *stripeSet
+	if target != final {
+		set = &stripeSet{req: req, part: target, count: count, done: make(chan stripeEnd, count)}
+		r.mu.Lock()
+		if r.stripes == nil {
+			r.stripes = make(map[[16]byte]*stripeSet)
+		}
+		r.stripes[token] = set
+		r.mu.Unlock()
+		defer func() {
+			r.mu.Lock()
+			delete(r.stripes, token)
+			r.mu.Unlock()
+		}()
+	}
+
+	if err = writeResponse(conn, &response{Status: statusOK, Offset: res.Offset}); err != nil {
+		return res, err
+	}
+	if set != nil {
+		if res.Transferred, err = r.recvStripes(ctx, conn, set); err != nil {
+			return res, err
+		}
+	}
+	return res, r.finish(ctx, conn, final, target, req, res)
+}
+
+//Receives the stripe of the first connection and waits for the other stripes to end.
+
+func (r *Receiver) recvStripes(ctx context.Context, conn *udtgo.Conn, set *stripeSet) (int64, error) {
+	n, err := recvStripe(ctx, conn, set)
+	if err != nil {
+		return n, err
+	}
+
+	timer := time.NewTimer(stripeJoinTimeout)
+	defer timer.Stop()
+	for pending := set.count - 1; pending > 0; {
+		select {
+		case end := <-set.done:
+			n += end.n
+			if end.err != nil {
+				return n, end.err
+			}
+			pending--
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-timer.C:
+			r.mu.Lock()
+			joined := set.joined
+			r.mu.Unlock()
+			if joined < set.count-1 {
+				return n, fmt.Errorf("transfer: %d of %d stripes of %s joined", joined+1, set.count, set.req.ID)
+			}
+		}
+	}
+	return n, nil
+}
+
+//Joins a connection to a striped file after the join header and receives its stripe.
+
+func (r *Receiver) joinStripe(ctx context.Context, conn *udtgo.Conn) error {
+	token, err := readJoin(conn)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	set := r.stripes[token]
+	ok := set != nil && set.joined < set.count-1
+	if ok {
+		set.joined++
+	}
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: unknown striped file", ErrProtocol)
+	}
+
+	n, err := recvStripe(ctx, conn, set)
+	set.done <- stripeEnd{n, err}
+	return err
+}
+
+//Receives ranges of the file on conn until a range with zero size ends the stripe.
+
+func recvStripe(ctx context.Context, conn *udtgo.Conn, set *stripeSet) (n int64, err error) {
+	f, err := os.OpenFile(set.part, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	//UDT recvfile is only interrupted by closing the connection
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		offset, size, err := readRange(conn, set.req.Size)
+		if err != nil || size == 0 {
+			return n, stripeError(ctx, err)
+		}
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return n, err
+		}
+		m, err := udtgo.RecvTo(conn, f, size)
+		n += m
+		if err != nil {
+			return n, stripeError(ctx, err)
+		}
+	}
+}
+
+func stripeError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kambeena/udtgo"
+)
+
+func TestSendFileStriped(t *testing.T) {
+	dir := t.TempDir()
+	serve(t, PORT9205, &Receiver{Dir: dir})
+	src, data := writeTestFile(t, 20<<20+1234)
+
+	conns := make([]*udtgo.Conn, 3)
+	for i := range conns {
+		conns[i] = dial(t, PORT9205)
+		defer conns[i].Close()
+	}
+
+	var last udtgo.Progress
+	opts := &udtgo.FileTransferOptions{
+		Interval:   50 * time.Millisecond,
+		OnProgress: func(p udtgo.Progress) { last = p },
+	}
+	res, err := SendFileStriped(context.Background(), conns, src, "striped.bin", opts)
+	if err != nil {
+		t.Fatalf("Unable to send file %s", err)
+	}
+	var sum int64
+	for i, s := range res.Stripes {
+		if s.Ranges == 0 || s.Stats.PktSent == 0 {
+			t.Errorf("Stripe %d should send data %+v", i, s)
+		}
+		sum += s.Transferred
+	}
+	if sum != int64(len(data)) || res.Transferred != sum {
+		t.Errorf("Stripes should send the whole file once %+v", res)
+	}
+	if res.Stats.PktSent < res.Stripes[0].Stats.PktSent+res.Stripes[1].Stats.PktSent {
+		t.Errorf("Stats should be aggregated %+v", res.Stats)
+	}
+	if last.Done != int64(len(data)) || last.Total != int64(len(data)) {
+		t.Errorf("Final progress should report the whole file %+v", last)
+	}
+	if res.Digest != sha256.Sum256(data) {
+		t.Errorf("Unexpected digest %x", res.Digest)
+	}
+	final := filepath.Join(dir, "striped.bin")
+	if got, _ := os.ReadFile(final); !bytes.Equal(got, data) {
+		t.Fatalf("Received file differs from sent file")
+	}
+
+	//connections stay usable and the complete file is not sent again
+	res, err = SendFileStriped(context.Background(), conns, src, "striped.bin", nil)
+	if err != nil || res.Offset != int64(len(data)) || res.Transferred != 0 {
+		t.Errorf("Complete file should not be sent again %+v %v", res, err)
+	}
+}
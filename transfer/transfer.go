@@ -0,0 +1,430 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+// Package transfer implements resumable file transfer over UDT stream connections.
+//
+// The sender announces file ID, size and modification time, the receiver replies with the
+// number of bytes it already has from an interrupted transfer of the same file and the
+// sender continues from that offset. The receiver keeps partial data in a temporary file
+// next to the destination and renames it to the final name once the file is complete.
+//
+// Both sides hash the file in chunks of ChunkSize bytes with SHA-256. The receiver compares
+// digests of its copy, including data received before an interruption, with digests of the
+// sender and only mismatched chunks are transferred again. Both sides return SHA-256 digest
+// of the whole file.
+//
+// SendDir sends a directory tree. A manifest of all directories, files and symbolic links
+// with their sizes, permissions and modification times is sent first, then data of files
+// the receiver does not have yet. Small files are packed into one continuous stream, large
+// files are sent by UDT sendfile. Receiver recreates the tree under its directory.
+//
+// SendFileStriped sends one file over several connections in parallel, each taking the next
+// range of the file when it finished the previous one, so slower connections send less.
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kambeena/udtgo"
+)
+
+//FileInfo describes a file announced by the sender.
+
+type FileInfo struct {
+	ID      string    //slash separated path relative to the receiver directory
+	Size    int64     //size in bytes
+	ModTime time.Time //modification time, set on the received file
+}
+
+//Result of a file transfer.
+
+type Result struct {
+	FileInfo
+	Offset      int64             //offset the transfer continued from, bytes before it were already received
+	Transferred int64             //bytes transferred over the connection, without repaired chunks
+	Repaired    int               //chunks transferred again because their digests differed
+	Digest      [sha256.Size]byte //SHA-256 digest of the whole file, verified by both sides
+}
+
+//Sends the file at path under id. If the receiver has part of the same file (same id, size
+//and modification time) from an interrupted transfer, only the rest is sent. SendFile returns
+//after the receiver stored the complete file. opts configure progress reporting of the data
+//transfer and may be nil.
+//
+//File data is sent by UDT sendfile from the offset the receiver returned. Cancelling ctx
+//closes the connection, since UDT sendfile is only interrupted by Close. After any other
+//failure the connection must be closed too, the peers no longer agree where the file data
+//ends.
+
+func SendFile(ctx context.Context, conn *udtgo.Conn, path, id string, opts *udtgo.FileTransferOptions) (*Result, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("transfer: %s is not a regular file", path)
+	}
+	res := &Result{FileInfo: FileInfo{ID: id, Size: fi.Size(), ModTime: fi.ModTime()}}
+
+	req := &request{ID: id, Size: res.Size, ModTime: res.ModTime.UnixNano(), ChunkSize: ChunkSize}
+	if err = writeRequest(conn, req); err != nil {
+		return res, err
+	}
+	resp, err := readResponse(conn)
+	if err != nil {
+		return res, err
+	}
+	if err = resp.err(); err != nil {
+		return res, err
+	}
+	if resp.Offset < 0 || resp.Offset > res.Size {
+		return res, fmt.Errorf("%w: offset %d outside of file size %d", ErrProtocol, resp.Offset, res.Size)
+	}
+	res.Offset = resp.Offset
+
+	res.Transferred, err = sendData(ctx, conn, path, res.Offset, res.Size-res.Offset, opts)
+	if err != nil {
+		return res, err
+	}
+	return res, verifySent(ctx, conn, path, req, res)
+}
+
+//File data on a single connection is sent by UDT sendfile and received by UDT recvfile in
+//ranges of dataRange bytes, progress is reported between them.
+
+const dataRange = 1 << 20
+
+//Sends size bytes of the file at path from offset by UDT sendfile. Cancelling ctx closes
+//conn.
+
+func sendData(ctx context.Context, conn *udtgo.Conn, path string, offset, size int64, opts *udtgo.FileTransferOptions) (n int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	var done atomic.Int64
+	stopProgress := reportProgress([]*udtgo.Conn{conn}, offset, size, &done, opts)
+	defer stopProgress()
+
+	for n < size {
+		m, err := udtgo.SendFrom(conn, f, min(size-n, dataRange))
+		n += m
+		done.Add(m)
+		if err != nil {
+			return n, stripeError(ctx, err)
+		}
+	}
+	return n, nil
+}
+
+//Receives size bytes into the file at path from offset by UDT recvfile, the counterpart of
+//sendData. Data written before a failure stays in the file.
+
+func recvData(ctx context.Context, conn *udtgo.Conn, path string, offset, size int64, opts *udtgo.FileTransferOptions) (n int64, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	var done atomic.Int64
+	stopProgress := reportProgress([]*udtgo.Conn{conn}, offset, size, &done, opts)
+	defer stopProgress()
+
+	for n < size {
+		m, err := udtgo.RecvTo(conn, f, min(size-n, dataRange))
+		n += m
+		done.Add(m)
+		if err != nil {
+			return n, stripeError(ctx, err)
+		}
+	}
+	return n, nil
+}
+
+//Receiver stores files sent by SendFile in a directory.
+
+type Receiver struct {
+	Dir     string                     //directory where files are stored
+	Options *udtgo.FileTransferOptions //progress reporting of data transfer, may be nil
+
+	//Accept is called before a file is received, returned error rejects the file and its
+	//message is sent to the sender. Nil Accept accepts all files.
+	Accept func(info FileInfo) error
+
+	mu      sync.Mutex
+	stripes map[[16]byte]*stripeSet //striped files being received by token
+}
+
+//Receives one file. Returns io.EOF if the peer closed the connection instead of sending
+//another file. Partial data of a failed transfer is kept for resumption, the connection
+//must be closed after any other error.
+
+func (r *Receiver) Receive(ctx context.Context, conn *udtgo.Conn) (*Result, error) {
+	kind, err := readHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	if kind != magic {
+		return nil, fmt.Errorf("%w: expected file request got %q", ErrProtocol, kind)
+	}
+	return r.receive(ctx, conn)
+}
+
+//Receives a file after the request header.
+
+func (r *Receiver) receive(ctx context.Context, conn *udtgo.Conn) (*Result, error) {
+	req, err := readRequest(conn)
+	if err != nil {
+		return nil, err
+	}
+	res, final, err := r.open(conn, req)
+	if err != nil {
+		return res, err
+	}
+	if err = writeResponse(conn, &response{Status: statusOK, Offset: res.Offset}); err != nil {
+		return res, err
+	}
+	//data of a complete file received before is verified in place
+	target := final
+	if !isComplete(final, req) {
+		target = partPath(final, req)
+		res.Transferred, err = recvData(ctx, conn, target, res.Offset, req.Size-res.Offset, r.Options)
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, r.finish(ctx, conn, final, target, req, res)
+}
+
+//Checks the requested file and prepares its destination. Returns result with the offset
+//the transfer continues from and the final path. Errors are sent to the sender.
+
+func (r *Receiver) open(conn *udtgo.Conn, req *request) (res *Result, final string, err error) {
+	res = &Result{FileInfo: FileInfo{ID: req.ID, Size: req.Size, ModTime: time.Unix(0, req.ModTime)}}
+
+	final, err = r.path(req.ID)
+	if err == nil && r.Accept != nil {
+		err = r.Accept(res.FileInfo)
+	}
+	if err != nil {
+		writeResponse(conn, &response{Status: statusRejected, Message: err.Error()})
+		return res, "", fmt.Errorf("%w: %s", ErrRejected, err)
+	}
+
+	if res.Offset, err = r.prepare(final, req); err != nil {
+		writeResponse(conn, &response{Status: statusFailed, Message: err.Error()})
+		return res, "", err
+	}
+	return res, final, nil
+}
+
+//Verifies received data in target and stores it as final, then sends final response.
+
+func (r *Receiver) finish(ctx context.Context, conn *udtgo.Conn, final, target string, req *request, res *Result) (err error) {
+	if testHookReceived != nil {
+		testHookReceived(target)
+	}
+
+	if res.Digest, res.Repaired, err = r.verify(ctx, conn, target, req); err != nil {
+		return err
+	}
+	if target != final {
+		err = commit(target, final, res.ModTime)
+	} else if res.Repaired > 0 {
+		err = os.Chtimes(final, res.ModTime, res.ModTime)
+	}
+	if err != nil {
+		writeFinal(conn, &response{Status: statusFailed, Message: err.Error()}, digest{})
+		return err
+	}
+	return writeFinal(conn, &response{Status: statusOK, Offset: req.Size}, res.Digest)
+}
+
+//Receives files and directories until the peer closes the connection or an error occurs.
+//Rejected files do not stop Serve.
+
+func (r *Receiver) Serve(ctx context.Context, conn *udtgo.Conn) error {
+	for {
+		kind, err := readHeader(conn)
+		switch {
+		case err != nil:
+		case kind == magic:
+			_, err = r.receive(ctx, conn)
+		case kind == dirMagic:
+			_, err = r.receiveDir(ctx, conn)
+		case kind == stripeMagic:
+			_, err = r.receiveStriped(ctx, conn)
+		case kind == joinMagic:
+			err = r.joinStripe(ctx, conn)
+		}
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil && !errors.Is(err, ErrRejected):
+			return err
+		}
+	}
+}
+
+//Returns destination path of the file id, which must be a local slash separated path.
+//Directories on the way which already exist must not be symbolic links, a link received
+//before would lead the file outside of Dir.
+
+func (r *Receiver) path(id string) (string, error) {
+	name := filepath.FromSlash(id)
+	if strings.ContainsRune(id, '\\') || !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid file id %q", id)
+	}
+	dir := r.Dir
+	for _, elem := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if elem == "." {
+			break
+		}
+		dir = filepath.Join(dir, elem)
+		fi, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", fmt.Errorf("invalid file id %q, %s is not a directory", id, dir)
+		}
+	}
+	return filepath.Join(r.Dir, name), nil
+}
+
+//Returns offset the transfer continues from. Partial files of other versions of the file
+//are removed.
+
+func (r *Receiver) prepare(final string, req *request) (int64, error) {
+	if isComplete(final, req) {
+		return req.Size, nil
+	}
+	dir := filepath.Dir(final)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+
+	part := partPath(final, req)
+	prefix, suffix := "."+filepath.Base(final)+".", ".part"
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) && name != filepath.Base(part) {
+				os.Remove(filepath.Join(dir, name))
+			}
+		}
+	}
+
+	fi, err := os.Stat(part)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	case fi.Size() > req.Size:
+		//cannot be a prefix of the file, start again
+		return 0, os.Truncate(part, 0)
+	}
+	return fi.Size(), nil
+}
+
+//Reports whether the destination already holds the announced version of the file.
+
+func isComplete(final string, req *request) bool {
+	fi, err := os.Lstat(final)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() == req.Size && fi.ModTime().Equal(time.Unix(0, req.ModTime))
+}
+
+//Temporary file of partial data. Its name depends on size and modification time, so a
+//changed file is not resumed from data of the previous version.
+
+func partPath(final string, req *request) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:], uint64(req.Size))
+	binary.BigEndian.PutUint64(b[8:], uint64(req.ModTime))
+	sum := sha256.Sum256(append([]byte(req.ID), b[:]...))
+	return filepath.Join(filepath.Dir(final), "."+filepath.Base(final)+"."+hex.EncodeToString(sum[:8])+".part")
+}
+
+//Flushes the complete temporary file and renames it to the final name.
+
+func commit(part, final string, modTime time.Time) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(part, modTime, modTime); err != nil {
+		return err
+	}
+	return os.Rename(part, final)
+}
@@ -0,0 +1,231 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kambeena/udtgo"
+)
+
+//Ports of the udtgo package tests start at 9000.
+
+const (
+	PORT9200 = 9200 + iota
+	PORT9201
+	PORT9202
+	PORT9203
+	PORT9204
+	PORT9205
+	PORT9206
+)
+
+func TestMain(m *testing.M) {
+	udtgo.Startup()
+	code := m.Run()
+	udtgo.Cleanup()
+	os.Exit(code)
+}
+
+//Connects to the receiver with a small sending buffer and limited bandwidth, so
+//a transfer takes long enough to be interrupted.
+
+func dial(t *testing.T, port int) *udtgo.Conn {
+	s, err := udtgo.CreateSocket("ip4", true, udtgo.WithSendBuffer(256<<10), udtgo.WithMaxBandwidth(16<<20))
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	if _, err = udtgo.Connect(s, "localhost", port); err != nil {
+		t.Fatalf("Unable to connect %s", err)
+	}
+	return udtgo.NewConn(s)
+}
+
+//Serves receiver on port, errors of connections are delivered on the returned channel.
+
+func serve(t *testing.T, port int, r *Receiver) chan error {
+	l, err := udtgo.NewListener("udt4", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatalf("Unable to listen %s", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	errs := make(chan error, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				errs <- r.Serve(context.Background(), c.(*udtgo.Conn))
+			}()
+		}
+	}()
+	return errs
+}
+
+func writeTestFile(t *testing.T, size int) (string, []byte) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	path := filepath.Join(t.TempDir(), "src.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Unable to write file %s", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Unable to set file time %s", err)
+	}
+	return path, data
+}
+
+func TestSendFileResume(t *testing.T) {
+	dir := t.TempDir()
+	errs := serve(t, PORT9200, &Receiver{Dir: dir})
+	src, data := writeTestFile(t, 4<<20)
+	id := "sub/dir/file.bin"
+	final := filepath.Join(dir, "sub", "dir", "file.bin")
+
+	//interrupt the first transfer after some data was sent
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &udtgo.FileTransferOptions{
+		Interval: 10 * time.Millisecond,
+		OnProgress: func(p udtgo.Progress) {
+			if p.Done > 1<<20 {
+				cancel()
+			}
+		},
+	}
+	c := dial(t, PORT9200)
+	res, err := SendFile(ctx, c, src, id, opts)
+	c.Close()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Transfer should be cancelled got %v", err)
+	}
+	if res.Offset != 0 || res.Transferred <= 0 {
+		t.Errorf("Unexpected result of interrupted transfer %+v", res)
+	}
+	if err = <-errs; err == nil {
+		t.Errorf("Receiver should fail on interrupted transfer")
+	}
+	if _, err = os.Stat(final); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Incomplete file should not be visible %v", err)
+	}
+
+	c = dial(t, PORT9200)
+	defer c.Close()
+	res, err = SendFile(context.Background(), c, src, id, nil)
+	if err != nil {
+		t.Fatalf("Unable to resume transfer %s", err)
+	}
+	if res.Offset <= 0 || res.Offset+res.Transferred != int64(len(data)) {
+		t.Errorf("Transfer should be resumed %+v", res)
+	}
+	got, err := os.ReadFile(final)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Received file differs from sent file %v", err)
+	}
+	if fi, _ := os.Stat(final); !fi.ModTime().Equal(res.ModTime) {
+		t.Errorf("Modification time should be %v got %v", res.ModTime, fi.ModTime())
+	}
+	if parts, _ := filepath.Glob(filepath.Join(dir, "sub", "dir", ".*.part")); len(parts) != 0 {
+		t.Errorf("Temporary files should be removed %v", parts)
+	}
+
+	//the same file again on the same connection is not transferred
+	res, err = SendFile(context.Background(), c, src, id, nil)
+	if err != nil || res.Offset != int64(len(data)) || res.Transferred != 0 {
+		t.Errorf("Complete file should not be sent again %+v %v", res, err)
+	}
+}
+
+func TestSendFileRejected(t *testing.T) {
+	dir := t.TempDir()
+	r := &Receiver{
+		Dir: dir,
+		Accept: func(info FileInfo) error {
+			if info.Size > 100 {
+				return errors.New("too large")
+			}
+			return nil
+		},
+	}
+	serve(t, PORT9201, r)
+	src, data := writeTestFile(t, 1000)
+
+	c := dial(t, PORT9201)
+	defer c.Close()
+	for _, id := range []string{"../escape", "/abs", "big"} {
+		if _, err := SendFile(context.Background(), c, src, id, nil); !errors.Is(err, ErrRejected) {
+			t.Errorf("File %q should be rejected got %v", id, err)
+		}
+	}
+
+	//rejection keeps the connection usable
+	if err := os.Truncate(src, 50); err != nil {
+		t.Fatalf("Unable to truncate file %s", err)
+	}
+	if _, err := SendFile(context.Background(), c, src, "small", nil); err != nil {
+		t.Fatalf("Unable to send file %s", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "small")); !bytes.Equal(got, data[:50]) {
+		t.Errorf("Received file differs from sent file")
+	}
+
+	//a link in the directory, for example received with SendDir, does not lead outside of it
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("Unable to create link %s", err)
+	}
+	for _, id := range []string{"link/file", "link/sub/file"} {
+		if _, err := SendFile(context.Background(), c, src, id, nil); !errors.Is(err, ErrRejected) {
+			t.Errorf("File %q should be rejected got %v", id, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Files should not be written through the link %v", entries)
+	}
+}
+
+func TestSendFileRepair(t *testing.T) {
+	dir := t.TempDir()
+	serve(t, PORT9202, &Receiver{Dir: dir})
+	src, data := writeTestFile(t, 3*ChunkSize+1000)
+
+	//damage two chunks of the received data before it is verified
+	testHookReceived = func(path string) {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Errorf("Unable to open received file %s", err)
+			return
+		}
+		defer f.Close()
+		f.WriteAt([]byte("damaged"), ChunkSize+100)
+		f.WriteAt([]byte("damaged"), 3*ChunkSize+10)
+	}
+	defer func() { testHookReceived = nil }()
+
+	c := dial(t, PORT9202)
+	defer c.Close()
+	res, err := SendFile(context.Background(), c, src, "file.bin", nil)
+	if err != nil {
+		t.Fatalf("Unable to send file %s", err)
+	}
+	if res.Repaired != 2 {
+		t.Errorf("Two chunks should be repaired got %d", res.Repaired)
+	}
+	if res.Digest != sha256.Sum256(data) {
+		t.Errorf("Unexpected digest %x", res.Digest)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "file.bin")); !bytes.Equal(got, data) {
+		t.Errorf("Received file differs from sent file")
+	}
+}
@@ -0,0 +1,184 @@
+/*****************************************************************************
+Copyright (c) 2015, Kamlesh Sharma at kambeena@gmail.com.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the creator nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kambeena/udtgo"
+)
+
+//ChunkSize is the size of file chunks hashed with SHA-256 to verify transferred data.
+//Chunks whose digests differ on the receiver are transferred again.
+
+const ChunkSize = 1 << 20
+
+//Number of times mismatched chunks are transferred again before the receiver gives up.
+
+const maxRepairRounds = 3
+
+//Called by tests after data of a file is received, before it is verified.
+
+var testHookReceived func(path string)
+
+//Returns SHA-256 digests of chunks of the first size bytes of the file at path and
+//digest of the whole file. Missing data at the end of the file is hashed as empty.
+
+func hashFile(path string, size int64, chunkSize int) ([]digest, digest, error) {
+	var sum digest
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, sum, err
+	}
+	defer f.Close()
+
+	req := &request{Size: size, ChunkSize: chunkSize}
+	digests := make([]digest, req.chunks())
+	whole := sha256.New()
+	h := sha256.New()
+	w := io.MultiWriter(whole, h)
+	for i := range digests {
+		_, n := req.chunk(i)
+		h.Reset()
+		if _, err = io.CopyN(w, f, n); err != nil && err != io.EOF {
+			return nil, sum, err
+		}
+		h.Sum(digests[i][:0])
+	}
+	whole.Sum(sum[:0])
+	return digests, sum, nil
+}
+
+//Sends digests of the file chunks and transfers chunks the receiver reports as
+//mismatched. Returns digest of the whole file and number of transferred chunks.
+
+func sendDigests(ctx context.Context, conn *udtgo.Conn, path string, req *request) (sum digest, repaired int, err error) {
+	digests, sum, err := hashFile(path, req.Size, req.ChunkSize)
+	if err != nil {
+		return sum, 0, err
+	}
+	if err = writeDigests(conn, digests); err != nil {
+		return sum, 0, err
+	}
+	for {
+		chunks, err := readIndexes(conn, len(digests))
+		if err != nil || len(chunks) == 0 {
+			return sum, repaired, err
+		}
+		for _, i := range chunks {
+			offset, size := req.chunk(i)
+			if _, err = udtgo.SendFileContext(ctx, conn, path, offset, size, nil); err != nil {
+				return sum, repaired, err
+			}
+		}
+		repaired += len(chunks)
+	}
+}
+
+//Verifies the sent file with the receiver and reads its final response.
+
+func verifySent(ctx context.Context, conn *udtgo.Conn, path string, req *request, res *Result) (err error) {
+	if res.Digest, res.Repaired, err = sendDigests(ctx, conn, path, req); err != nil {
+		return err
+	}
+	resp, sum, err := readFinal(conn)
+	if err != nil {
+		return err
+	}
+	if err = resp.err(); err != nil {
+		return err
+	}
+	if sum != res.Digest {
+		return fmt.Errorf("transfer: digest of %s differs on receiver", req.ID)
+	}
+	return nil
+}
+
+//Compares chunks of the file at path with digests of the sender and receives mismatched
+//chunks again. Returns digest of the whole file and number of received chunks. If the
+//file cannot be verified the sender is told so with a final response.
+
+func (r *Receiver) verify(ctx context.Context, conn *udtgo.Conn, path string, req *request) (sum digest, repaired int, err error) {
+	want, err := readDigests(conn, req.chunks())
+	if err != nil {
+		return sum, 0, err
+	}
+
+	for round := 0; ; round++ {
+		var got []digest
+		got, sum, err = hashFile(path, req.Size, req.ChunkSize)
+		if err != nil {
+			return sum, repaired, failVerify(conn, err)
+		}
+		var chunks []int
+		for i := range want {
+			if got[i] != want[i] {
+				chunks = append(chunks, i)
+			}
+		}
+		if len(chunks) == 0 {
+			return sum, repaired, writeIndexes(conn, nil)
+		}
+		if round == maxRepairRounds {
+			return sum, repaired, failVerify(conn,
+				fmt.Errorf("transfer: %d chunks of %s differ after %d repairs", len(chunks), req.ID, round))
+		}
+
+		if err = writeIndexes(conn, chunks); err != nil {
+			return sum, repaired, err
+		}
+		for _, i := range chunks {
+			offset, size := req.chunk(i)
+			if _, err = udtgo.RecvFileContext(ctx, conn, path, offset, size, nil); err != nil {
+				return sum, repaired, err
+			}
+		}
+		repaired += len(chunks)
+	}
+}
+
+//Ends verification with an empty chunk list followed by final response with err,
+//which the sender returns. Returns err.
+
+func failVerify(conn *udtgo.Conn, err error) error {
+	if writeIndexes(conn, nil) == nil {
+		writeFinal(conn, &response{Status: statusFailed, Message: err.Error()}, digest{})
+	}
+	return err
+}
@@ -41,22 +41,26 @@ package udtgo
 
 // #cgo LDFLAGS: /usr/local/lib/libudt.so
 //
+// #include <stdlib.h>
 // #include "udtc.h"
 import "C"
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"net"
 	"reflect"
+	"strconv"
 	"unsafe"
 	"syscall"
 )
 
 type Socket struct {
-	sock C.UDTSOCKET
-	af   C.int
+	sock  C.UDTSOCKET
+	af    C.int
+	raddr *net.UDPAddr //peer address returned by accept
 }
 
 type Sockets struct {
@@ -154,6 +158,14 @@ const (
 	UDT_EVENT      string = "UDT_EVENT"
 	UDT_SNDDATA    string = "UDT_SNDDATA"
 	UDT_RCVDATA    string = "UDT_RCVDATA"
+	UDT_MAXMSG     string = "UDT_MAXMSG"
+	UDT_MSGTTL     string = "UDT_MSGTTL"
+	UDT_PASSPHRASE string = "UDT_PASSPHRASE"
+	UDT_CRYPTOKEY  string = "UDT_CRYPTOKEY"
+	UDT_PSK        string = "UDT_PSK"
+	UDT_HSRATE     string = "UDT_HSRATE"
+	UDT_STREAMID   string = "UDT_STREAMID"
+	UDT_IPV6ONLY   string = "UDT_IPV6ONLY"
 )
 
 //Use this function to create udt socket. This function returns
@@ -161,9 +173,10 @@ const (
 //family AF_INET or AF_INET6. 
 //parameter - network - IP family ip4 or ip6
 //parameter - isStream - true socket type SOCK_STREAM or SOCK_DGRAM
+//parameter - opts - socket options applied in order, the socket is closed if any of them fails
 
 
-func CreateSocket(network string, isStream bool) (socket *Socket, err error) {
+func CreateSocket(network string, isStream bool, opts ...SocketOption) (socket *Socket, err error) {
 	var n C.int
 
 	if network == "ip4" {
@@ -181,10 +194,10 @@ func CreateSocket(network string, isStream bool) (socket *Socket, err error) {
 		trnType = C.SOCK_DGRAM //messaging
 	}
 
-	sock := C.udt_socket(n, trnType, 0)
+	sock, errno := C.udt_socket(n, trnType, 0)
 
 	if  C.int(sock) == C.int(C.UDT_INVALID_SOCK) {
-		return nil, udtErrDesc("Invalid socket")
+		return nil, udtError("socket", errno)
 	}
 
 	socket = &Socket{
@@ -192,36 +205,96 @@ func CreateSocket(network string, isStream bool) (socket *Socket, err error) {
 		af:   n,
 	}
 
+	for _, opt := range opts {
+		if err = opt(socket); err != nil {
+			C.udt_close(sock)
+			return nil, err
+		}
+	}
+
 	return
 }
 
-//Binds socket to the passed port number. If the binding is successful, bind returns 0, otherwise it returns
-//error code (http://udt.sourceforge.net/udt4/doc/ecode.htm) and error object with error details.
+//Binds socket to the passed port number on the wildcard address of the socket IP family, 0.0.0.0 or ::.
+//If the binding is successful, bind returns 0, otherwise it returns error code
+//(http://udt.sourceforge.net/udt4/doc/ecode.htm) and error object with error details.
+//Use BindAddr to bind a specific host.
 
 func Bind(socket *Socket, portno int) (retval int, err error) {
 
-	hostStr := ""
-
-	if socket.af == syscall.AF_INET6 {
-		hostStr = "[0:0:0:0:0:0:0:1]"
+	if err = BindAddr(socket, &net.UDPAddr{Port: portno}); err != nil {
+		return -1, err
 	}
 
+	return
+
+}
 
-	rsa, salen, err := createSockaddr(hostStr, portno)
+//Binds socket to the passed UDP address. Empty IP address binds the wildcard address of the
+//socket IP family, zero port picks a free port. IPv6 zone selects the interface of link-local
+//addresses. Whether :: also accepts IPv4 peers is decided by Socket.SetIPv6Only.
+
+func BindAddr(socket *Socket, addr *net.UDPAddr) (err error) {
+
+	if addr == nil {
+		addr = &net.UDPAddr{}
+	}
+
+	rsa, salen, err := udpAddrToSockaddr(addr, socket.af)
 	if err != nil {
-		return -1, fmt.Errorf("could not convert syscall.Sockaddr to syscall.RawSockaddrAny %s", err)
+		return fmt.Errorf("could not convert syscall.Sockaddr to syscall.RawSockaddrAny %s", err)
 	}
 
 	csa := (*C.struct_sockaddr)(unsafe.Pointer(rsa))
-	if C.udt_bind(socket.sock, csa, C.int(salen)) != 0 {
-		return -1, udtErrDesc("Unable to bind socket")
+	if cret, errno := C.udt_bind(socket.sock, csa, C.int(salen)); cret != 0 {
+		return udtError("bind", errno)
 	}
+	return nil
+}
 
-	return
+//Binds socket to an existing UDP socket, for example one that was hole-punched, bound to a
+//VRF or opened with special options. UDT sends and receives all packets of the socket through
+//it, the IP family of fd must match the socket. UDT puts fd in blocking mode with a receive
+//timeout and keeps its buffer sizes, UDP_SNDBUF and UDP_RCVBUF options do not apply. On success
+//fd is owned by UDT, which closes it when the socket is closed, so the caller must not close it.
+//On failure fd stays owned by the caller.
 
+func BindFD(socket *Socket, fd int) (err error) {
+
+	if cret, errno := C.udt_bind2(socket.sock, C.UDPSOCKET(fd)); cret != 0 {
+		return udtError("bind2", errno)
+	}
+	return nil
+}
+
+//Returns descriptor of the UDP socket the bound socket sends and receives on. It stays owned
+//by UDT, which closes it with the last socket using it.
+
+func (socket *Socket) UDPFD() (int, error) {
+	var fd C.UDPSOCKET
+	optlen := C.int(unsafe.Sizeof(fd))
+	if cret, errno := C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_UDPSOCK, unsafe.Pointer(&fd), &optlen); cret < 0 {
+		return -1, udtError("getsockopt", errno)
+	}
+	return int(fd), nil
 }
 
+//Binds socket to the UDP socket of conn like BindFD. UDT gets a duplicate of the descriptor,
+//which shares blocking mode with conn, so on success conn must be closed and never used again.
+//On failure conn is left unchanged.
 
+func BindUDPConn(socket *Socket, conn *net.UDPConn) (err error) {
+
+	fd, err := dupUDPConn(conn)
+	if err != nil {
+		return err
+	}
+	if err = BindFD(socket, fd); err != nil {
+		closeFD(fd)
+		return err
+	}
+	return nil
+}
 
 //This function turns socket to listening state and makes socket ready to recieve connection
 //requests. Pass backlog parameter to configure number of pending connections. If successful,
@@ -230,66 +303,93 @@ func Bind(socket *Socket, portno int) (retval int, err error) {
 
 func Listen(socket *Socket, backlog int) (retval int, err error) {
 
-	retval = int(C.udt_listen(socket.sock, C.int(backlog)))
+	cret, errno := C.udt_listen(socket.sock, C.int(backlog))
+	retval = int(cret)
 
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to listen")
+		return retval, udtError("listen", errno)
 	}
 	return
 }
 
 //Retrieves and returns newly accepted socket. If successful,
 // this method returns new socket and error object if unable to accept new socket with error details.
+// The returned socket keeps IP family and address of the peer side (see Peeraddr).
 
 func Accept(socket *Socket) (newSocket *Socket, err error) {
 
 	var rsa syscall.RawSockaddrAny
-	var addrlen C.int
+	addrlen := C.int(syscall.SizeofSockaddrAny)
 
-	newSock := C.udt_accept(socket.sock, (*C.struct_sockaddr)(unsafe.Pointer(&rsa)),
+	newSock, errno := C.udt_accept(socket.sock, (*C.struct_sockaddr)(unsafe.Pointer(&rsa)),
 		&addrlen)
 
 	if  C.int(newSock) == C.int(C.UDT_INVALID_SOCK) {
-		return nil, udtErrDesc("Unable to accept on socket")
+		return nil, udtError("accept", errno)
 	}
 
 	newSocket = &Socket{
 		sock: newSock,
+		af:   C.int(rsa.Addr.Family),
 	}
+	newSocket.raddr, _ = sockaddrToUDPAddr(&rsa)
 
 	return
 }
 
+//Returns address of the peer side as reported when the socket was accepted. For
+//sockets which are not returned by Accept this method queries UDT for the peer name.
+
+func Peeraddr(socket *Socket) (addr *net.UDPAddr, err error) {
+	if socket.raddr != nil {
+		return socket.raddr, nil
+	}
+	return getUDPAddr(socket, true)
+}
+
+//Returns address the socket is bound to, with port and IPv6 zone.
+
+func (socket *Socket) LocalAddr() (*net.UDPAddr, error) {
+	return getUDPAddr(socket, false)
+}
+
+//Returns address of the peer side of a connected socket, with port and IPv6 zone.
+
+func (socket *Socket) RemoteAddr() (*net.UDPAddr, error) {
+	return Peeraddr(socket)
+}
+
 //The connect method connects to a server socket (in regular mode) or
 // a peer socket (in rendezvous mode) to set up a UDT connection. If successful,
 // this method returns 0, otherwise it returns error code (http://udt.sourceforge.net/udt4/doc/ecode.htm)
 // and error object with error details.
+// The first address of host of the socket IP family is used, use Dial to try all of them.
 
 
 func Connect(socket *Socket, host string, portno int) (retval int, err error) {
 
-	addrs, err := net.LookupHost(host)
-
-	if err != nil {
-		return -1, fmt.Errorf("Unable to connect to the socket: %s", err)
+	network := "udt4"
+	if socket.af == syscall.AF_INET6 {
+		network = "udt6"
 	}
 
-	resolvedHost := addrs[0]
+	raddrs, err := resolveUDTAddrs(context.Background(), network, net.JoinHostPort(host, strconv.Itoa(portno)))
 
-	if socket.af == syscall.AF_INET6 {
-		resolvedHost = fmt.Sprintf("[%s]", resolvedHost)
+	if err != nil {
+		return -1, fmt.Errorf("Unable to connect to the socket: %s", err)
 	}
 
-	rsa, salen, err := createSockaddr(resolvedHost, portno)
+	rsa, salen, err := udpAddrToSockaddr(raddrs[0], socket.af)
 
 	if err != nil {
 		return -1, fmt.Errorf("could not convert syscall.Sockaddr to syscall.RawSockaddrAny %s", err)
 	}
 
-	retval = int(C.udt_connect(socket.sock, (*C.struct_sockaddr)(unsafe.Pointer(rsa)),
-		C.int(salen)))
+	cret, errno := C.udt_connect(socket.sock, (*C.struct_sockaddr)(unsafe.Pointer(rsa)),
+		C.int(salen))
+	retval = int(cret)
 	if retval != 0 {
-		return retval, udtErrDesc("Unable to connect to the socket")
+		return retval, udtError("connect", errno)
 	}
 	return
 }
@@ -302,7 +402,7 @@ func Connect(socket *Socket, host string, portno int) (retval int, err error) {
 func Getsockstate(socket *Socket) (status int, err error) {
 	status = int(C.udt_getsockstate(socket.sock))
 	if status < 0 {
-		return status, udtErrDesc("Unable to get socket status")
+		return status, udtError("getsockstate", nil)
 	}
 	return
 }
@@ -313,9 +413,10 @@ func Getsockstate(socket *Socket) (status int, err error) {
 
 func Send(socket *Socket, data *byte, length int) (retval int, err error) {
 
-	retval = int(C.udt_send(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length), C.int(0)))
+	cret, errno := C.udt_send(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length), C.int(0))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to send data")
+		return retval, udtError("send", errno)
 	}
 	return
 }
@@ -326,9 +427,10 @@ func Send(socket *Socket, data *byte, length int) (retval int, err error) {
 
 func Recv(socket *Socket, data *byte, length int) (retval int, err error) {
 
-	retval = int(C.udt_recv(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length), C.int(0)))
+	cret, errno := C.udt_recv(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length), C.int(0))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to recive data")
+		return retval, udtError("recv", errno)
 	}
 	return
 }
@@ -346,10 +448,11 @@ func SendMsg(socket *Socket, data *byte, length int, ttl int, inorder bool) (ret
 	} else {
 		cInorder = 0
 	}
-	retval = int(C.udt_sendmsg(socket.sock, (*C.char)(unsafe.Pointer(data)),
-		C.int(length), C.int(ttl), cInorder))
+	cret, errno := C.udt_sendmsg(socket.sock, (*C.char)(unsafe.Pointer(data)),
+		C.int(length), C.int(ttl), cInorder)
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to send message")
+		return retval, udtError("sendmsg", errno)
 	}
 	return
 }
@@ -360,9 +463,10 @@ func SendMsg(socket *Socket, data *byte, length int, ttl int, inorder bool) (ret
 
 func RecvMsg(socket *Socket, data *byte, length int) (retval int, err error) {
 
-	retval = int(C.udt_recvmsg(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length)))
+	cret, errno := C.udt_recvmsg(socket.sock, (*C.char)(unsafe.Pointer(data)), C.int(length))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to receive message")
+		return retval, udtError("recvmsg", errno)
 	}
 	return
 }
@@ -382,10 +486,13 @@ func Sendfile(socket *Socket, filepath string, offset *int64, size int64) (retva
 func Sendfile2(socket *Socket, filepath string, offset *int64, 
 		size int64, block int) (retval int64, err error) {
 
-	retval = int64(C.udt_sendfile2(socket.sock, C.CString(filepath),
-		(*C.int64_t)(unsafe.Pointer(offset)), C.int64_t(size), C.int(block)))
+	cpath := C.CString(filepath)
+	defer C.free(unsafe.Pointer(cpath))
+	cret, errno := C.udt_sendfile2(socket.sock, cpath,
+		(*C.int64_t)(unsafe.Pointer(offset)), C.int64_t(size), C.int(block))
+	retval = int64(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to send file ")
+		return retval, udtError("sendfile", errno)
 	}
 	return
 }
@@ -405,77 +512,84 @@ func Recvfile(socket *Socket, filepath string, offset *int64, size int64) (retva
 func Recvfile2(socket *Socket, filepath string, offset *int64, 
 					size int64, block int) (retval int64, err error) {
 
-	retval = int64(C.udt_recvfile2(socket.sock, C.CString(filepath),
-		(*C.int64_t)(unsafe.Pointer(offset)), C.int64_t(size), C.int(block)))
+	cpath := C.CString(filepath)
+	defer C.free(unsafe.Pointer(cpath))
+	cret, errno := C.udt_recvfile2(socket.sock, cpath,
+		(*C.int64_t)(unsafe.Pointer(offset)), C.int64_t(size), C.int(block))
+	retval = int64(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to receive file")
+		return retval, udtError("recvfile", errno)
 	}
 	return
 }
 
 //The method reads UDT socket options. If successful, returns requested option value otherwise
 //returns error object with error details.
+//
+//Deprecated: use typed accessors of Socket such as MSS, Linger or State.
 
 func Getsockopt(socket *Socket, option string) (value interface{}, err error) {
 
 	var data []byte
 	var optlen C.int
 	var retval int = 0
+	var cret C.int
+	var errno error
 	data = make([]byte, 100)
 
 	switch option {
 	case UDT_MSS:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_MSS,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_MSS,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_SNDSYN:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDSYN,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDSYN,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_RCVSYN:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVSYN,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVSYN,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_CC:
 		{
-			return -1, fmt.Errorf("UDT CCC Not implemented.")
+			return socket.CongestionControl(), nil
 		}
 	case UDT_FC:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_FC,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_FC,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_SNDBUF:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDBUF,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDBUF,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_RCVBUF:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVBUF,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVBUF,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDP_SNDBUF:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDP_SNDBUF,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDP_SNDBUF,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDP_RCVBUF:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDP_RCVBUF,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDP_RCVBUF,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_LINGER:
 		{
 			var clinger C.struct_linger
 			var clinger_len = C.int(unsafe.Sizeof(clinger))
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
-				unsafe.Pointer(&clinger), &clinger_len))
-			if retval < 0 {
-				return retval, udtErrDesc("Unable to get option")
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
+				unsafe.Pointer(&clinger), &clinger_len)
+			if cret < 0 {
+				return int(cret), udtError("getsockopt", errno)
 			}
 			linger := Linger{
 				l_onoff:  int(clinger.l_onoff),
@@ -487,48 +601,48 @@ func Getsockopt(socket *Socket, option string) (value interface{}, err error) {
 
 	case UDT_RENDEZVOUS:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RENDEZVOUS,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RENDEZVOUS,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_SNDTIMEO:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDTIMEO,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDTIMEO,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_RCVTIMEO:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVTIMEO,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVTIMEO,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_REUSEADDR:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_REUSEADDR,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_REUSEADDR,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_MAXBW:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_STATE:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_STATE,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_STATE,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_EVENT:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_EVENT,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_EVENT,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_SNDDATA:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDDATA,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDDATA,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	case UDT_RCVDATA:
 		{
-			retval = int(C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVDATA,
-				unsafe.Pointer(&data[0]), &optlen))
+			cret, errno = C.udt_getsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVDATA,
+				unsafe.Pointer(&data[0]), &optlen)
 		}
 	default:
 		{
@@ -536,8 +650,9 @@ func Getsockopt(socket *Socket, option string) (value interface{}, err error) {
 		}
 	}
 
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to get option")
+		return retval, udtError("getsockopt", errno)
 	}
 
 	optlengo := int(optlen)
@@ -563,10 +678,15 @@ func Getsockopt(socket *Socket, option string) (value interface{}, err error) {
 
 //This method sets requested UDT socket option. If successful, returns requested option value otherwise
 //returns error object with error details.
+//
+//Deprecated: use typed setters of Socket such as SetMSS or SetLinger, or SocketOption
+//passed to CreateSocket. They validate option values before they reach UDT.
 
 func Setsockopt(socket *Socket, option string, value interface{}) (retval int, err error) {
 	var data []byte
-	if option != UDT_LINGER {
+	var cret C.int
+	var errno error
+	if option != UDT_LINGER && option != UDT_CC {
 		data, err = getBytes(value)
 		if err != nil {
 			return -1, fmt.Errorf("Unable to convert interface to byte array %s", err)
@@ -578,8 +698,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_MSS,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_MSS,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_SNDSYN:
@@ -587,21 +707,28 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint64 {
 				return -1, fmt.Errorf("Requires Uint64 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDSYN,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDSYN,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 	case UDT_RCVSYN:
 		{
 			if reflect.TypeOf(value).Kind() != reflect.Uint64 {
 				return -1, fmt.Errorf("Requires Uint64 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVSYN,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVSYN,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_CC:
 		{
-			return -1, fmt.Errorf("UDT CCC Not implemented.")
+			newCC, ok := value.(func() CongestionControl)
+			if !ok {
+				return -1, fmt.Errorf("Requires func() CongestionControl type")
+			}
+			if err = socket.SetCongestionControl(newCC); err != nil {
+				return -1, err
+			}
+			return 0, nil
 		}
 
 	case UDT_FC:
@@ -609,8 +736,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_FC,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_FC,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_SNDBUF:
@@ -618,8 +745,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDBUF,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_SNDBUF,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_RCVBUF:
@@ -627,8 +754,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVBUF,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RCVBUF,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDP_SNDBUF:
@@ -636,16 +763,16 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDP_SNDBUF,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDP_SNDBUF,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 	case UDP_RCVBUF:
 		{
 			if reflect.TypeOf(value).Kind() != reflect.Uint16 {
 				return -1, fmt.Errorf("Requires Uint16 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDP_RCVBUF,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDP_RCVBUF,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_LINGER:
@@ -654,8 +781,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			var clinger C.struct_linger
 			clinger.l_onoff = C.int(clingerin.l_onoff)
 			clinger.l_linger = C.int(clingerin.l_linger)
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
-				unsafe.Pointer(&clinger), C.int(unsafe.Sizeof(clinger))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_LINGER,
+				unsafe.Pointer(&clinger), C.int(unsafe.Sizeof(clinger)))
 		}
 
 	case UDT_RENDEZVOUS:
@@ -663,8 +790,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint64 {
 				return -1, fmt.Errorf("Requires Uint64 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RENDEZVOUS,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_RENDEZVOUS,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_REUSEADDR:
@@ -672,8 +799,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint64 {
 				return -1, fmt.Errorf("Requires Uint64 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_REUSEADDR,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_REUSEADDR,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	case UDT_MAXBW:
@@ -681,8 +808,8 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 			if reflect.TypeOf(value).Kind() != reflect.Uint64 {
 				return -1, fmt.Errorf("Requires Uint64 type")
 			}
-			retval = int(C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW,
-				unsafe.Pointer(&data[0]), C.int(len(data))))
+			cret, errno = C.udt_setsockopt(socket.sock, C.int(0), C.UDT_UDT_MAXBW,
+				unsafe.Pointer(&data[0]), C.int(len(data)))
 		}
 
 	default:
@@ -691,8 +818,9 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 		}
 	}
 
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable set option")
+		return retval, udtError("setsockopt", errno)
 	}
 
 	return
@@ -700,16 +828,18 @@ func Setsockopt(socket *Socket, option string, value interface{}) (retval int, e
 
 //This method retrieves the address informtion of the peer side of a connected UDT socket. If successful returns
 //peer socket address otherwise returns error object with error details.
+//
+//Deprecated: Sockaddr has no port and its fields are not exported, use Socket.RemoteAddr.
 
 func Getpeername(socket *Socket) (sockaddr Sockaddr, err error) {
 
 	var sockaddr_in  syscall.RawSockaddrAny
 	var namelen C.int
 
-	retval := int(C.udt_getpeername(socket.sock,
-		(*C.struct_sockaddr)(unsafe.Pointer(&sockaddr_in)), &namelen))
+	retval, errno := C.udt_getpeername(socket.sock,
+		(*C.struct_sockaddr)(unsafe.Pointer(&sockaddr_in)), &namelen)
 	if retval < 0 {
-		return sockaddr, udtErrDesc("Unable to get socket peername")
+		return sockaddr, udtError("getpeername", errno)
 	}
 
 	addrStr, _ := parseAddr(&sockaddr_in)
@@ -726,17 +856,19 @@ func Getpeername(socket *Socket) (sockaddr Sockaddr, err error) {
 
 //This method retrieves the address informtion of the UDT socket. If successful returns
 //socket address otherwise returns error object with error details.
+//
+//Deprecated: Sockaddr has no port and its fields are not exported, use Socket.LocalAddr.
 
 func Getsockname(socket *Socket) (sockaddr Sockaddr, err error) {
 
 	var sockaddr_in  syscall.RawSockaddrAny
 	var namelen C.int
 
-	retval := int(C.udt_getsockname(socket.sock,
-		(*C.struct_sockaddr)(unsafe.Pointer(&sockaddr_in)), &namelen))
+	retval, errno := C.udt_getsockname(socket.sock,
+		(*C.struct_sockaddr)(unsafe.Pointer(&sockaddr_in)), &namelen)
 
 	if retval < 0 {
-		return sockaddr, udtErrDesc("Unable to get socket name")
+		return sockaddr, udtError("getsockname", errno)
 	}
 
 	addrStr, _ := parseAddr(&sockaddr_in)
@@ -750,8 +882,36 @@ func Getsockname(socket *Socket) (sockaddr Sockaddr, err error) {
 	return
 }
 
+//Retrieves local (peer == false) or peer (peer == true) address of the UDT socket
+//including port number.
+
+func getUDPAddr(socket *Socket, peer bool) (addr *net.UDPAddr, err error) {
+
+	var rsa syscall.RawSockaddrAny
+	namelen := C.int(syscall.SizeofSockaddrAny)
+
+	var retval C.int
+	var errno error
+	op := "getsockname"
+	if peer {
+		op = "getpeername"
+		retval, errno = C.udt_getpeername(socket.sock,
+			(*C.struct_sockaddr)(unsafe.Pointer(&rsa)), &namelen)
+	} else {
+		retval, errno = C.udt_getsockname(socket.sock,
+			(*C.struct_sockaddr)(unsafe.Pointer(&rsa)), &namelen)
+	}
+	if retval < 0 {
+		return nil, udtError(op, errno)
+	}
+
+	return sockaddrToUDPAddr(&rsa)
+}
+
 //This method retrieves the internal protocol parameters and performance trace. If successful returns
 // Traceinfo struct otherwise returns error object with error details.
+//
+//Deprecated: fields of Traceinfo are not exported, use Socket.Stats or StatsSampler.
 
 func Perfmon(socket *Socket, clear bool) (traceinfo Traceinfo, err error) {
 
@@ -762,10 +922,10 @@ func Perfmon(socket *Socket, clear bool) (traceinfo Traceinfo, err error) {
 
 	var udtTraceinfo C.UDT_TRACEINFO
 
-	retval := int(C.udt_perfmon(socket.sock,
-		(*C.UDT_TRACEINFO)(unsafe.Pointer(&udtTraceinfo)), cClear))
+	retval, errno := C.udt_perfmon(socket.sock,
+		(*C.UDT_TRACEINFO)(unsafe.Pointer(&udtTraceinfo)), cClear)
 	if retval < 0 {
-		return traceinfo, udtErrDesc("Unable to get trace info")
+		return traceinfo, udtError("perfmon", errno)
 	}
 
 	traceinfo = Traceinfo{
@@ -810,9 +970,10 @@ func Perfmon(socket *Socket, clear bool) (traceinfo Traceinfo, err error) {
 //otherwise returns error object with error details.
 
 func EpollCreate() (eid int, err error) {
-	eid = int(C.udt_epoll_create())
+	ceid, errno := C.udt_epoll_create()
+	eid = int(ceid)
 	if eid < 0 {
-		return eid, udtErrDesc("Unable create new epoll ID")
+		return eid, udtError("epoll_create", errno)
 	}
 	return
 }
@@ -824,10 +985,11 @@ func EpollCreate() (eid int, err error) {
 
 func EpollAddUsock(eid int, socket *Socket, events int) (retval int, err error) {
 
-	retval = int(C.udt_epoll_add_usock(C.int(eid), socket.sock,
-		(*C.int)(unsafe.Pointer(&events))))
+	cret, errno := C.udt_epoll_add_usock(C.int(eid), socket.sock,
+		(*C.int)(unsafe.Pointer(&events)))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to add UDT socket for epoll")
+		return retval, udtError("epoll_add_usock", errno)
 	}
 	return
 
@@ -840,10 +1002,11 @@ func EpollAddUsock(eid int, socket *Socket, events int) (retval int, err error)
 
 func EpollAddSsock(eid int, socket C.SYSSOCKET, events int) (retval int, err error) {
 
-	retval = int(C.udt_epoll_add_ssock(C.int(eid), socket,
-		(*C.int)(unsafe.Pointer(&events))))
+	cret, errno := C.udt_epoll_add_ssock(C.int(eid), socket,
+		(*C.int)(unsafe.Pointer(&events)))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to add sys socket for epoll")
+		return retval, udtError("epoll_add_ssock", errno)
 	}
 	return
 
@@ -855,9 +1018,10 @@ func EpollAddSsock(eid int, socket C.SYSSOCKET, events int) (retval int, err err
 
 func EpollRemoveUsock(eid int, socket *Socket) (retval int, err error) {
 
-	retval = int(C.udt_epoll_remove_usock(C.int(eid), socket.sock))
+	cret, errno := C.udt_epoll_remove_usock(C.int(eid), socket.sock)
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to remove UDT socket")
+		return retval, udtError("epoll_remove_usock", errno)
 	}
 	return
 
@@ -869,31 +1033,97 @@ func EpollRemoveUsock(eid int, socket *Socket) (retval int, err error) {
 
 func EpollRemoveSsock(eid int, socket C.SYSSOCKET) (retval int, err error) {
 
-	retval = int(C.udt_epoll_remove_ssock(C.int(eid), socket))
+	cret, errno := C.udt_epoll_remove_ssock(C.int(eid), socket)
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to remove sys socket")
+		return retval, udtError("epoll_remove_ssock", errno)
 	}
 	return
 
 }
 
-//This method add wait on give read and write UDT and ystem sockets. If successful,
-// this method returns 0, otherwise it returns error code (http://udt.sourceforge.net/udt4/doc/ecode.htm)
+//This method add wait on give read and write UDT and ystem sockets. Ready sockets are stored at the beginning
+// of passed slices, empty or nil slices are not watched. If successful, this method returns number of ready sockets,
+// otherwise it returns error code (http://udt.sourceforge.net/udt4/doc/ecode.htm)
 // and error object with error details.
 
 func EpollWait2(eid int, readfds []C.UDTSOCKET, writefds []C.UDTSOCKET, msTimeOut int64,
 	lrfds []C.SYSSOCKET, lwfds []C.SYSSOCKET) (retval int, err error) {
-	rnum := C.int(len(readfds))
-	wnum := C.int(len(writefds))
-	lrnum := C.int(len(lrfds))
-	lwnum := C.int(len(lwfds))
-
-	retval = int(C.udt_epoll_wait2(C.int(eid), (*C.UDTSOCKET)(unsafe.Pointer(&readfds[0])),
-		&rnum, (*C.UDTSOCKET)(unsafe.Pointer(&writefds[0])), &wnum, C.int64_t(msTimeOut),
-		(*C.SYSSOCKET)(unsafe.Pointer(&lrfds[0])), &lrnum,
-		(*C.SYSSOCKET)(unsafe.Pointer(&lwfds[0])), &lwnum))
-	if retval < 0 {
-		return retval, udtErrDesc("Unable to epoll wait")
+
+	rnum, wnum, lrnum, lwnum, err := epollWait(eid, readfds, writefds, msTimeOut, lrfds, lwfds)
+	if err != nil {
+		return -1, err
+	}
+	return rnum + wnum + lrnum + lwnum, nil
+}
+
+//Waits on epoll and returns number of ready sockets stored in each slice.
+
+func epollWait(eid int, readfds []C.UDTSOCKET, writefds []C.UDTSOCKET, msTimeOut int64,
+	lrfds []C.SYSSOCKET, lwfds []C.SYSSOCKET) (rnum, wnum, lrnum, lwnum int, err error) {
+
+	//UDT does not report zero count of empty result, unused entries are marked invalid
+	for i := range readfds {
+		readfds[i] = C.UDT_INVALID_SOCK
+	}
+	for i := range writefds {
+		writefds[i] = C.UDT_INVALID_SOCK
+	}
+	for i := range lrfds {
+		lrfds[i] = invalidSysSocket
+	}
+	for i := range lwfds {
+		lwfds[i] = invalidSysSocket
+	}
+
+	var crnum, cwnum, clrnum, clwnum C.int
+	cret, errno := C.udt_epoll_wait2(C.int(eid),
+		udtSocketsPtr(readfds), epollNumPtr(&crnum, len(readfds)),
+		udtSocketsPtr(writefds), epollNumPtr(&cwnum, len(writefds)),
+		C.int64_t(msTimeOut),
+		sysSocketsPtr(lrfds), epollNumPtr(&clrnum, len(lrfds)),
+		sysSocketsPtr(lwfds), epollNumPtr(&clwnum, len(lwfds)))
+	if cret < 0 {
+		return 0, 0, 0, 0, udtError("epoll_wait", errno)
+	}
+	return countUDTSockets(readfds, crnum), countUDTSockets(writefds, cwnum),
+		countSysSockets(lrfds, clrnum), countSysSockets(lwfds, clwnum), nil
+}
+
+func udtSocketsPtr(fds []C.UDTSOCKET) *C.UDTSOCKET {
+	if len(fds) == 0 {
+		return nil
+	}
+	return &fds[0]
+}
+
+func sysSocketsPtr(fds []C.SYSSOCKET) *C.SYSSOCKET {
+	if len(fds) == 0 {
+		return nil
+	}
+	return &fds[0]
+}
+
+//Sets capacity of result array, nil tells UDT not to watch the set.
+
+func epollNumPtr(num *C.int, size int) *C.int {
+	if size == 0 {
+		return nil
+	}
+	*num = C.int(size)
+	return num
+}
+
+func countUDTSockets(fds []C.UDTSOCKET, num C.int) (n int) {
+	for n < int(num) && n < len(fds) && fds[n] != C.UDT_INVALID_SOCK {
+		n++
+	}
+	return
+}
+
+func countSysSockets(fds []C.SYSSOCKET, num C.int) (n int) {
+	for n < int(num) && n < len(fds) && fds[n] != invalidSysSocket {
+		n++
 	}
 	return
 }
@@ -903,9 +1133,10 @@ func EpollWait2(eid int, readfds []C.UDTSOCKET, writefds []C.UDTSOCKET, msTimeOu
 // and error object with error details.
 
 func EpollRelease(eid int) (retval int, err error) {
-	retval = int(C.udt_epoll_release(C.int(eid)))
+	cret, errno := C.udt_epoll_release(C.int(eid))
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to release socket")
+		return retval, udtError("epoll_release", errno)
 	}
 	return
 }
@@ -915,9 +1146,11 @@ func EpollRelease(eid int) (retval int, err error) {
 // and error object with error details.
 
 func Close(socket *Socket) (retval int, err error) {
-	retval = int(C.udt_close(socket.sock))
+	cret, errno := C.udt_close(socket.sock)
+	acceptFuncs.Delete(socket.sock)
+	retval = int(cret)
 	if retval < 0 {
-		return retval, udtErrDesc("Unable to close socket")
+		return retval, udtError("close", errno)
 	}
 	return
 }
@@ -927,9 +1160,10 @@ func Close(socket *Socket) (retval int, err error) {
 // and error object with error details.
 
 func Startup() (retval int, err error) {
-	retval = int(C.udt_startup())
+	cret, errno := C.udt_startup()
+	retval = int(cret)
 	if retval != 0 {
-		return retval, udtErrDesc("Unable to startup UDT library")
+		return retval, udtError("startup", errno)
 	}
 	return
 }
@@ -940,9 +1174,10 @@ func Startup() (retval int, err error) {
 
 
 func Cleanup() (retval int, err error) {
-	retval = int(C.udt_cleanup())
+	cret, errno := C.udt_cleanup()
+	retval = int(cret)
 	if retval != 0 {
-		return retval, udtErrDesc("Unable to execute cleanup")
+		return retval, udtError("cleanup", errno)
 	}
 	return
 }
@@ -953,13 +1188,6 @@ func Clearlasterror() {
 	C.udt_clearlasterror()
 }
 
-//This method retrieves recent error from UDT sysytem.
-
-func udtErrDesc(appMsg string) (err error) {
-	return fmt.Errorf("%s - UDT Error-%s:%d ", appMsg,
-		C.GoString(C.udt_getlasterror_desc()), int(C.udt_getlasterror_code()))
-}
-
 //Utility method converts boolean to int.
 
 func boolToInt(boolvalue bool) (boolint int) {
@@ -988,6 +1216,10 @@ func CreateSockets(size int) (sockets Sockets) {
 	return
 }
 
+//System socket value which is not a valid descriptor, -1 on Linux and INVALID_SOCKET on Windows.
+
+const invalidSysSocket = ^C.SYSSOCKET(0)
+
 //This method creates system socket.
 
 func CreateSysSockets(size int) (sockets SysSockets) {
@@ -997,57 +1229,77 @@ func CreateSysSockets(size int) (sockets SysSockets) {
 	return
 }
 
-//creates RawSockaddrAny structure from host string and port number. This strucure
+//creates RawSockaddrAny structure of IP family af from UDP address. This strucure
 //is used for calling UDT C api
 
-func createSockaddr(host string, portno int) (rsa *syscall.RawSockaddrAny, salen Socketlen, err error) {
-
-	networkStr := fmt.Sprintf("%s:%d", host, portno)
-	udpAddr, err := net.ResolveUDPAddr("udp", networkStr)
-
-	if err != nil {
-		return nil, 0, fmt.Errorf("Unable to create network address")
-		return
-	}
+func udpAddrToSockaddr(addr *net.UDPAddr, af C.int) (rsa *syscall.RawSockaddrAny, salen Socketlen, err error) {
 
 	var sa syscall.Sockaddr
-	ip := udpAddr.IP
-	zone := udpAddr.Zone
 
+	switch af {
+	case syscall.AF_INET:
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		if addr.IP != nil {
+			ip := addr.IP.To4()
+			if ip == nil {
+				return nil, 0, fmt.Errorf("%s is not an IPv4 address", addr.IP)
+			}
+			copy(sa4.Addr[:], ip)
+		}
+		sa = sa4
+
+	case syscall.AF_INET6:
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port, ZoneId: uint32(ipv6ZoneToInt(addr.Zone))}
+		if addr.IP != nil {
+			ip := addr.IP.To16()
+			if ip == nil {
+				return nil, 0, fmt.Errorf("%s is not an IPv6 address", addr.IP)
+			}
+			copy(sa6.Addr[:], ip)
+		}
+		sa = sa6
 
-	switch {
-	case len(ip) < net.IPv4len:
-		buf := [4]byte{0, 0, 0, 0}
-		sa =  &syscall.SockaddrInet4{Addr: buf}
+	default:
+		return nil, 0, syscall.EAFNOSUPPORT
+	}
 
+	return SockaddrToRawSockAny(sa)
+}
 
-	case ip.To4() != nil:
-		var buf [4]byte
-		copy(buf[:], ip[12:16])
-		sa = &syscall.SockaddrInet4{Addr: buf}
+//Resolves network and address in form of host:port. Supported networks are udt, udt4 and udt6
+//(ip4 and ip6 are accepted as used by CreateSocket). Returns IP family of the socket which should
+//be created for the address, ip4 or ip6.
 
-	case ip.To16() != nil:
-		var buf [16]byte
-		copy(buf[:], ip)
-		sa = &syscall.SockaddrInet6{Addr: buf, ZoneId: uint32(ipv6ZoneToInt(zone))}
-	}
+func resolveUDTAddr(network, address string) (family string, addr *net.UDPAddr, err error) {
 
-	switch sa := sa.(type) {
-	case *syscall.SockaddrInet4:
-		sa.Port = udpAddr.Port
-	case *syscall.SockaddrInet6:
-		sa.Port = udpAddr.Port
+	var udpNetwork string
+	switch network {
+	case "udt":
+		udpNetwork = "udp"
+	case "udt4", "ip4":
+		udpNetwork = "udp4"
+	case "udt6", "ip6":
+		udpNetwork = "udp6"
 	default:
-		return nil, 0, fmt.Errorf("Error creating socket address")
+		return "", nil, net.UnknownNetworkError(network)
 	}
 
-	rsa, salen, err = SockaddrToRawSockAny(sa)
+	addr, err = net.ResolveUDPAddr(udpNetwork, address)
 	if err != nil {
-		return nil, 0, fmt.Errorf("could not convert syscall.Sockaddr to syscall.RawSockaddrAny %s", err)
+		return "", nil, err
 	}
 
-	return rsa, salen, nil
-
+	switch {
+	case udpNetwork == "udp4":
+		family = "ip4"
+	case udpNetwork == "udp6":
+		family = "ip6"
+	case addr.IP == nil || addr.IP.To4() != nil:
+		family = "ip4"
+	default:
+		family = "ip6"
+	}
+	return family, addr, nil
 }
 
 func ipv6ZoneToInt(zone string) int {
@@ -1061,6 +1313,18 @@ func ipv6ZoneToInt(zone string) int {
 	return n
 }
 
+//Returns IPv6 zone of interface index, the name of the interface if it exists.
+
+func ipv6IntToZone(idx int) string {
+	if idx == 0 {
+		return ""
+	}
+	if ifi, err := net.InterfaceByIndex(idx); err == nil {
+		return ifi.Name
+	}
+	return uitoa(uint(idx))
+}
+
 const big = 0xFFFFFF
 
 
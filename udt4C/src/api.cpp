@@ -119,6 +119,7 @@ m_Sockets(),
 m_ControlLock(),
 m_IDLock(),
 m_SocketID(0),
+m_iMaxPending(0),
 m_TLSError(),
 m_mMultiplexer(),
 m_MultiplexerLock(),
@@ -345,6 +346,8 @@ int CUDTUnited::newConnection(const UDTSOCKET listen, const sockaddr* peer, CHan
          hs->m_iFlightFlagSize = ns->m_pUDT->m_iFlightFlagSize;
          hs->m_iReqType = -1;
          hs->m_iID = ns->m_SocketID;
+         if (NULL != ns->m_pUDT->m_pCrypto)
+            ns->m_pUDT->m_pCrypto->fill(*hs);
 
          return 0;
 
@@ -356,6 +359,10 @@ int CUDTUnited::newConnection(const UDTSOCKET listen, const sockaddr* peer, CHan
    if (ls->m_pQueuedSockets->size() >= ls->m_uiBackLog)
       return -1;
 
+   // exceeding the limit of all listening sockets, the request is dropped and the peer may retry later
+   if (isPendingFull())
+      return -2;
+
    try
    {
       ns = new CUDTSocket;
@@ -390,6 +397,33 @@ int CUDTUnited::newConnection(const UDTSOCKET listen, const sockaddr* peer, CHan
    ns->m_pUDT->m_SocketID = ns->m_SocketID;
    ns->m_PeerID = hs->m_iID;
    ns->m_iISN = hs->m_iISN;
+   ns->m_pUDT->m_strStreamID = hs->m_strStreamID;
+
+   // the application decides about the request, the new socket is registered so that the hook can change its options
+   if (NULL != ls->m_pUDT->m_pAcceptHook)
+   {
+      CGuard::enterCS(m_ControlLock);
+      m_Sockets[ns->m_SocketID] = ns;
+      CGuard::leaveCS(m_ControlLock);
+
+      // the hand shake lock of the listener is held by the caller, the hook runs without it so that it can
+      // change options of the listener, hand shakes are only processed by this thread in the meantime
+      UDT_ACCEPT_HOOK hook = ls->m_pUDT->m_pAcceptHook;
+      void* opaque = ls->m_pUDT->m_pAcceptHookOpaque;
+      CGuard::leaveCS(ls->m_pUDT->m_HSLock);
+      int reason = hook(opaque, listen, ns->m_SocketID, peer, hs->m_strStreamID.data(), hs->m_strStreamID.size());
+      CGuard::enterCS(ls->m_pUDT->m_HSLock);
+      if (0 != reason)
+      {
+         CGuard::enterCS(m_ControlLock);
+         m_Sockets.erase(ns->m_SocketID);
+         CGuard::leaveCS(m_ControlLock);
+
+         delete ns;
+         hs->m_iRejectReason = reason;
+         return -1;
+      }
+   }
 
    int error = 0;
 
@@ -562,6 +596,10 @@ int CUDTUnited::bind(UDTSOCKET u, UDPSOCKET udpsock)
    if (-1 == ::getsockname(udpsock, name, &namelen))
       throw CUDTException(5, 3);
 
+   // the channel uses address size of the UDT socket IP version
+   if (name->sa_family != s->m_iIPversion)
+      throw CUDTException(5, 3, 0);
+
    s->m_pUDT->open();
    updateMux(s, name, &udpsock);
    s->m_Status = OPENED;
@@ -1175,6 +1213,35 @@ CUDTSocket* CUDTUnited::locate(const sockaddr* peer, const UDTSOCKET id, int32_t
    return NULL;
 }
 
+bool CUDTUnited::isPendingFull()
+{
+   CGuard cg(m_ControlLock);
+
+   if (m_iMaxPending <= 0)
+      return false;
+
+   int count = 0;
+   for (map<UDTSOCKET, CUDTSocket*>::iterator i = m_Sockets.begin(); i != m_Sockets.end(); ++ i)
+   {
+      // connections of closed listeners are not accepted any more, they only wait for removal
+      if ((NULL == i->second->m_pQueuedSockets) || i->second->m_pUDT->m_bBroken)
+         continue;
+
+      CGuard::enterCS(i->second->m_AcceptLock);
+      count += i->second->m_pQueuedSockets->size();
+      CGuard::leaveCS(i->second->m_AcceptLock);
+   }
+
+   return count >= m_iMaxPending;
+}
+
+void CUDTUnited::setMaxPending(int max)
+{
+   CGuard cg(m_ControlLock);
+
+   m_iMaxPending = max;
+}
+
 void CUDTUnited::checkBrokenSockets()
 {
    CGuard cg(m_ControlLock);
@@ -1375,14 +1442,15 @@ void CUDTUnited::updateMux(CUDTSocket* s, const sockaddr* addr, const UDPSOCKET*
 {
    CGuard cg(m_ControlLock);
 
-   if ((s->m_pUDT->m_bReuseAddr) && (NULL != addr))
+   // a UDP socket passed by the application always gets its own multiplexer, which closes it
+   if ((s->m_pUDT->m_bReuseAddr) && (NULL != addr) && (NULL == udpsock))
    {
       int port = (AF_INET == s->m_pUDT->m_iIPversion) ? ntohs(((sockaddr_in*)addr)->sin_port) : ntohs(((sockaddr_in6*)addr)->sin6_port);
 
       // find a reusable address
       for (map<int, CMultiplexer>::iterator i = m_mMultiplexer.begin(); i != m_mMultiplexer.end(); ++ i)
       {
-         if ((i->second.m_iIPversion == s->m_pUDT->m_iIPversion) && (i->second.m_iMSS == s->m_pUDT->m_iMSS) && i->second.m_bReusable)
+         if ((i->second.m_iIPversion == s->m_pUDT->m_iIPversion) && (i->second.m_iMSS == s->m_pUDT->m_iMSS) && (i->second.m_iIPv6Only == s->m_pUDT->m_iIPv6Only) && i->second.m_bReusable)
          {
             if (i->second.m_iPort == port)
             {
@@ -1403,11 +1471,13 @@ void CUDTUnited::updateMux(CUDTSocket* s, const sockaddr* addr, const UDPSOCKET*
    m.m_iIPversion = s->m_pUDT->m_iIPversion;
    m.m_iRefCount = 1;
    m.m_bReusable = s->m_pUDT->m_bReuseAddr;
+   m.m_iIPv6Only = s->m_pUDT->m_iIPv6Only;
    m.m_iID = s->m_SocketID;
 
    m.m_pChannel = new CChannel(s->m_pUDT->m_iIPversion);
    m.m_pChannel->setSndBufSize(s->m_pUDT->m_iUDPSndBufSize);
    m.m_pChannel->setRcvBufSize(s->m_pUDT->m_iUDPRcvBufSize);
+   m.m_pChannel->setIPv6Only(s->m_pUDT->m_iIPv6Only);
 
    try
    {
@@ -1418,7 +1488,9 @@ void CUDTUnited::updateMux(CUDTSocket* s, const sockaddr* addr, const UDPSOCKET*
    }
    catch (CUDTException& e)
    {
-      m.m_pChannel->close();
+      // a UDP socket passed by the application is still owned by the application on failure
+      if (NULL == udpsock)
+         m.m_pChannel->close();
       delete m.m_pChannel;
       throw e;
    }
@@ -2152,6 +2224,42 @@ UDTSTATUS CUDT::getsockstate(UDTSOCKET u)
    }
 }
 
+int CUDT::setaccepthook(UDTSOCKET u, UDT_ACCEPT_HOOK hook, void* opaque)
+{
+   try
+   {
+      CUDT* udt = s_UDTUnited.lookup(u);
+
+      // the hook and its argument are replaced together, a call which already started may still use the previous ones
+      CGuard hsguard(udt->m_HSLock);
+      udt->m_pAcceptHook = hook;
+      udt->m_pAcceptHookOpaque = opaque;
+      return 0;
+   }
+   catch (CUDTException e)
+   {
+      s_UDTUnited.setError(new CUDTException(e));
+      return ERROR;
+   }
+   catch (...)
+   {
+      s_UDTUnited.setError(new CUDTException(-1, 0, 0));
+      return ERROR;
+   }
+}
+
+int CUDT::setmaxpending(int max)
+{
+   if (max < 0)
+   {
+      s_UDTUnited.setError(new CUDTException(5, 3, 0));
+      return ERROR;
+   }
+
+   s_UDTUnited.setMaxPending(max);
+   return 0;
+}
+
 
 ////////////////////////////////////////////////////////////////////////////////
 
@@ -2310,7 +2418,9 @@ int epoll_wait(int eid, set<UDTSOCKET>* readfds, set<UDTSOCKET>* writefds, int64
 }
 
 #define SET_RESULT(val, num, fds, it) \
-   if ((val != NULL) && !val->empty()) \
+   if ((val != NULL) && val->empty()) \
+      *num = 0; \
+   else if (val != NULL) \
    { \
       if (*num > static_cast<int>(val->size())) \
          *num = val->size(); \
@@ -2389,4 +2499,14 @@ UDTSTATUS getsockstate(UDTSOCKET u)
    return CUDT::getsockstate(u);
 }
 
+int setmaxpending(int max)
+{
+   return CUDT::setmaxpending(max);
+}
+
+int setaccepthook(UDTSOCKET u, UDT_ACCEPT_HOOK hook, void* opaque)
+{
+   return CUDT::setaccepthook(u, hook, opaque);
+}
+
 }  // namespace UDT
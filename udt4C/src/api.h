@@ -139,10 +139,20 @@ public:
       //    1) [in] peer: peer address.
       //    2) [in/out] hs: handshake information from peer side (in), negotiated value (out);
       // Returned value:
-      //    If the new connection is successfully created: 1 success, 0 already exist, -1 error.
+      //    If the new connection is successfully created: 1 success, 0 already exist, -1 error,
+      //    -2 too many connections are waiting for accept.
 
    int newConnection(const UDTSOCKET listen, const sockaddr* peer, CHandShake* hs);
 
+      // Functionality:
+      //    Set the maximum number of connections waiting for accept on all listening sockets.
+      // Parameters:
+      //    0) [in] max: maximum number of connections, 0 means no limit.
+      // Returned value:
+      //    None.
+
+   void setMaxPending(int max);
+
       // Functionality:
       //    look up the UDT entity according to its ID.
       // Parameters:
@@ -212,6 +222,8 @@ private:
 
    std::map<int64_t, std::set<UDTSOCKET> > m_PeerRec;// record sockets from peers to avoid repeated connection request, int64_t = (socker_id << 30) + isn
 
+   int m_iMaxPending;                                // maximum number of connections waiting for accept on all listening sockets, 0 means no limit, guarded by m_ControlLock
+
 private:
    pthread_key_t m_TLSError;                         // thread local error record (last error)
    #ifndef WIN32
@@ -226,6 +238,7 @@ private:
    void connect_complete(const UDTSOCKET u);
    CUDTSocket* locate(const UDTSOCKET u);
    CUDTSocket* locate(const sockaddr* peer, const UDTSOCKET id, int32_t isn);
+   bool isPendingFull();
    void updateMux(CUDTSocket* s, const sockaddr* addr = NULL, const UDPSOCKET* = NULL);
    void updateMux(CUDTSocket* s, const CUDTSocket* ls);
 
@@ -72,7 +72,8 @@ m_iIPversion(AF_INET),
 m_iSockAddrSize(sizeof(sockaddr_in)),
 m_iSocket(),
 m_iSndBufSize(65536),
-m_iRcvBufSize(65536)
+m_iRcvBufSize(65536),
+m_iIPv6Only(-1)
 {
 }
 
@@ -80,7 +81,8 @@ CChannel::CChannel(int version):
 m_iIPversion(version),
 m_iSocket(),
 m_iSndBufSize(65536),
-m_iRcvBufSize(65536)
+m_iRcvBufSize(65536),
+m_iIPv6Only(-1)
 {
    m_iSockAddrSize = (AF_INET == m_iIPversion) ? sizeof(sockaddr_in) : sizeof(sockaddr_in6);
 }
@@ -101,6 +103,13 @@ void CChannel::open(const sockaddr* addr)
    #endif
       throw CUDTException(1, 0, NET_ERROR);
 
+   // must be set before bind, it decides whether :: also takes IPv4 traffic
+   if ((AF_INET6 == m_iIPversion) && (m_iIPv6Only >= 0))
+   {
+      if (0 != ::setsockopt(m_iSocket, IPPROTO_IPV6, IPV6_V6ONLY, (char*)&m_iIPv6Only, sizeof(int)))
+         throw CUDTException(1, 3, NET_ERROR);
+   }
+
    if (NULL != addr)
    {
       socklen_t namelen = m_iSockAddrSize;
@@ -129,16 +138,18 @@ void CChannel::open(const sockaddr* addr)
       ::freeaddrinfo(res);
    }
 
+   setUDPBufSize();
    setUDPSockOpt();
 }
 
 void CChannel::open(UDPSOCKET udpsock)
 {
+   // buffer sizes of a socket passed by the application are left as it configured them
    m_iSocket = udpsock;
    setUDPSockOpt();
 }
 
-void CChannel::setUDPSockOpt()
+void CChannel::setUDPBufSize()
 {
    #if defined(BSD) || defined(OSX)
       // BSD system will fail setsockopt if the requested buffer size exceeds system maximum value
@@ -153,7 +164,10 @@ void CChannel::setUDPSockOpt()
           (0 != ::setsockopt(m_iSocket, SOL_SOCKET, SO_SNDBUF, (char*)&m_iSndBufSize, sizeof(int))))
          throw CUDTException(1, 3, NET_ERROR);
    #endif
+}
 
+void CChannel::setUDPSockOpt()
+{
    timeval tv;
    tv.tv_sec = 0;
    #if defined (BSD) || defined (OSX)
@@ -175,6 +189,11 @@ void CChannel::setUDPSockOpt()
       if (0 != ::setsockopt(m_iSocket, SOL_SOCKET, SO_RCVTIMEO, (char *)&ot, sizeof(DWORD)))
          throw CUDTException(1, 3, NET_ERROR);
    #else
+      // receiving relies on the time-out, a UDP socket passed by the application may be non-blocking
+      int opts = ::fcntl(m_iSocket, F_GETFL);
+      if (-1 == ::fcntl(m_iSocket, F_SETFL, opts & ~O_NONBLOCK))
+         throw CUDTException(1, 3, NET_ERROR);
+
       // Set receiving time-out value
       if (0 != ::setsockopt(m_iSocket, SOL_SOCKET, SO_RCVTIMEO, (char *)&tv, sizeof(timeval)))
          throw CUDTException(1, 3, NET_ERROR);
@@ -214,12 +233,22 @@ void CChannel::setRcvBufSize(int size)
    m_iRcvBufSize = size;
 }
 
+void CChannel::setIPv6Only(int only)
+{
+   m_iIPv6Only = only;
+}
+
 void CChannel::getSockAddr(sockaddr* addr) const
 {
    socklen_t namelen = m_iSockAddrSize;
    ::getsockname(m_iSocket, addr, &namelen);
 }
 
+UDPSOCKET CChannel::getSocket() const
+{
+   return m_iSocket;
+}
+
 void CChannel::getPeerAddr(sockaddr* addr) const
 {
    socklen_t namelen = m_iSockAddrSize;
@@ -116,6 +116,15 @@ public:
 
    void setRcvBufSize(int size);
 
+      // Functionality:
+      //    Set IPV6_V6ONLY of the UDP socket, applied when the channel opens an IPv6 socket.
+      // Parameters:
+      //    0) [in] only: 1 or 0, -1 keeps the system default.
+      // Returned value:
+      //    None.
+
+   void setIPv6Only(int only);
+
       // Functionality:
       //    Query the socket address that the channel is using.
       // Parameters:
@@ -134,6 +143,15 @@ public:
 
    void getPeerAddr(sockaddr* addr) const;
 
+      // Functionality:
+      //    Query the UDP socket of the channel, it is still owned by the channel.
+      // Parameters:
+      //    None.
+      // Returned value:
+      //    The UDP socket descriptor.
+
+   UDPSOCKET getSocket() const;
+
       // Functionality:
       //    Send a packet to the given address.
       // Parameters:
@@ -155,6 +173,7 @@ public:
    int recvfrom(sockaddr* addr, CPacket& packet) const;
 
 private:
+   void setUDPBufSize();
    void setUDPSockOpt();
 
 private:
@@ -165,6 +184,7 @@ private:
 
    int m_iSndBufSize;                   // UDP sending buffer size
    int m_iRcvBufSize;                   // UDP receiving buffer size
+   int m_iIPv6Only;                     // IPV6_V6ONLY, -1 keeps the system default
 };
 
 
@@ -0,0 +1,200 @@
+/*****************************************************************************
+Copyright (c) 2001 - 2011, The Board of Trustees of the University of Illinois.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the University of Illinois
+  nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+
+/*****************************************************************************
+SYN cookies and hand shake rate limiting of listening sockets
+*****************************************************************************/
+
+#ifndef WIN32
+   #include <arpa/inet.h>
+#endif
+#include <cstring>
+#include <openssl/evp.h>
+#include <openssl/hmac.h>
+#include <openssl/rand.h>
+#include "common.h"
+#include "cookie.h"
+
+using namespace std;
+
+const uint64_t CSynCookie::m_ullRotateInterval = 60000000;
+const int CHSLimiter::m_iDefaultRate = 0;
+const int CHSLimiter::m_iMaxSources = 4096;
+
+// Returns the IP address and port of addr as bytes in network order.
+static string addrBytes(const sockaddr* addr, int ipversion)
+{
+   if (AF_INET == ipversion)
+   {
+      const sockaddr_in* a = (const sockaddr_in*)addr;
+      return string((const char*)&a->sin_addr, 4) + string((const char*)&a->sin_port, 2);
+   }
+
+   const sockaddr_in6* a = (const sockaddr_in6*)addr;
+   return string((const char*)&a->sin6_addr, 16) + string((const char*)&a->sin6_port, 2);
+}
+
+CSynCookie::CSynCookie()
+{
+   RAND_bytes(m_pcSecret, sizeof(m_pcSecret));
+   RAND_bytes(m_pcPrevSecret, sizeof(m_pcPrevSecret));
+   m_ullRotateTime = CTimer::getTime() + m_ullRotateInterval;
+}
+
+CSynCookie::~CSynCookie()
+{
+   memset(m_pcSecret, 0, sizeof(m_pcSecret));
+   memset(m_pcPrevSecret, 0, sizeof(m_pcPrevSecret));
+}
+
+void CSynCookie::bake(const sockaddr* addr, int ipversion, CHandShake& hs)
+{
+   if (CTimer::getTime() >= m_ullRotateTime)
+      rotate();
+
+   uint32_t cookie[4];
+   compute(m_pcSecret, addr, ipversion, cookie);
+
+   hs.m_iCookie = cookie[0];
+   hs.m_bLongCookie = true;
+   for (int i = 0; i < 3; ++ i)
+      hs.m_piLongCookie[i] = cookie[i + 1];
+}
+
+bool CSynCookie::check(const sockaddr* addr, int ipversion, const CHandShake& hs)
+{
+   if (CTimer::getTime() >= m_ullRotateTime)
+      rotate();
+
+   const unsigned char* secrets[2] = {m_pcSecret, m_pcPrevSecret};
+   for (int s = 0; s < 2; ++ s)
+   {
+      uint32_t cookie[4];
+      compute(secrets[s], addr, ipversion, cookie);
+
+      // peers without the cookie extension, such as stock UDT4, only return the lower 32 bits
+      uint32_t diff = cookie[0] ^ (uint32_t)hs.m_iCookie;
+      if (hs.m_bLongCookie)
+      {
+         for (int i = 0; i < 3; ++ i)
+            diff |= cookie[i + 1] ^ hs.m_piLongCookie[i];
+      }
+
+      if (0 == diff)
+         return true;
+   }
+
+   return false;
+}
+
+void CSynCookie::rotate()
+{
+   memcpy(m_pcPrevSecret, m_pcSecret, sizeof(m_pcSecret));
+   RAND_bytes(m_pcSecret, sizeof(m_pcSecret));
+   m_ullRotateTime = CTimer::getTime() + m_ullRotateInterval;
+}
+
+void CSynCookie::compute(const unsigned char* secret, const sockaddr* addr, int ipversion, uint32_t* cookie) const
+{
+   string msg = addrBytes(addr, ipversion);
+
+   unsigned char digest[EVP_MAX_MD_SIZE];
+   unsigned int len = 0;
+   HMAC(EVP_sha256(), secret, sizeof(m_pcSecret), (const unsigned char*)msg.data(), msg.size(), digest, &len);
+
+   for (int i = 0; i < 4; ++ i)
+      cookie[i] = ((uint32_t)digest[i * 4] << 24) | ((uint32_t)digest[i * 4 + 1] << 16) | ((uint32_t)digest[i * 4 + 2] << 8) | digest[i * 4 + 3];
+}
+
+CHSLimiter::CHSLimiter():
+m_mBuckets(),
+m_iRate(m_iDefaultRate)
+{
+}
+
+void CHSLimiter::setRate(int rate)
+{
+   m_iRate = rate;
+   m_mBuckets.clear();
+}
+
+bool CHSLimiter::allow(const sockaddr* addr, int ipversion)
+{
+   if (m_iRate <= 0)
+      return true;
+
+   // the port is left out, a flood from many ports of one host shares one bucket
+   string source = addrBytes(addr, ipversion);
+   source.resize(source.size() - 2);
+
+   uint64_t now = CTimer::getTime();
+   map<string, CBucket>::iterator b = m_mBuckets.find(source);
+   if (b == m_mBuckets.end())
+   {
+      if ((int)m_mBuckets.size() >= m_iMaxSources)
+      {
+         // forget sources whose bucket has refilled, they are the same as new ones
+         for (map<string, CBucket>::iterator i = m_mBuckets.begin(); i != m_mBuckets.end();)
+         {
+            if (i->second.m_dTokens + double(now - i->second.m_ullLastTime) * m_iRate / 1000000 >= m_iRate)
+               m_mBuckets.erase(i ++);
+            else
+               ++ i;
+         }
+
+         if ((int)m_mBuckets.size() >= m_iMaxSources)
+            m_mBuckets.erase(m_mBuckets.begin());
+      }
+
+      CBucket full;
+      full.m_dTokens = m_iRate;
+      full.m_ullLastTime = now;
+      b = m_mBuckets.insert(make_pair(source, full)).first;
+   }
+
+   CBucket& bucket = b->second;
+   bucket.m_dTokens += double(now - bucket.m_ullLastTime) * m_iRate / 1000000;
+   if (bucket.m_dTokens > m_iRate)
+      bucket.m_dTokens = m_iRate;
+   bucket.m_ullLastTime = now;
+
+   if (bucket.m_dTokens < 1)
+      return false;
+
+   bucket.m_dTokens -= 1;
+
+   return true;
+}
@@ -0,0 +1,144 @@
+/*****************************************************************************
+Copyright (c) 2001 - 2011, The Board of Trustees of the University of Illinois.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the University of Illinois
+  nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+
+/*****************************************************************************
+SYN cookies and hand shake rate limiting of listening sockets
+*****************************************************************************/
+
+#ifndef __UDT_COOKIE_H__
+#define __UDT_COOKIE_H__
+
+
+#include <map>
+#include <string>
+#include "udt.h"
+#include "packet.h"
+
+class CSynCookie
+{
+public:
+   CSynCookie();
+   ~CSynCookie();
+
+public:
+
+      // Functionality:
+      //    Put the cookie of a peer address into a hand shake.
+      // Parameters:
+      //    0) [in] addr: peer address.
+      //    1) [in] ipversion: IP version of the address.
+      //    2) [out] hs: the hand shake response.
+      // Returned value:
+      //    None.
+
+   void bake(const sockaddr* addr, int ipversion, CHandShake& hs);
+
+      // Functionality:
+      //    Check the cookie returned by a peer.
+      // Parameters:
+      //    0) [in] addr: peer address.
+      //    1) [in] ipversion: IP version of the address.
+      //    2) [in] hs: the hand shake request.
+      // Returned value:
+      //    true if the cookie was made for the address with the current or the previous secret, only its lower
+      //    32 bits are compared if the peer does not support the cookie extension.
+
+   bool check(const sockaddr* addr, int ipversion, const CHandShake& hs);
+
+      // Functionality:
+      //    Replace the secret now, cookies made with the current secret stay valid until the next rotation.
+      // Parameters:
+      //    None.
+      // Returned value:
+      //    None.
+
+   void rotate();
+
+public:
+   static const uint64_t m_ullRotateInterval;	// the secret is replaced at this interval, in microseconds
+
+private:
+   void compute(const unsigned char* secret, const sockaddr* addr, int ipversion, uint32_t* cookie) const;
+
+private:
+   unsigned char m_pcSecret[32];		// HMAC-SHA256 key of new cookies
+   unsigned char m_pcPrevSecret[32];		// previous key, cookies made with it are still accepted
+   uint64_t m_ullRotateTime;			// time of the next rotation
+};
+
+class CHSLimiter
+{
+public:
+   CHSLimiter();
+
+public:
+
+      // Functionality:
+      //    Set the number of hand shakes allowed from one source IP address per second.
+      // Parameters:
+      //    0) [in] rate: hand shakes per second, also the burst size, 0 means no limit.
+      // Returned value:
+      //    None.
+
+   void setRate(int rate);
+
+      // Functionality:
+      //    Take a token of the source address of a hand shake.
+      // Parameters:
+      //    0) [in] addr: source address.
+      //    1) [in] ipversion: IP version of the address.
+      // Returned value:
+      //    true if the hand shake is within the limit.
+
+   bool allow(const sockaddr* addr, int ipversion);
+
+public:
+   static const int m_iDefaultRate;		// default hand shakes per second from one source, 0 so that limiting is opt-in
+   static const int m_iMaxSources;		// maximum number of tracked source addresses
+
+private:
+   struct CBucket
+   {
+      double m_dTokens;				// tokens left
+      uint64_t m_ullLastTime;			// time the tokens were last updated
+   };
+
+   std::map<std::string, CBucket> m_mBuckets;	// token buckets of source IP addresses
+   int m_iRate;					// hand shakes per second from one source, 0 means no limit
+};
+
+
+#endif
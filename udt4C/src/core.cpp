@@ -115,12 +115,26 @@ CUDT::CUDT()
    m_iSndTimeOut = -1;
    m_iRcvTimeOut = -1;
    m_bReuseAddr = true;
+   m_iIPv6Only = -1;
    m_llMaxBW = -1;
+   m_iMaxMsgSize = 0;
+   m_iMsgTTL = -1;
+   m_iHSRate = CHSLimiter::m_iDefaultRate;
 
    m_pCCFactory = new CCCFactory<CUDTCC>;
    m_pCC = NULL;
    m_pCache = NULL;
 
+   m_pCrypto = NULL;
+   m_pAuth = NULL;
+
+   m_pSynCookie = NULL;
+   m_pHSLimiter = NULL;
+   m_llHSDropped = m_llHSLimited = 0;
+   m_pAcceptHook = NULL;
+   m_pAcceptHookOpaque = NULL;
+   m_iRejectReason = 0;
+
    // Initial status
    m_bOpened = false;
    m_bListening = false;
@@ -168,12 +182,27 @@ CUDT::CUDT(const CUDT& ancestor)
    m_iSndTimeOut = ancestor.m_iSndTimeOut;
    m_iRcvTimeOut = ancestor.m_iRcvTimeOut;
    m_bReuseAddr = true;	// this must be true, because all accepted sockets shared the same port with the listener
+   m_iIPv6Only = ancestor.m_iIPv6Only;
    m_llMaxBW = ancestor.m_llMaxBW;
+   m_iMaxMsgSize = ancestor.m_iMaxMsgSize;
+   m_iMsgTTL = ancestor.m_iMsgTTL;
+   m_iHSRate = ancestor.m_iHSRate;
 
    m_pCCFactory = ancestor.m_pCCFactory->clone();
    m_pCC = NULL;
    m_pCache = ancestor.m_pCache;
 
+   m_pCrypto = (NULL != ancestor.m_pCrypto) ? new CCrypto(*ancestor.m_pCrypto) : NULL;
+   m_pAuth = (NULL != ancestor.m_pAuth) ? new CPreSharedKeys(*ancestor.m_pAuth) : NULL;
+
+   // accepted sockets never listen
+   m_pSynCookie = NULL;
+   m_pHSLimiter = NULL;
+   m_llHSDropped = m_llHSLimited = 0;
+   m_pAcceptHook = NULL;
+   m_pAcceptHookOpaque = NULL;
+   m_iRejectReason = 0;
+
    // Initial status
    m_bOpened = false;
    m_bListening = false;
@@ -201,12 +230,16 @@ CUDT::~CUDT()
    delete m_pRcvTimeWindow;
    delete m_pCCFactory;
    delete m_pCC;
+   delete m_pCrypto;
+   delete m_pAuth;
+   delete m_pSynCookie;
+   delete m_pHSLimiter;
    delete m_pPeerAddr;
    delete m_pSNode;
    delete m_pRNode;
 }
 
-void CUDT::setOpt(UDTOpt optName, const void* optval, int)
+void CUDT::setOpt(UDTOpt optName, const void* optval, int optlen)
 {
    if (m_bBroken || m_bClosing)
       throw CUDTException(2, 1, 0);
@@ -342,10 +375,111 @@ void CUDT::setOpt(UDTOpt optName, const void* optval, int)
       m_bReuseAddr = *(bool*)optval;
       break;
 
+   case UDT_IPV6ONLY:
+      if (m_bOpened)
+         throw CUDTException(5, 1, 0);
+
+      if ((*(int*)optval < -1) || (*(int*)optval > 1))
+         throw CUDTException(5, 3, 0);
+
+      m_iIPv6Only = *(int*)optval;
+      break;
+
    case UDT_MAXBW:
       m_llMaxBW = *(int64_t*)optval;
       break;
-    
+
+   case UDT_MAXMSG:
+      if (*(int*)optval < 0)
+         throw CUDTException(5, 3, 0);
+
+      m_iMaxMsgSize = *(int*)optval;
+      break;
+
+   case UDT_MSGTTL:
+      m_iMsgTTL = *(int*)optval;
+      break;
+
+   case UDT_PASSPHRASE:
+   case UDT_CRYPTOKEY:
+   {
+      if (m_bConnecting || m_bConnected)
+         throw CUDTException(5, 1, 0);
+
+      // an empty key turns encryption off
+      CCrypto* crypto = NULL;
+      if (optlen > 0)
+      {
+         crypto = new CCrypto;
+         int res = (UDT_PASSPHRASE == optName) ? crypto->setPassphrase((const char*)optval, optlen) : crypto->setKey((const char*)optval, optlen);
+         if (res < 0)
+         {
+            delete crypto;
+            throw CUDTException(5, 3, 0);
+         }
+      }
+      else if (optlen < 0)
+         throw CUDTException(5, 3, 0);
+
+      delete m_pCrypto;
+      m_pCrypto = crypto;
+
+      break;
+   }
+
+   case UDT_PSK:
+   {
+      if (m_bConnecting || m_bConnected)
+         throw CUDTException(5, 1, 0);
+
+      // empty key set turns authentication off, a listening socket can change its keys at any time
+      CPreSharedKeys* auth = NULL;
+      if (optlen > 0)
+      {
+         auth = new CPreSharedKeys;
+         if (auth->set((const char*)optval, optlen) < 0)
+         {
+            delete auth;
+            throw CUDTException(5, 3, 0);
+         }
+      }
+      else if (optlen < 0)
+         throw CUDTException(5, 3, 0);
+
+      CGuard hsguard(m_HSLock);
+      delete m_pAuth;
+      m_pAuth = auth;
+
+      break;
+   }
+
+   case UDT_STREAMID:
+      if (m_bConnecting || m_bConnected)
+         throw CUDTException(5, 1, 0);
+
+      if ((optlen < 0) || (optlen > CHandShake::m_iMaxStreamID))
+         throw CUDTException(5, 3, 0);
+
+      if (optlen > 0)
+         m_strStreamID.assign((const char*)optval, optlen);
+      else
+         m_strStreamID.clear();
+      break;
+
+   case UDT_HSRATE:
+   {
+      if (*(int*)optval < 0)
+         throw CUDTException(5, 3, 0);
+
+      // a listening socket can change the rate at any time
+      CGuard hsguard(m_HSLock);
+      m_iHSRate = *(int*)optval;
+      if (NULL != m_pHSLimiter)
+         m_pHSLimiter->setRate(m_iHSRate);
+
+      break;
+   }
+
    default:
       throw CUDTException(5, 0, 0);
    }
@@ -433,11 +567,26 @@ void CUDT::getOpt(UDTOpt optName, void* optval, int& optlen)
       optlen = sizeof(bool);
       break;
 
+   case UDT_IPV6ONLY:
+      *(int*)optval = m_iIPv6Only;
+      optlen = sizeof(int);
+      break;
+
    case UDT_MAXBW:
       *(int64_t*)optval = m_llMaxBW;
       optlen = sizeof(int64_t);
       break;
 
+   case UDT_MAXMSG:
+      *(int*)optval = m_iMaxMsgSize;
+      optlen = sizeof(int);
+      break;
+
+   case UDT_MSGTTL:
+      *(int*)optval = m_iMsgTTL;
+      optlen = sizeof(int);
+      break;
+
    case UDT_STATE:
       *(int32_t*)optval = s_UDTUnited.getStatus(m_SocketID);
       optlen = sizeof(int32_t);
@@ -476,6 +625,67 @@ void CUDT::getOpt(UDTOpt optName, void* optval, int& optlen)
       optlen = sizeof(int32_t);
       break;
 
+   case UDT_PASSPHRASE:
+   case UDT_CRYPTOKEY:
+      // the key itself is never returned, only its length, 0 if encryption is off
+      *(int*)optval = (NULL != m_pCrypto) ? m_pCrypto->getKeyLength() : 0;
+      optlen = sizeof(int);
+      break;
+
+   case UDT_PSK:
+   {
+      // keys are never returned, only their number
+      CGuard hsguard(m_HSLock);
+      *(int*)optval = (NULL != m_pAuth) ? m_pAuth->getCount() : 0;
+      optlen = sizeof(int);
+      break;
+   }
+
+   case UDT_STREAMID:
+      if (optlen < (int)m_strStreamID.size())
+         throw CUDTException(5, 3, 0);
+
+      memcpy(optval, m_strStreamID.data(), m_strStreamID.size());
+      optlen = m_strStreamID.size();
+      break;
+
+   case UDT_REJECTREASON:
+      *(int32_t*)optval = m_iRejectReason;
+      optlen = sizeof(int32_t);
+      break;
+
+   case UDT_UDPSOCK:
+      if (!m_bOpened)
+         throw CUDTException(5, 5, 0);
+
+      if (optlen < (int)sizeof(UDPSOCKET))
+         throw CUDTException(5, 3, 0);
+
+      *(UDPSOCKET*)optval = m_pSndQueue->m_pChannel->getSocket();
+      optlen = sizeof(UDPSOCKET);
+      break;
+
+   case UDT_HSRATE:
+      *(int*)optval = m_iHSRate;
+      optlen = sizeof(int);
+      break;
+
+   case UDT_HSDROPPED:
+   {
+      CGuard hsguard(m_HSLock);
+      *(int64_t*)optval = m_llHSDropped;
+      optlen = sizeof(int64_t);
+      break;
+   }
+
+   case UDT_HSLIMITED:
+   {
+      CGuard hsguard(m_HSLock);
+      *(int64_t*)optval = m_llHSLimited;
+      optlen = sizeof(int64_t);
+      break;
+   }
+
    default:
       throw CUDTException(5, 0, 0);
    }
@@ -560,6 +770,15 @@ void CUDT::listen()
    if (m_bListening)
       return;
 
+   // hand shakes are checked with a SYN cookie and limited per source address before any state is kept for them
+   if (NULL == m_pSynCookie)
+   {
+      CGuard hsguard(m_HSLock);
+      m_pSynCookie = new CSynCookie;
+      m_pHSLimiter = new CHSLimiter;
+      m_pHSLimiter->setRate(m_iHSRate);
+   }
+
    // if there is already another socket listening on the same port
    if (m_pRcvQueue->setListener(this) < 0)
       throw CUDTException(5, 11, 0);
@@ -602,6 +821,14 @@ void CUDT::connect(const sockaddr* serv_addr)
    m_ConnReq.m_iID = m_SocketID;
    CIPAddress::ntop(serv_addr, m_ConnReq.m_piPeerIP, m_iIPversion);
 
+   // announce the encryption key, the peer rejects the request if its key is different
+   m_ConnReq.m_iCryptoKeyLen = 0;
+   if (NULL != m_pCrypto)
+      m_pCrypto->fill(m_ConnReq);
+
+   // application data for the listener to decide about the connection
+   m_ConnReq.m_strStreamID = m_strStreamID;
+
    // Random Initial Sequence Number
    srand((unsigned int)CTimer::getTime());
    m_iISN = m_ConnReq.m_iISN = (int32_t)(CSeqNo::m_iMaxSeqNo * (double(rand()) / RAND_MAX));
@@ -613,6 +840,11 @@ void CUDT::connect(const sockaddr* serv_addr)
    m_iSndLastAck2 = m_iISN;
    m_ullSndLastAck2Time = CTimer::getTime();
 
+   // sign the request, listeners with pre-shared keys drop unsigned requests
+   m_ConnReq.m_iAuthKeyID = -1;
+   if (NULL != m_pAuth)
+      m_pAuth->sign(m_ConnReq);
+
    // Inform the server my configurations.
    CPacket request;
    char* reqdata = new char [m_iPayloadSize];
@@ -658,11 +890,13 @@ void CUDT::connect(const sockaddr* serv_addr)
       response.setLength(m_iPayloadSize);
       if (m_pRcvQueue->recvfrom(m_SocketID, response) > 0)
       {
-         if (connect(response) <= 0)
+         int res = connect(response);
+         if (res <= 0)
             break;
 
          // new request/response should be sent out immediately on receving a response
-         m_llLastReqTime = 0;
+         if (1 == res)
+            m_llLastReqTime = 0;
       }
 
       if (CTimer::getTime() > ttl)
@@ -694,7 +928,8 @@ int CUDT::connect(const CPacket& response) throw ()
 {
    // this is the 2nd half of a connection request. If the connection is setup successfully this returns 0.
    // returning -1 means there is an error.
-   // returning 1 or 2 means the connection is in process and needs more handshake
+   // returning 1 means the connection is in process and needs more handshake
+   // returning 2 means the response has been ignored
 
    if (!m_bConnecting)
       return -1;
@@ -709,7 +944,13 @@ int CUDT::connect(const CPacket& response) throw ()
    if ((1 != response.getFlag()) || (0 != response.getType()))
       return -1;
 
-   m_ConnRes.deserialize(response.m_pcData, response.getLength());
+   {
+      // with pre-shared keys, responses that fail verification are ignored
+      CHandShake res;
+      if ((res.deserialize(response.m_pcData, response.getLength()) < 0) || ((NULL != m_pAuth) && !m_pAuth->verify(res)))
+         return 2;
+      m_ConnRes = res;
+   }
 
    if (m_bRendezvous)
    {
@@ -721,6 +962,8 @@ int CUDT::connect(const CPacket& response) throw ()
       if ((0 == m_ConnReq.m_iReqType) || (0 == m_ConnRes.m_iReqType))
       {
          m_ConnReq.m_iReqType = -1;
+         if (NULL != m_pAuth)
+            m_pAuth->sign(m_ConnReq);
          // the request time must be updated so that the next handshake can be sent out immediately.
          m_llLastReqTime = 0;
          return 1;
@@ -733,12 +976,35 @@ int CUDT::connect(const CPacket& response) throw ()
       {
          m_ConnReq.m_iReqType = -1;
          m_ConnReq.m_iCookie = m_ConnRes.m_iCookie;
+         m_ConnReq.m_bLongCookie = m_ConnRes.m_bLongCookie;
+         for (int i = 0; i < 3; ++ i)
+            m_ConnReq.m_piLongCookie[i] = m_ConnRes.m_piLongCookie[i];
+         if (NULL != m_pAuth)
+            m_pAuth->sign(m_ConnReq);
          m_llLastReqTime = 0;
          return 1;
       }
    }
 
 POST_CONNECT:
+   // the peer rejected the request, or its encryption key does not match the local one
+   if ((1002 == m_ConnRes.m_iReqType) || !checkCrypto(m_ConnRes) || ((NULL != m_pCrypto) && (m_pCrypto->start(m_ConnRes, m_iISN, m_ConnRes.m_iISN) < 0)))
+   {
+      m_iRejectReason = (1002 == m_ConnRes.m_iReqType) ? m_ConnRes.m_iRejectReason : 0;
+      m_ConnRes.m_iReqType = 1002;
+      m_pRcvQueue->removeConnector(m_SocketID);
+      m_bConnecting = false;
+
+      // asynchronous connect, acknowledge app via epoll
+      if (!m_bSynRecving)
+      {
+         m_bBroken = true;
+         s_UDTUnited.m_EPoll.update_events(m_SocketID, m_sPollID, UDT_EPOLL_ERR, true);
+      }
+
+      return -1;
+   }
+
    // Remove from rendezvous queue
    m_pRcvQueue->removeConnector(m_SocketID);
 
@@ -747,6 +1013,8 @@ POST_CONNECT:
    m_iFlowWindowSize = m_ConnRes.m_iFlightFlagSize;
    m_iPktSize = m_iMSS - 28;
    m_iPayloadSize = m_iPktSize - CPacket::m_iPktHdrSize;
+   if (NULL != m_pCrypto)
+      m_iPayloadSize -= CCrypto::m_iTagSize;
    m_iPeerISN = m_ConnRes.m_iISN;
    m_iRcvLastAck = m_ConnRes.m_iISN;
    m_iRcvLastAckAck = m_ConnRes.m_iISN;
@@ -853,6 +1121,15 @@ void CUDT::connect(const sockaddr* peer, CHandShake* hs)
    m_iPktSize = m_iMSS - 28;
    m_iPayloadSize = m_iPktSize - CPacket::m_iPktHdrSize;
 
+   // derive the session keys from the peer's salt, then answer with our own
+   if (NULL != m_pCrypto)
+   {
+      m_iPayloadSize -= CCrypto::m_iTagSize;
+      if (m_pCrypto->start(*hs, m_iISN, m_iPeerISN) < 0)
+         throw CUDTException(3, 2, 0);
+      m_pCrypto->fill(*hs);
+   }
+
    // Prepare all structures
    try
    {
@@ -901,9 +1178,13 @@ void CUDT::connect(const sockaddr* peer, CHandShake* hs)
    m_pRNode->m_bOnList = true;
    m_pRcvQueue->setNewEntry(this);
 
+   // sign the response with the key the request was signed with
+   if (NULL != m_pAuth)
+      m_pAuth->sign(*hs, hs->m_iAuthKeyID);
+
    //send the response to the peer, see listen() for more discussions about this
    CPacket response;
-   int size = CHandShake::m_iContentSize;
+   int size = m_iPayloadSize;
    char* buffer = new char[size];
    hs->serialize(buffer, size);
    response.pack(0, NULL, buffer, size);
@@ -979,8 +1260,9 @@ void CUDT::close()
       m_bListening = false;
       m_pRcvQueue->removeListener(this);
    }
-   else if (m_bConnecting)
+   else if ((m_bConnecting || !m_bConnected) && (NULL != m_pRcvQueue))
    {
+      // a connect that timed out is no longer connecting, but still registered
       m_pRcvQueue->removeConnector(m_SocketID);
    }
 
@@ -1220,9 +1502,13 @@ int CUDT::sendmsg(const char* data, int len, int msttl, bool inorder)
    if (len <= 0)
       return 0;
 
-   if (len > m_iSndBufSize * m_iPayloadSize)
+   if ((len > m_iSndBufSize * m_iPayloadSize) || ((m_iMaxMsgSize > 0) && (len > m_iMaxMsgSize)))
       throw CUDTException(5, 12, 0);
 
+   // negative TTL means the socket default set by UDT_MSGTTL
+   if (msttl < 0)
+      msttl = m_iMsgTTL;
+
    CGuard sendguard(m_SendLock);
 
    if (m_pSndBuffer->getCurrBufSize() == 0)
@@ -1672,6 +1958,7 @@ void CUDT::initSynch()
       pthread_mutex_init(&m_RecvLock, NULL);
       pthread_mutex_init(&m_AckLock, NULL);
       pthread_mutex_init(&m_ConnectionLock, NULL);
+      pthread_mutex_init(&m_HSLock, NULL);
    #else
       m_SendBlockLock = CreateMutex(NULL, false, NULL);
       m_SendBlockCond = CreateEvent(NULL, false, false, NULL);
@@ -1681,6 +1968,7 @@ void CUDT::initSynch()
       m_RecvLock = CreateMutex(NULL, false, NULL);
       m_AckLock = CreateMutex(NULL, false, NULL);
       m_ConnectionLock = CreateMutex(NULL, false, NULL);
+      m_HSLock = CreateMutex(NULL, false, NULL);
    #endif
 }
 
@@ -1695,6 +1983,7 @@ void CUDT::destroySynch()
       pthread_mutex_destroy(&m_RecvLock);
       pthread_mutex_destroy(&m_AckLock);
       pthread_mutex_destroy(&m_ConnectionLock);
+      pthread_mutex_destroy(&m_HSLock);
    #else
       CloseHandle(m_SendBlockLock);
       CloseHandle(m_SendBlockCond);
@@ -1704,6 +1993,7 @@ void CUDT::destroySynch()
       CloseHandle(m_RecvLock);
       CloseHandle(m_AckLock);
       CloseHandle(m_ConnectionLock);
+      CloseHandle(m_HSLock);
    #endif
 }
 
@@ -1916,7 +2206,7 @@ void CUDT::sendCtrl(int pkttype, void* lparam, void* rparam, int size)
       break;
 
    case 0: //000 - Handshake
-      ctrlpkt.pack(pkttype, NULL, rparam, sizeof(CHandShake));
+      ctrlpkt.pack(pkttype, NULL, rparam, size);
       ctrlpkt.m_iID = m_PeerID;
       m_pSndQueue->sendto(m_pPeerAddr, ctrlpkt);
 
@@ -2201,6 +2491,10 @@ void CUDT::processCtrl(CPacket& ctrlpkt)
          initdata.m_iFlightFlagSize = m_iFlightFlagSize;
          initdata.m_iReqType = (!m_bRendezvous) ? -1 : -2;
          initdata.m_iID = m_SocketID;
+         if (NULL != m_pCrypto)
+            m_pCrypto->fill(initdata);
+         if (NULL != m_pAuth)
+            m_pAuth->sign(initdata);
 
          char* hs = new char [m_iPayloadSize];
          int hs_size = m_iPayloadSize;
@@ -2221,6 +2515,9 @@ void CUDT::processCtrl(CPacket& ctrlpkt)
       // Signal the sender and recver if they are waiting for data.
       releaseSynch();
 
+      // same as broken connection, let epoll users learn about the shutdown
+      s_UDTUnited.m_EPoll.update_events(m_SocketID, m_sPollID, UDT_EPOLL_IN | UDT_EPOLL_OUT | UDT_EPOLL_ERR, true);
+
       CTimer::triggerEvent();
 
       break;
@@ -2347,6 +2644,10 @@ int CUDT::packData(CPacket& packet, uint64_t& ts)
    packet.m_iID = m_PeerID;
    packet.setLength(payload);
 
+   // the payload is sealed into a separate buffer, the sender buffer keeps the plain data for retransmission
+   if ((NULL != m_pCrypto) && (m_pCrypto->encrypt(packet) < 0))
+      return 0;
+
    m_pCC->onPktSent(&packet);
    //m_pSndTimeWindow->onPktSent(packet.m_iTimeStamp);
 
@@ -2386,6 +2687,10 @@ int CUDT::processData(CUnit* unit)
 {
    CPacket& packet = unit->m_Packet;
 
+   // forged or corrupted packets are dropped before they change any state
+   if ((NULL != m_pCrypto) && (m_pCrypto->decrypt(packet) < 0))
+      return -1;
+
    // Just heard from the peer, reset the expiration count.
    m_iEXPCount = 1;
    uint64_t currtime;
@@ -2452,42 +2757,53 @@ int CUDT::listen(sockaddr* addr, CPacket& packet)
    if (m_bClosing)
       return 1002;
 
-   if (packet.getLength() != CHandShake::m_iContentSize)
+   // a closed listener is still registered until it is removed, hand shakes are dropped without
+   // response so that they are retried and reach a listener sharing the UDP socket, if there is one
+   if (m_bBroken)
+      return -1;
+
+   if (packet.getLength() < CHandShake::m_iContentSize)
       return 1004;
 
+   CGuard hsguard(m_HSLock);
+
+   // hand shakes beyond the rate of their source are dropped before any other work is done for them
+   if (!m_pHSLimiter->allow(addr, m_iIPversion))
+   {
+      ++ m_llHSLimited;
+      return -1;
+   }
+
    CHandShake hs;
    hs.deserialize(packet.m_pcData, packet.getLength());
 
-   // SYN cookie
-   char clienthost[NI_MAXHOST];
-   char clientport[NI_MAXSERV];
-   getnameinfo(addr, (AF_INET == m_iVersion) ? sizeof(sockaddr_in) : sizeof(sockaddr_in6), clienthost, sizeof(clienthost), clientport, sizeof(clientport), NI_NUMERICHOST|NI_NUMERICSERV);
-   int64_t timestamp = (CTimer::getTime() - m_StartTime) / 60000000; // secret changes every one minute
-   stringstream cookiestr;
-   cookiestr << clienthost << ":" << clientport << ":" << timestamp;
-   unsigned char cookie[16];
-   CMD5::compute(cookiestr.str().c_str(), cookie);
+   // with pre-shared keys, hand shakes that fail verification are dropped without any response,
+   // responses are signed with the key of the request
+   if (NULL == m_pAuth)
+      hs.m_iAuthKeyID = -1;
+   else if (!m_pAuth->verify(hs))
+   {
+      ++ m_llHSDropped;
+      return -1;
+   }
 
+   // SYN cookie, the peer must return it before any state is kept for the connection
    if (1 == hs.m_iReqType)
    {
-      hs.m_iCookie = *(int*)cookie;
+      m_pSynCookie->bake(addr, m_iIPversion, hs);
+      if (NULL != m_pAuth)
+         m_pAuth->sign(hs, hs.m_iAuthKeyID);
       packet.m_iID = hs.m_iID;
-      int size = packet.getLength();
+      int size = m_iPayloadSize;
       hs.serialize(packet.m_pcData, size);
+      packet.setLength(size);
       m_pSndQueue->sendto(addr, packet);
       return 0;
    }
-   else
+   else if (!m_pSynCookie->check(addr, m_iIPversion, hs))
    {
-      if (hs.m_iCookie != *(int*)cookie)
-      {
-         timestamp --;
-         cookiestr << clienthost << ":" << clientport << ":" << timestamp;
-         CMD5::compute(cookiestr.str().c_str(), cookie);
-
-         if (hs.m_iCookie != *(int*)cookie)
-            return -1;
-      }
+      ++ m_llHSDropped;
+      return -1;
    }
 
    int32_t id = hs.m_iID;
@@ -2495,18 +2811,28 @@ int CUDT::listen(sockaddr* addr, CPacket& packet)
    // When a peer side connects in...
    if ((1 == packet.getFlag()) && (0 == packet.getType()))
    {
-      if ((hs.m_iVersion != m_iVersion) || (hs.m_iType != m_iSockType))
+      if ((hs.m_iVersion != m_iVersion) || (hs.m_iType != m_iSockType) || !checkCrypto(hs))
       {
          // mismatch, reject the request
          hs.m_iReqType = 1002;
-         int size = CHandShake::m_iContentSize;
+         if (NULL != m_pAuth)
+            m_pAuth->sign(hs, hs.m_iAuthKeyID);
+         int size = m_iPayloadSize;
          hs.serialize(packet.m_pcData, size);
+         packet.setLength(size);
          packet.m_iID = id;
          m_pSndQueue->sendto(addr, packet);
       }
       else
       {
          int result = s_UDTUnited.newConnection(m_SocketID, addr, &hs);
+         if (-2 == result)
+         {
+            // too many connections are waiting for accept, the peer keeps retrying until it times out
+            ++ m_llHSLimited;
+            return -1;
+         }
+
          if (result == -1)
             hs.m_iReqType = 1002;
 
@@ -2514,8 +2840,11 @@ int CUDT::listen(sockaddr* addr, CPacket& packet)
          // new connection response should be sent in connect()
          if (result != 1)
          {
-            int size = CHandShake::m_iContentSize;
+            if (NULL != m_pAuth)
+               m_pAuth->sign(hs, hs.m_iAuthKeyID);
+            int size = m_iPayloadSize;
             hs.serialize(packet.m_pcData, size);
+            packet.setLength(size);
             packet.m_iID = id;
             m_pSndQueue->sendto(addr, packet);
          }
@@ -2530,6 +2859,15 @@ int CUDT::listen(sockaddr* addr, CPacket& packet)
    return hs.m_iReqType;
 }
 
+bool CUDT::checkCrypto(const CHandShake& hs) const
+{
+   // either both sides encrypt with the same key or neither does
+   if (NULL == m_pCrypto)
+      return 0 == hs.m_iCryptoKeyLen;
+
+   return m_pCrypto->verify(hs);
+}
+
 void CUDT::checkTimers()
 {
    // update CC parameters
@@ -53,6 +53,8 @@ written by
 #include "ccc.h"
 #include "cache.h"
 #include "queue.h"
+#include "crypto.h"
+#include "cookie.h"
 
 enum UDTSockType {UDT_STREAM = 1, UDT_DGRAM};
 
@@ -107,6 +109,8 @@ public: //API
    static CUDTException& getlasterror();
    static int perfmon(UDTSOCKET u, CPerfMon* perf, bool clear = true);
    static UDTSTATUS getsockstate(UDTSOCKET u);
+   static int setmaxpending(int max);
+   static int setaccepthook(UDTSOCKET u, UDT_ACCEPT_HOOK hook, void* opaque);
 
 public: // internal API
    static CUDT* getUDTHandle(UDTSOCKET u);
@@ -297,13 +301,31 @@ private: // Options
    int m_iSndTimeOut;                           // sending timeout in milliseconds
    int m_iRcvTimeOut;                           // receiving timeout in milliseconds
    bool m_bReuseAddr;				// reuse an exiting port or not, for UDP multiplexer
+   int m_iIPv6Only;                             // IPV6_V6ONLY of the UDP socket, -1 keeps the system default
    int64_t m_llMaxBW;				// maximum data transfer rate (threshold)
+   int m_iMaxMsgSize;                           // maximum datagram message size, 0 means limited by sender buffer only
+   int m_iMsgTTL;                               // default time-to-live of a datagram message in milliseconds
+   int m_iHSRate;                               // hand shakes per second accepted from one source IP address, 0 means no limit
+   std::string m_strStreamID;                   // application data of the connection request, sent by connecting sockets, received by accepted ones
 
 private: // congestion control
    CCCVirtualFactory* m_pCCFactory;             // Factory class to create a specific CC instance
    CCC* m_pCC;                                  // congestion control class
    CCache<CInfoBlock>* m_pCache;		// network information cache
 
+private: // encryption
+   CCrypto* m_pCrypto;				// AES-GCM data encryption, NULL if encryption is off
+   CPreSharedKeys* m_pAuth;			// pre-shared keys signing hand shakes, NULL if hand shakes are not authenticated
+
+private: // hand shake flood protection of listening sockets
+   CSynCookie* m_pSynCookie;			// SYN cookies, NULL if the socket is not listening
+   CHSLimiter* m_pHSLimiter;			// hand shake rate limit of source addresses, NULL if the socket is not listening
+   int64_t m_llHSDropped;			// hand shakes dropped for a wrong SYN cookie or signature
+   int64_t m_llHSLimited;			// hand shakes dropped by the rate limit or the pending connection limit
+   UDT_ACCEPT_HOOK m_pAcceptHook;		// application decision about connection requests, NULL accepts all of them
+   void* m_pAcceptHookOpaque;			// first argument of m_pAcceptHook
+   int32_t m_iRejectReason;			// reason code of the listener that rejected the connection request
+
 private: // Status
    volatile bool m_bListening;                  // If the UDT entit is listening to connection
    volatile bool m_bConnecting;			// The short phase when connect() is called but not yet completed
@@ -367,6 +389,7 @@ private: // Receiving related data
 
 private: // synchronization: mutexes and conditions
    pthread_mutex_t m_ConnectionLock;            // used to synchronize connection operation
+   pthread_mutex_t m_HSLock;                    // used to synchronize hand shake processing of a listening socket with option changes
 
    pthread_cond_t m_SendBlockCond;              // used to block "send" call
    pthread_mutex_t m_SendBlockLock;             // lock associated to m_SendBlockCond
@@ -389,6 +412,7 @@ private: // Generation and processing of packets
    int packData(CPacket& packet, uint64_t& ts);
    int processData(CUnit* unit);
    int listen(sockaddr* addr, CPacket& packet);
+   bool checkCrypto(const CHandShake& hs) const;
 
 private: // Trace
    uint64_t m_StartTime;                        // timestamp when the UDT entity is started
@@ -0,0 +1,440 @@
+/*****************************************************************************
+Copyright (c) 2001 - 2011, The Board of Trustees of the University of Illinois.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the University of Illinois
+  nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+
+/*****************************************************************************
+Per-packet AES-GCM encryption of UDT data packets and pre-shared key
+authentication of hand shakes
+*****************************************************************************/
+
+#include <cstring>
+#include <openssl/evp.h>
+#include <openssl/hmac.h>
+#include <openssl/rand.h>
+#include "common.h"
+#include "crypto.h"
+
+using namespace std;
+
+const int CCrypto::m_iTagSize = 16;
+const int CPreSharedKeys::m_iMaxKeys = 16;
+const int CPreSharedKeys::m_iMinKeyLen = 16;
+const int CPreSharedKeys::m_iMaxKeyLen = 64;
+
+// PBKDF2 parameters of passphrase based keys. The salt is fixed because every
+// connection derives fresh session keys from random per-connection salts anyway.
+static const char* g_pcPassphraseSalt = "UDT passphrase";
+static const int g_iPassphraseRounds = 10000;
+
+static void put32(unsigned char* p, uint32_t v)
+{
+   p[0] = (unsigned char)(v >> 24);
+   p[1] = (unsigned char)(v >> 16);
+   p[2] = (unsigned char)(v >> 8);
+   p[3] = (unsigned char)v;
+}
+
+static uint32_t get32(const unsigned char* p)
+{
+   return ((uint32_t)p[0] << 24) | ((uint32_t)p[1] << 16) | ((uint32_t)p[2] << 8) | p[3];
+}
+
+static const EVP_CIPHER* cipher(int keylen)
+{
+   switch (keylen)
+   {
+   case 16:
+      return EVP_aes_128_gcm();
+   case 24:
+      return EVP_aes_192_gcm();
+   default:
+      return EVP_aes_256_gcm();
+   }
+}
+
+CCrypto::CCrypto():
+m_iKeyLen(0),
+m_pSndCtx(NULL),
+m_pRcvCtx(NULL),
+m_iSndLastSeq(0),
+m_llSndLastExt(0),
+m_iRcvLastSeq(0),
+m_llRcvLastExt(0),
+m_pcBuffer(NULL),
+m_iBufSize(0)
+{
+   memset(m_pcKey, 0, sizeof(m_pcKey));
+   RAND_bytes((unsigned char*)m_piSalt, sizeof(m_piSalt));
+}
+
+CCrypto::CCrypto(const CCrypto& config):
+m_iKeyLen(config.m_iKeyLen),
+m_pSndCtx(NULL),
+m_pRcvCtx(NULL),
+m_iSndLastSeq(0),
+m_llSndLastExt(0),
+m_iRcvLastSeq(0),
+m_llRcvLastExt(0),
+m_pcBuffer(NULL),
+m_iBufSize(0)
+{
+   // only the key is inherited, every connection has its own salt and session keys
+   memcpy(m_pcKey, config.m_pcKey, sizeof(m_pcKey));
+   RAND_bytes((unsigned char*)m_piSalt, sizeof(m_piSalt));
+}
+
+CCrypto::~CCrypto()
+{
+   memset(m_pcKey, 0, sizeof(m_pcKey));
+   EVP_CIPHER_CTX_free(m_pSndCtx);
+   EVP_CIPHER_CTX_free(m_pRcvCtx);
+   delete [] m_pcBuffer;
+}
+
+int CCrypto::setKey(const char* key, int len)
+{
+   if ((16 != len) && (24 != len) && (32 != len))
+      return -1;
+
+   memset(m_pcKey, 0, sizeof(m_pcKey));
+   memcpy(m_pcKey, key, len);
+   m_iKeyLen = len;
+
+   return 0;
+}
+
+int CCrypto::setPassphrase(const char* passphrase, int len)
+{
+   if ((len < 1) || (len > 256))
+      return -1;
+
+   if (1 != PKCS5_PBKDF2_HMAC(passphrase, len, (const unsigned char*)g_pcPassphraseSalt, strlen(g_pcPassphraseSalt), g_iPassphraseRounds, EVP_sha256(), 32, m_pcKey))
+      return -1;
+   m_iKeyLen = 32;
+
+   return 0;
+}
+
+void CCrypto::fill(CHandShake& hs) const
+{
+   hs.m_iCryptoKeyLen = m_iKeyLen;
+   memcpy(hs.m_piCryptoSalt, m_piSalt, sizeof(m_piSalt));
+   check(m_piSalt, hs.m_piCryptoCheck);
+}
+
+bool CCrypto::verify(const CHandShake& hs) const
+{
+   if (hs.m_iCryptoKeyLen != m_iKeyLen)
+      return false;
+
+   uint32_t value[4];
+   check(hs.m_piCryptoSalt, value);
+
+   // compare in constant time, the check value is all an attacker can probe
+   uint32_t diff = 0;
+   for (int i = 0; i < 4; ++ i)
+      diff |= value[i] ^ hs.m_piCryptoCheck[i];
+
+   return 0 == diff;
+}
+
+int CCrypto::start(const CHandShake& hs, int32_t sndisn, int32_t rcvisn)
+{
+   EVP_CIPHER_CTX_free(m_pSndCtx);
+   EVP_CIPHER_CTX_free(m_pRcvCtx);
+   m_pSndCtx = m_pRcvCtx = NULL;
+
+   // the sending direction is keyed by (own salt, peer salt), the receiving one the other way around,
+   // so both sides agree on the keys and the two directions never share a nonce space
+   if ((derive(m_piSalt, hs.m_piCryptoSalt, 1, m_pSndCtx, m_pcSndNonce) < 0) || (derive(hs.m_piCryptoSalt, m_piSalt, 0, m_pRcvCtx, m_pcRcvNonce) < 0))
+      return -1;
+
+   m_iSndLastSeq = sndisn;
+   m_llSndLastExt = sndisn;
+   m_iRcvLastSeq = rcvisn;
+   m_llRcvLastExt = rcvisn;
+
+   return 0;
+}
+
+int CCrypto::encrypt(CPacket& packet)
+{
+   int len = packet.getLength();
+
+   if (m_iBufSize < len + m_iTagSize)
+   {
+      delete [] m_pcBuffer;
+      m_iBufSize = len + m_iTagSize;
+      m_pcBuffer = new char[m_iBufSize];
+   }
+
+   unsigned char nonce[12];
+   makeNonce(m_pcSndNonce, extend(m_iSndLastSeq, m_llSndLastExt, packet.m_iSeqNo), nonce);
+
+   // sequence and message numbers are authenticated with the payload
+   unsigned char aad[8];
+   put32(aad, packet.m_iSeqNo);
+   put32(aad + 4, packet.m_iMsgNo);
+
+   unsigned char* out = (unsigned char*)m_pcBuffer;
+   int outlen = 0;
+   int finlen = 0;
+   if ((1 != EVP_EncryptInit_ex(m_pSndCtx, NULL, NULL, NULL, nonce))
+      || (1 != EVP_EncryptUpdate(m_pSndCtx, NULL, &outlen, aad, sizeof(aad)))
+      || (1 != EVP_EncryptUpdate(m_pSndCtx, out, &outlen, (unsigned char*)packet.m_pcData, len))
+      || (1 != EVP_EncryptFinal_ex(m_pSndCtx, out + outlen, &finlen))
+      || (1 != EVP_CIPHER_CTX_ctrl(m_pSndCtx, EVP_CTRL_GCM_GET_TAG, m_iTagSize, out + len)))
+      return -1;
+
+   packet.m_pcData = m_pcBuffer;
+   packet.setLength(len + m_iTagSize);
+
+   return len + m_iTagSize;
+}
+
+int CCrypto::decrypt(CPacket& packet)
+{
+   int len = packet.getLength() - m_iTagSize;
+   if (len < 0)
+      return -1;
+
+   // the sequence window only moves on authenticated packets, so forged ones cannot shift it
+   int32_t lastseq = m_iRcvLastSeq;
+   int64_t lastext = m_llRcvLastExt;
+   unsigned char nonce[12];
+   makeNonce(m_pcRcvNonce, extend(lastseq, lastext, packet.m_iSeqNo), nonce);
+
+   unsigned char aad[8];
+   put32(aad, packet.m_iSeqNo);
+   put32(aad + 4, packet.m_iMsgNo);
+
+   unsigned char* data = (unsigned char*)packet.m_pcData;
+   int outlen = 0;
+   int finlen = 0;
+   if ((1 != EVP_DecryptInit_ex(m_pRcvCtx, NULL, NULL, NULL, nonce))
+      || (1 != EVP_CIPHER_CTX_ctrl(m_pRcvCtx, EVP_CTRL_GCM_SET_TAG, m_iTagSize, data + len))
+      || (1 != EVP_DecryptUpdate(m_pRcvCtx, NULL, &outlen, aad, sizeof(aad)))
+      || (1 != EVP_DecryptUpdate(m_pRcvCtx, data, &outlen, data, len))
+      || (1 != EVP_DecryptFinal_ex(m_pRcvCtx, data + outlen, &finlen)))
+      return -1;
+
+   m_iRcvLastSeq = lastseq;
+   m_llRcvLastExt = lastext;
+   packet.setLength(len);
+
+   return len;
+}
+
+void CCrypto::check(const uint32_t* salt, uint32_t* value) const
+{
+   static const char label[] = "UDT key check";
+
+   unsigned char msg[sizeof(label) - 1 + 16];
+   memcpy(msg, label, sizeof(label) - 1);
+   for (int i = 0; i < 4; ++ i)
+      put32(msg + sizeof(label) - 1 + i * 4, salt[i]);
+
+   unsigned char mac[EVP_MAX_MD_SIZE];
+   unsigned int maclen = 0;
+   HMAC(EVP_sha256(), m_pcKey, m_iKeyLen, msg, sizeof(msg), mac, &maclen);
+
+   for (int i = 0; i < 4; ++ i)
+      value[i] = get32(mac + i * 4);
+}
+
+int CCrypto::derive(const uint32_t* first, const uint32_t* second, int enc, EVP_CIPHER_CTX*& ctx, unsigned char* nonce) const
+{
+   // HKDF-SHA256 (RFC 5869) with both salts, the output is the AES key followed by the nonce base
+   static const char info[] = "UDT AES-GCM";
+
+   unsigned char salt[32];
+   for (int i = 0; i < 4; ++ i)
+   {
+      put32(salt + i * 4, first[i]);
+      put32(salt + 16 + i * 4, second[i]);
+   }
+
+   unsigned char prk[EVP_MAX_MD_SIZE];
+   unsigned int prklen = 0;
+   if (NULL == HMAC(EVP_sha256(), salt, sizeof(salt), m_pcKey, m_iKeyLen, prk, &prklen))
+      return -1;
+
+   unsigned char okm[64];
+   unsigned char block[32 + sizeof(info)];
+   int blocklen = 0;
+   for (int i = 0; i < 2; ++ i)
+   {
+      memcpy(block + blocklen, info, sizeof(info) - 1);
+      block[blocklen + sizeof(info) - 1] = (unsigned char)(i + 1);
+
+      unsigned int len = 0;
+      if (NULL == HMAC(EVP_sha256(), prk, prklen, block, blocklen + sizeof(info), okm + i * 32, &len))
+         return -1;
+
+      memcpy(block, okm + i * 32, 32);
+      blocklen = 32;
+   }
+   memset(prk, 0, sizeof(prk));
+
+   ctx = EVP_CIPHER_CTX_new();
+   if ((NULL == ctx) || (1 != EVP_CipherInit_ex(ctx, cipher(m_iKeyLen), NULL, okm, NULL, enc)))
+   {
+      memset(okm, 0, sizeof(okm));
+      return -1;
+   }
+   memcpy(nonce, okm + m_iKeyLen, 12);
+   memset(okm, 0, sizeof(okm));
+
+   return 0;
+}
+
+int64_t CCrypto::extend(int32_t& lastseq, int64_t& lastext, int32_t seq)
+{
+   // sequence numbers wrap at 2^31, the nonce uses a 64-bit count that keeps going
+   int64_t ext = lastext + CSeqNo::seqoff(lastseq, seq);
+   if (ext > lastext)
+   {
+      lastseq = seq;
+      lastext = ext;
+   }
+
+   return ext;
+}
+
+void CCrypto::makeNonce(const unsigned char* base, int64_t ext, unsigned char* nonce)
+{
+   memcpy(nonce, base, 12);
+   for (int i = 0; i < 8; ++ i)
+      nonce[11 - i] ^= (unsigned char)(ext >> (i * 8));
+}
+
+int CPreSharedKeys::set(const char* data, int len)
+{
+   vector<pair<int, string> > keys;
+
+   while (len > 0)
+   {
+      int32_t hdr[2];
+      if (len < (int)sizeof(hdr))
+         return -1;
+      memcpy(hdr, data, sizeof(hdr));
+      data += sizeof(hdr);
+      len -= sizeof(hdr);
+
+      if ((hdr[0] < 0) || (hdr[0] > 0xFFFF) || (hdr[1] < m_iMinKeyLen) || (hdr[1] > m_iMaxKeyLen) || (hdr[1] > len))
+         return -1;
+      for (vector<pair<int, string> >::iterator i = keys.begin(); i != keys.end(); ++ i)
+      {
+         if (i->first == hdr[0])
+            return -1;
+      }
+      if ((int)keys.size() == m_iMaxKeys)
+         return -1;
+
+      keys.push_back(make_pair((int)hdr[0], string(data, hdr[1])));
+      data += hdr[1];
+      len -= hdr[1];
+   }
+
+   m_vKeys.swap(keys);
+
+   return 0;
+}
+
+void CPreSharedKeys::sign(CHandShake& hs, int id) const
+{
+   const string* key = find(id);
+   if (NULL == key)
+   {
+      id = m_vKeys.front().first;
+      key = &m_vKeys.front().second;
+   }
+
+   hs.m_iAuthKeyID = id;
+   mac(*key, hs, hs.m_piAuthMAC);
+}
+
+bool CPreSharedKeys::verify(const CHandShake& hs) const
+{
+   const string* key = find(hs.m_iAuthKeyID);
+   if (NULL == key)
+      return false;
+
+   uint32_t value[4];
+   mac(*key, hs, value);
+
+   uint32_t diff = 0;
+   for (int i = 0; i < 4; ++ i)
+      diff |= value[i] ^ hs.m_piAuthMAC[i];
+
+   return 0 == diff;
+}
+
+const string* CPreSharedKeys::find(int id) const
+{
+   if (id < 0)
+      return NULL;
+
+   for (vector<pair<int, string> >::const_iterator i = m_vKeys.begin(); i != m_vKeys.end(); ++ i)
+   {
+      if (i->first == id)
+         return &i->second;
+   }
+
+   return NULL;
+}
+
+void CPreSharedKeys::mac(const string& key, const CHandShake& hs, uint32_t* value)
+{
+   // the signature covers the key ID and every other field, including the cookie, ISN and peer address
+   CHandShake unsigned_hs = hs;
+   unsigned_hs.m_iAuthKeyID = -1;
+
+   int size = unsigned_hs.getSize();
+   vector<char> buf(size);
+   unsigned_hs.serialize(&buf[0], size);
+
+   vector<unsigned char> msg(4 + size);
+   put32(&msg[0], hs.m_iAuthKeyID);
+   for (int i = 0; i < size / 4; ++ i)
+      put32(&msg[4 + i * 4], ((int32_t*)&buf[0])[i]);
+
+   unsigned char digest[EVP_MAX_MD_SIZE];
+   unsigned int len = 0;
+   HMAC(EVP_sha256(), key.data(), key.size(), &msg[0], msg.size(), digest, &len);
+
+   for (int i = 0; i < 4; ++ i)
+      value[i] = get32(digest + i * 4);
+}
@@ -0,0 +1,226 @@
+/*****************************************************************************
+Copyright (c) 2001 - 2011, The Board of Trustees of the University of Illinois.
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+* Redistributions of source code must retain the above
+  copyright notice, this list of conditions and the
+  following disclaimer.
+
+* Redistributions in binary form must reproduce the
+  above copyright notice, this list of conditions
+  and the following disclaimer in the documentation
+  and/or other materials provided with the distribution.
+
+* Neither the name of the University of Illinois
+  nor the names of its contributors may be used to
+  endorse or promote products derived from this
+  software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS
+IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO,
+THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR
+PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR
+CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL,
+EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO,
+PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR
+PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF
+LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*****************************************************************************/
+
+
+/*****************************************************************************
+Per-packet AES-GCM encryption of UDT data packets and pre-shared key
+authentication of hand shakes
+*****************************************************************************/
+
+#ifndef __UDT_CRYPTO_H__
+#define __UDT_CRYPTO_H__
+
+
+#include <string>
+#include <vector>
+#include "udt.h"
+#include "packet.h"
+
+typedef struct evp_cipher_ctx_st EVP_CIPHER_CTX;
+
+class CCrypto
+{
+public:
+   CCrypto();
+   CCrypto(const CCrypto& config);
+   ~CCrypto();
+
+public:
+
+      // Functionality:
+      //    Use a raw AES key.
+      // Parameters:
+      //    0) [in] key: AES key.
+      //    1) [in] len: key length, 16, 24 or 32 bytes.
+      // Returned value:
+      //    0 if success, -1 if the key length is not valid.
+
+   int setKey(const char* key, int len);
+
+      // Functionality:
+      //    Derive a 32 bytes AES key from a passphrase with PBKDF2-HMAC-SHA256.
+      // Parameters:
+      //    0) [in] passphrase: the passphrase.
+      //    1) [in] len: passphrase length, at least 1 and at most 256 bytes.
+      // Returned value:
+      //    0 if success, -1 if the passphrase is not valid.
+
+   int setPassphrase(const char* passphrase, int len);
+
+      // Functionality:
+      //    Get the key length.
+      // Parameters:
+      //    None.
+      // Returned value:
+      //    key length in bytes.
+
+   int getKeyLength() const {return m_iKeyLen;}
+
+      // Functionality:
+      //    Put this side's salt and key check value into a handshake packet.
+      // Parameters:
+      //    0) [out] hs: the handshake to be sent.
+      // Returned value:
+      //    None.
+
+   void fill(CHandShake& hs) const;
+
+      // Functionality:
+      //    Check if the peer uses the same key.
+      // Parameters:
+      //    0) [in] hs: the handshake received from the peer.
+      // Returned value:
+      //    true if the peer's key check value matches the local key.
+
+   bool verify(const CHandShake& hs) const;
+
+      // Functionality:
+      //    Derive the session keys of both directions from the local and the peer's salt.
+      // Parameters:
+      //    0) [in] hs: the handshake received from the peer.
+      //    1) [in] sndisn: initial sequence number of the sending direction.
+      //    2) [in] rcvisn: initial sequence number of the receiving direction.
+      // Returned value:
+      //    0 if success, -1 if the cipher cannot be set up.
+
+   int start(const CHandShake& hs, int32_t sndisn, int32_t rcvisn);
+
+      // Functionality:
+      //    Seal the payload of a data packet. The payload is copied into an internal buffer
+      //    followed by the authentication tag, and the packet is pointed to it.
+      // Parameters:
+      //    0) [in, out] packet: data packet with sequence and message number set.
+      // Returned value:
+      //    the sealed payload size, or -1 on failure.
+
+   int encrypt(CPacket& packet);
+
+      // Functionality:
+      //    Open the payload of a received data packet in place and strip the authentication tag.
+      // Parameters:
+      //    0) [in, out] packet: the received data packet.
+      // Returned value:
+      //    the plain payload size, or -1 if the packet is forged or corrupted.
+
+   int decrypt(CPacket& packet);
+
+public:
+   static const int m_iTagSize;			// size of the authentication tag appended to each payload
+
+private:
+   void check(const uint32_t* salt, uint32_t* value) const;
+   int derive(const uint32_t* first, const uint32_t* second, int enc, EVP_CIPHER_CTX*& ctx, unsigned char* nonce) const;
+   static int64_t extend(int32_t& lastseq, int64_t& lastext, int32_t seq);
+   static void makeNonce(const unsigned char* base, int64_t ext, unsigned char* nonce);
+
+private:
+   unsigned char m_pcKey[32];			// AES key
+   int m_iKeyLen;				// AES key length
+   uint32_t m_piSalt[4];			// random salt of this side
+
+   EVP_CIPHER_CTX* m_pSndCtx;			// cipher context of the sending direction
+   EVP_CIPHER_CTX* m_pRcvCtx;			// cipher context of the receiving direction
+   unsigned char m_pcSndNonce[12];		// nonce base of the sending direction
+   unsigned char m_pcRcvNonce[12];		// nonce base of the receiving direction
+   int32_t m_iSndLastSeq;			// last sequence number sealed, and its 64-bit extension
+   int64_t m_llSndLastExt;
+   int32_t m_iRcvLastSeq;			// last sequence number opened, and its 64-bit extension
+   int64_t m_llRcvLastExt;
+
+   char* m_pcBuffer;				// buffer for sealed payloads
+   int m_iBufSize;
+
+private:
+   CCrypto& operator=(const CCrypto&);
+};
+
+
+class CPreSharedKeys
+{
+public:
+
+      // Functionality:
+      //    Replace the key set.
+      // Parameters:
+      //    0) [in] data: sequence of keys, each one is int32_t ID, int32_t key length and the key itself.
+      //    1) [in] len: size of data in bytes.
+      // Returned value:
+      //    0 if success, -1 if the key set is not valid.
+
+   int set(const char* data, int len);
+
+      // Functionality:
+      //    Get the number of keys.
+      // Parameters:
+      //    None.
+      // Returned value:
+      //    number of keys.
+
+   int getCount() const {return (int)m_vKeys.size();}
+
+      // Functionality:
+      //    Sign a hand shake with HMAC-SHA256 of all its other fields.
+      // Parameters:
+      //    0) [in, out] hs: the hand shake to be sent.
+      //    1) [in] id: ID of the key to use, the first key is used if there is no such key.
+      // Returned value:
+      //    None.
+
+   void sign(CHandShake& hs, int id = -1) const;
+
+      // Functionality:
+      //    Check the signature of a received hand shake.
+      // Parameters:
+      //    0) [in] hs: the received hand shake.
+      // Returned value:
+      //    true if the hand shake is signed with one of the keys.
+
+   bool verify(const CHandShake& hs) const;
+
+public:
+   static const int m_iMaxKeys;			// maximum number of keys
+   static const int m_iMinKeyLen;		// minimum key length in bytes
+   static const int m_iMaxKeyLen;		// maximum key length in bytes
+
+private:
+   const std::string* find(int id) const;
+   static void mac(const std::string& key, const CHandShake& hs, uint32_t* value);
+
+private:
+   std::vector<std::pair<int, std::string> > m_vKeys;	// keys and their IDs, the first one signs outgoing hand shakes
+};
+
+
+#endif
@@ -149,6 +149,12 @@ written by
 
 const int CPacket::m_iPktHdrSize = 16;
 const int CHandShake::m_iContentSize = 48;
+const int CHandShake::m_iCryptoExt = 1;
+const int CHandShake::m_iAuthExt = 2;
+const int CHandShake::m_iCookieExt = 3;
+const int CHandShake::m_iStreamIDExt = 4;
+const int CHandShake::m_iRejectExt = 5;
+const int CHandShake::m_iMaxStreamID = 512;
 
 
 // Set up the aliases in the constructure
@@ -362,15 +368,28 @@ m_iMSS(0),
 m_iFlightFlagSize(0),
 m_iReqType(0),
 m_iID(0),
-m_iCookie(0)
+m_iCookie(0),
+m_iCryptoKeyLen(0),
+m_bLongCookie(false),
+m_strStreamID(),
+m_iRejectReason(0),
+m_iAuthKeyID(-1)
 {
+   for (int i = 0; i < 3; ++ i)
+      m_piLongCookie[i] = 0;
    for (int i = 0; i < 4; ++ i)
+   {
       m_piPeerIP[i] = 0;
+      m_piCryptoSalt[i] = 0;
+      m_piCryptoCheck[i] = 0;
+      m_piAuthMAC[i] = 0;
+   }
 }
 
 int CHandShake::serialize(char* buf, int& size)
 {
-   if (size < m_iContentSize)
+   int total = getSize();
+   if (size < total)
       return -1;
 
    int32_t* p = (int32_t*)buf;
@@ -385,7 +404,53 @@ int CHandShake::serialize(char* buf, int& size)
    for (int i = 0; i < 4; ++ i)
       *p++ = m_piPeerIP[i];
 
-   size = m_iContentSize;
+   if (m_iCryptoKeyLen > 0)
+   {
+      *p++ = (m_iCryptoExt << 16) | 9;
+      *p++ = m_iCryptoKeyLen;
+      for (int i = 0; i < 4; ++ i)
+         *p++ = m_piCryptoSalt[i];
+      for (int i = 0; i < 4; ++ i)
+         *p++ = m_piCryptoCheck[i];
+   }
+
+   if (m_bLongCookie)
+   {
+      *p++ = (m_iCookieExt << 16) | 3;
+      for (int i = 0; i < 3; ++ i)
+         *p++ = m_piLongCookie[i];
+   }
+
+   if (!m_strStreamID.empty())
+   {
+      // bytes are packed into words in network order, so they survive byte swapping of the words
+      int len = m_strStreamID.size();
+      *p++ = (m_iStreamIDExt << 16) | (1 + (len + 3) / 4);
+      *p++ = len;
+      for (int i = 0; i < len; i += 4)
+      {
+         uint32_t word = 0;
+         for (int j = 0; j < 4; ++ j)
+            word = (word << 8) | ((i + j < len) ? (unsigned char)m_strStreamID[i + j] : 0);
+         *p++ = word;
+      }
+   }
+
+   if (0 != m_iRejectReason)
+   {
+      *p++ = (m_iRejectExt << 16) | 1;
+      *p++ = m_iRejectReason;
+   }
+
+   if (m_iAuthKeyID >= 0)
+   {
+      *p++ = (m_iAuthExt << 16) | 5;
+      *p++ = m_iAuthKeyID;
+      for (int i = 0; i < 4; ++ i)
+         *p++ = m_piAuthMAC[i];
+   }
+
+   size = total;
 
    return 0;
 }
@@ -407,5 +472,76 @@ int CHandShake::deserialize(const char* buf, int size)
    for (int i = 0; i < 4; ++ i)
       m_piPeerIP[i] = *p++;
 
+   // extensions, unknown ones are skipped
+   m_iCryptoKeyLen = 0;
+   m_bLongCookie = false;
+   m_strStreamID.clear();
+   m_iRejectReason = 0;
+   m_iAuthKeyID = -1;
+   int words = (size - m_iContentSize) / 4;
+   while (words > 0)
+   {
+      int type = (uint32_t)*p >> 16;
+      int len = *p & 0xFFFF;
+      ++ p;
+      -- words;
+      if (len > words)
+         break;
+
+      if ((m_iCryptoExt == type) && (9 == len))
+      {
+         m_iCryptoKeyLen = p[0];
+         for (int i = 0; i < 4; ++ i)
+         {
+            m_piCryptoSalt[i] = p[1 + i];
+            m_piCryptoCheck[i] = p[5 + i];
+         }
+      }
+      else if ((m_iCookieExt == type) && (3 == len))
+      {
+         m_bLongCookie = true;
+         for (int i = 0; i < 3; ++ i)
+            m_piLongCookie[i] = p[i];
+      }
+      else if ((m_iStreamIDExt == type) && (len >= 1))
+      {
+         int bytes = p[0];
+         if ((bytes > 0) && (bytes <= m_iMaxStreamID) && (1 + (bytes + 3) / 4 == len))
+         {
+            m_strStreamID.resize(bytes);
+            for (int i = 0; i < bytes; ++ i)
+               m_strStreamID[i] = (char)((uint32_t)p[1 + i / 4] >> (24 - 8 * (i % 4)));
+         }
+      }
+      else if ((m_iRejectExt == type) && (1 == len))
+         m_iRejectReason = p[0];
+      else if ((m_iAuthExt == type) && (5 == len))
+      {
+         m_iAuthKeyID = p[0] & 0xFFFF;
+         for (int i = 0; i < 4; ++ i)
+            m_piAuthMAC[i] = p[1 + i];
+      }
+
+      p += len;
+      words -= len;
+   }
+
    return 0;
 }
+
+int CHandShake::getSize() const
+{
+   int size = m_iContentSize;
+   if (m_iCryptoKeyLen > 0)
+      size += 40;
+   if (m_bLongCookie)
+      size += 16;
+   if (!m_strStreamID.empty())
+      size += 8 + (m_strStreamID.size() + 3) / 4 * 4;
+   if (0 != m_iRejectReason)
+      size += 8;
+   if (m_iAuthKeyID >= 0)
+      size += 24;
+
+   return size;
+}
@@ -203,9 +203,16 @@ public:
 
    int serialize(char* buf, int& size);
    int deserialize(const char* buf, int size);
+   int getSize() const;
 
 public:
    static const int m_iContentSize;	// Size of hand shake data
+   static const int m_iCryptoExt;	// Extension type of the encryption fields
+   static const int m_iAuthExt;		// Extension type of the pre-shared key signature
+   static const int m_iCookieExt;	// Extension type of the upper 96 bits of the SYN cookie
+   static const int m_iStreamIDExt;	// Extension type of the application data of the connection request
+   static const int m_iRejectExt;	// Extension type of the reason of a rejected connection request
+   static const int m_iMaxStreamID;	// Maximum size of the application data in bytes
 
 public:
    int32_t m_iVersion;          // UDT version
@@ -217,6 +224,17 @@ public:
    int32_t m_iID;		// socket ID
    int32_t m_iCookie;		// cookie
    uint32_t m_piPeerIP[4];	// The IP address that the peer's UDP port is bound to
+
+   // Extension fields, serialized after the fixed content as (type << 16 | length in words) followed by the value
+   int32_t m_iCryptoKeyLen;	// encryption key length in bytes, 0 if encryption is off
+   uint32_t m_piCryptoSalt[4];	// random salt of the sender's session keys
+   uint32_t m_piCryptoCheck[4];	// key check value, proves that the sender has the same key
+   bool m_bLongCookie;		// if the SYN cookie is 128 bits long, the lower 32 bits are m_iCookie
+   uint32_t m_piLongCookie[3];	// upper 96 bits of the SYN cookie
+   std::string m_strStreamID;	// application data of the connection request, such as a stream ID
+   int32_t m_iRejectReason;	// reason code of the listener that rejected the request, 0 if none was given
+   int32_t m_iAuthKeyID;	// ID of the pre-shared key the hand shake is signed with, -1 if it is not signed
+   uint32_t m_piAuthMAC[4];	// truncated HMAC-SHA256 of all other fields, the signature extension is always the last one
 };
 
 
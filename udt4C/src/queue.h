@@ -520,6 +520,7 @@ struct CMultiplexer
    int m_iMSS;			// Maximum Segment Size
    int m_iRefCount;		// number of UDT instances that are associated with this multiplexer
    bool m_bReusable;		// if this one can be shared with others
+   int m_iIPv6Only;		// IPV6_V6ONLY of the UDP socket, -1 for the system default
 
    int m_iID;			// multiplexer ID
 };
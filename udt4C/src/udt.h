@@ -151,9 +151,24 @@ enum UDTOpt
    UDT_STATE,		// current socket state, see UDTSTATUS, read only
    UDT_EVENT,		// current avalable events associated with the socket
    UDT_SNDDATA,		// size of data in the sending buffer
-   UDT_RCVDATA		// size of data available for recv
+   UDT_RCVDATA,		// size of data available for recv
+   UDT_PASSPHRASE,	// passphrase the AES-GCM data encryption key is derived from
+   UDT_CRYPTOKEY,	// raw AES-GCM data encryption key, 16, 24 or 32 bytes
+   UDT_PSK,		// pre-shared keys authenticating hand shakes, each one as int32_t ID, int32_t length and the key
+   UDT_HSRATE,		// hand shakes per second accepted from one source IP address by a listening socket, 0 means no limit
+   UDT_HSDROPPED,	// number of hand shakes dropped by a listening socket for a wrong SYN cookie or signature
+   UDT_HSLIMITED,	// number of hand shakes dropped by a listening socket for exceeding the rate or pending connection limit
+   UDT_STREAMID,	// application data sent with the connection request, such as a stream ID, at most 512 bytes
+   UDT_REJECTREASON,	// reason code of the listener that rejected the connection request, 0 if none was given, read only
+   UDT_IPV6ONLY,	// IPV6_V6ONLY of the UDP socket bound by an IPv6 socket, 1 or 0, -1 keeps the system default
+   UDT_UDPSOCK		// UDP socket the bound socket sends and receives on, still owned by UDT, read only
 };
 
+// Decides about a connection request of a listening socket before the connection is set up. Options of the new
+// socket ns can be changed by the hook, as well as options and the hook of the listening socket lsn. Returns 0 to
+// accept the connection, otherwise the connection is rejected and the returned value is sent to the peer as the reason.
+typedef int (*UDT_ACCEPT_HOOK)(void* opaque, UDTSOCKET lsn, UDTSOCKET ns, const sockaddr* peer, const char* streamid, int len);
+
 ////////////////////////////////////////////////////////////////////////////////
 
 struct CPerfMon
@@ -351,6 +366,8 @@ UDT_API int getlasterror_code();
 UDT_API const char* getlasterror_desc();
 UDT_API int perfmon(UDTSOCKET u, TRACEINFO* perf, bool clear = true);
 UDT_API UDTSTATUS getsockstate(UDTSOCKET u);
+UDT_API int setmaxpending(int max);
+UDT_API int setaccepthook(UDTSOCKET u, UDT_ACCEPT_HOOK hook, void* opaque);
 
 }  // namespace UDT
 
@@ -35,11 +35,138 @@ SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 /*****************************************************************************
 written by
    Tom Zhou, last updated 05/18/2012
+
+On failure every function sets errno to UDT error code in addition to the
+thread-local UDT error, so the caller can read the code atomically with the
+call (e.g. cgo "r, err := C.udt_send(...)").
 *****************************************************************************/
 
+#include <cerrno>
+#include <fstream>
+#ifndef WIN32
+   #include <unistd.h>
+#else
+   #include <io.h>
+#endif
 #include "udt.h"
 #include "udtc.h"
 #include "common.h"
+#include "ccc.h"
+
+
+// CCC forwarding all events to callbacks of the C API user
+class CCCCallback: public CCC
+{
+public:
+   CCCCallback(const UDT_CCCALLBACKS* cb, uintptr_t factory):
+   m_Callbacks(*cb)
+   {
+      m_Handle = m_Callbacks.create(factory, this);
+   }
+
+   virtual ~CCCCallback()
+   {
+      m_Callbacks.release(m_Handle);
+   }
+
+   virtual void init() {m_Callbacks.init(m_Handle);}
+   virtual void close() {m_Callbacks.close(m_Handle);}
+   virtual void onACK(int32_t ackno) {m_Callbacks.onack(m_Handle, ackno);}
+   virtual void onLoss(const int32_t* losslist, int size) {m_Callbacks.onloss(m_Handle, (int32_t*)losslist, size);}
+   virtual void onTimeout() {m_Callbacks.ontimeout(m_Handle);}
+
+   virtual void onPktSent(const CPacket* pkt)
+   {
+      UDT_CCPACKET p;
+      convert(pkt, &p);
+      m_Callbacks.onpktsent(m_Handle, &p);
+   }
+
+   virtual void onPktReceived(const CPacket* pkt)
+   {
+      UDT_CCPACKET p;
+      convert(pkt, &p);
+      m_Callbacks.onpktreceived(m_Handle, &p);
+   }
+
+   virtual void processCustomMsg(const CPacket* pkt)
+   {
+      UDT_CCPACKET p;
+      convert(pkt, &p);
+      m_Callbacks.processcustommsg(m_Handle, &p);
+   }
+
+   void getParams(UDT_CCPARAMS* params) const
+   {
+      params->usPktSndPeriod = m_dPktSndPeriod;
+      params->pktCWndSize = m_dCWndSize;
+      params->pktMaxCWndSize = m_dMaxCWndSize;
+      params->mss = m_iMSS;
+      params->sndCurrSeqNo = m_iSndCurrSeqNo;
+      params->rcvRate = m_iRcvRate;
+      params->usRTT = m_iRTT;
+      params->bandwidth = m_iBandwidth;
+      params->usSYNInterval = m_iSYNInterval;
+   }
+
+   void setPktSndPeriod(double period) {m_dPktSndPeriod = period;}
+   void setCWndSize(double size) {m_dCWndSize = size;}
+   void setACKTimer(int msINT) {CCC::setACKTimer(msINT);}
+   void setACKInterval(int pktINT) {CCC::setACKInterval(pktINT);}
+   void setRTO(int usRTO) {CCC::setRTO(usRTO);}
+
+   void sendCustomMsg(int exttype, const char* data, int len) const
+   {
+      CPacket pkt;
+      int32_t type = exttype & 0xFFFF;
+      pkt.pack(32767, &type, (void*)data, len);
+      CCC::sendCustomMsg(pkt);
+   }
+
+   uintptr_t handle() const {return m_Handle;}
+
+private:
+   static void convert(const CPacket* pkt, UDT_CCPACKET* p)
+   {
+      p->control = pkt->getFlag();
+      p->type = p->control ? pkt->getType() : 0;
+      p->exttype = p->control ? pkt->getExtendedType() : 0;
+      p->seqno = p->control ? 0 : pkt->m_iSeqNo;
+      p->msgno = p->control ? 0 : pkt->m_iMsgNo;
+      p->info = p->control ? pkt->getAckSeqNo() : 0;
+      p->timestamp = pkt->m_iTimeStamp;
+      p->data = pkt->m_pcData;
+      p->len = pkt->getLength();
+   }
+
+   UDT_CCCALLBACKS m_Callbacks;
+   uintptr_t m_Handle;
+};
+
+class CCCCallbackFactory: public CCCVirtualFactory
+{
+public:
+   CCCCallbackFactory(const UDT_CCCALLBACKS* cb, uintptr_t factory, bool owner):
+   m_Callbacks(*cb),
+   m_Factory(factory),
+   m_bOwner(owner)
+   {
+   }
+
+   virtual ~CCCCallbackFactory()
+   {
+      if (m_bOwner)
+         m_Callbacks.release(m_Factory);
+   }
+
+   virtual CCC* create() {return new CCCCallback(&m_Callbacks, m_Factory);}
+   virtual CCCVirtualFactory* clone() {return new CCCCallbackFactory(&m_Callbacks, m_Callbacks.clone(m_Factory), true);}
+
+private:
+   UDT_CCCALLBACKS m_Callbacks;
+   uintptr_t m_Factory;
+   bool m_bOwner;
+};
 
 
 extern "C" {
@@ -51,6 +178,7 @@ int udt_startup()
     rc = UDT::startup();
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -64,6 +192,7 @@ int udt_cleanup()
     rc = UDT::cleanup();
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -77,6 +206,7 @@ UDTSOCKET udt_socket(int af, int type, int protocol)
     rc = UDT::socket(af, type, protocol);
     if (rc == UDT::INVALID_SOCK) {
         // error happen
+        errno = UDT::getlasterror_code();
         return UDT_INVALID_SOCK;
     } else {
         return rc;
@@ -90,6 +220,7 @@ int udt_bind(UDTSOCKET u, const struct sockaddr * name, int namelen)
     rc = UDT::bind(u, name, namelen);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -103,6 +234,7 @@ int udt_bind2(UDTSOCKET u, UDPSOCKET udpsock)
     rc = UDT::bind2(u, udpsock);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -116,6 +248,7 @@ int udt_listen(UDTSOCKET u, int backlog)
     rc = UDT::listen(u, backlog);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -129,6 +262,7 @@ UDTSOCKET udt_accept(UDTSOCKET u, struct sockaddr * addr, int * addrlen)
     rc = UDT::accept(u, addr, addrlen);
     if (rc == UDT::INVALID_SOCK) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -142,6 +276,7 @@ int udt_connect(UDTSOCKET u, const struct sockaddr * name, int namelen)
     rc = UDT::connect(u, name, namelen);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -163,6 +298,7 @@ int udt_close(UDTSOCKET u)
         rc = UDT::close(u);
         if (rc == UDT::ERROR) {
             // error happen
+            errno = UDT::getlasterror_code();
             return -1;
         } else {
             return 0;
@@ -177,6 +313,7 @@ int udt_getpeername(UDTSOCKET u, struct sockaddr * name, int * namelen)
     rc = UDT::getpeername(u, name, namelen);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -190,6 +327,7 @@ int udt_getsockname(UDTSOCKET u, struct sockaddr * name, int * namelen)
     rc = UDT::getsockname(u, name, namelen);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -203,6 +341,7 @@ int udt_getsockopt(UDTSOCKET u, int level, int optname, void * optval, int * opt
     rc = UDT::getsockopt(u, level, (UDT::SOCKOPT)optname, optval, optlen);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -222,6 +361,7 @@ int udt_setsockopt(UDTSOCKET u, int level, int optname, const void * optval, int
 	}
 	if (rc == UDT::ERROR) {
 		// error happen
+		errno = UDT::getlasterror_code();
 		return -1;
 	} else {
 		return 0;
@@ -235,6 +375,7 @@ int udt_send(UDTSOCKET u, const char * buf, int len, int flags)
     rc = UDT::send(u, buf, len, flags);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -248,6 +389,7 @@ int udt_recv(UDTSOCKET u, char * buf, int len, int flags)
     rc = UDT::recv(u, buf, len, flags);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -261,6 +403,7 @@ int udt_sendmsg(UDTSOCKET u, const char * buf, int len, int ttl, int inorder)
     rc = UDT::sendmsg(u, buf, len, ttl, inorder);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -274,6 +417,7 @@ int udt_recvmsg(UDTSOCKET u, char * buf, int len)
     rc = UDT::recvmsg(u, buf, len);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -287,6 +431,7 @@ int64_t udt_sendfile2(UDTSOCKET u, const char* path, int64_t* offset, int64_t si
     rc = UDT::sendfile2(u, path, offset, size, block);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -300,6 +445,85 @@ int64_t udt_recvfile2(UDTSOCKET u, const char* path, int64_t* offset, int64_t si
     rc = UDT::recvfile2(u, path, offset, size, block);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
+        return -1;
+    } else {
+        return rc;
+    }
+}
+
+// stream buffer writing at explicit offsets of a descriptor opened by the caller, the file
+// is neither reopened nor truncated and needs no read permission
+class CFDWriteBuf: public std::streambuf
+{
+public:
+   CFDWriteBuf(int fd):
+   m_iFD(fd),
+   m_llPos(0)
+   {
+   }
+
+protected:
+   virtual std::streampos seekoff(std::streamoff off, std::ios_base::seekdir dir, std::ios_base::openmode which)
+   {
+      if (std::ios_base::cur == dir)
+         off += m_llPos;
+      else if (std::ios_base::beg != dir)
+         return std::streampos(std::streamoff(-1));
+      return seekpos(std::streampos(off), which);
+   }
+
+   virtual std::streampos seekpos(std::streampos pos, std::ios_base::openmode)
+   {
+      m_llPos = std::streamoff(pos);
+      return pos;
+   }
+
+   virtual std::streamsize xsputn(const char* s, std::streamsize n)
+   {
+      std::streamsize done = 0;
+      while (done < n)
+      {
+         #ifndef WIN32
+            ssize_t w = ::pwrite(m_iFD, s + done, n - done, m_llPos);
+         #else
+            int w = (_lseeki64(m_iFD, m_llPos, SEEK_SET) < 0) ? -1 : _write(m_iFD, s + done, (unsigned int)(n - done));
+         #endif
+         if ((w < 0) && (EINTR == errno))
+            continue;
+         if (w <= 0)
+            break;
+         done += w;
+         m_llPos += w;
+      }
+      return done;
+   }
+
+   virtual int_type overflow(int_type c)
+   {
+      if (traits_type::eq_int_type(c, traits_type::eof()))
+         return traits_type::not_eof(c);
+      char ch = traits_type::to_char_type(c);
+      return (1 == xsputn(&ch, 1)) ? c : traits_type::eof();
+   }
+
+private:
+   int m_iFD;
+   int64_t m_llPos;
+};
+
+int64_t udt_recvfile_fd(UDTSOCKET u, int fd, int64_t* offset, int64_t size, int block)
+{
+	int64_t rc;
+
+    // the stream writes through the descriptor, its own file buffer stays closed
+    CFDWriteBuf buf(fd);
+    std::fstream ofs;
+    static_cast<std::ios&>(ofs).rdbuf(&buf);
+    rc = UDT::recvfile(u, ofs, *offset, size, block);
+    if (rc == UDT::ERROR) {
+        // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return rc;
@@ -328,6 +552,7 @@ int udt_perfmon(UDTSOCKET u, UDT_TRACEINFO * perf, int clear)
     rc = UDT::perfmon(u, (UDT::TRACEINFO *)perf, clear);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         return 0;
@@ -350,6 +575,34 @@ int udt_getsockstate(UDTSOCKET u)
 	}
 }
 
+int udt_setaccepthook(UDTSOCKET u, UDT_ACCEPTHOOK hook, void * opaque)
+{
+    int rc;
+
+    rc = UDT::setaccepthook(u, hook, opaque);
+    if (rc == UDT::ERROR) {
+        // error happen
+        errno = UDT::getlasterror_code();
+        return -1;
+    } else {
+        return 0;
+    }
+}
+
+int udt_setmaxpending(int max)
+{
+    int rc;
+
+    rc = UDT::setmaxpending(max);
+    if (rc == UDT::ERROR) {
+        // error happen
+        errno = UDT::getlasterror_code();
+        return -1;
+    } else {
+        return 0;
+    }
+}
+
 // event mechanism
 int udt_epoll_create()
 {
@@ -358,6 +611,7 @@ int udt_epoll_create()
     rc = UDT::epoll_create();
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -383,6 +637,7 @@ int udt_epoll_add_usock(int eid, UDTSOCKET u, const int * events)
 	rc = UDT::epoll_add_usock(eid, u, &udt_ev);
 	if (rc == UDT::ERROR) {
 		// error happen
+		errno = UDT::getlasterror_code();
 		return -1;
 	} else {
 		// success
@@ -411,6 +666,7 @@ int udt_epoll_add_ssock(int eid, SYSSOCKET s, const int * events)
     rc = UDT::epoll_add_ssock(eid, s, &flag);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -426,6 +682,7 @@ int udt_epoll_remove_usock(int eid, UDTSOCKET u)
     rc = UDT::epoll_remove_usock(eid, u);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -441,6 +698,7 @@ int udt_epoll_remove_ssock(int eid, SYSSOCKET s)
     rc = UDT::epoll_remove_ssock(eid, s);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -464,6 +722,7 @@ int udt_epoll_wait2(
     		lrfds, lrnum, lwfds, lwnum);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -479,6 +738,7 @@ int udt_epoll_release(int eid)
     rc = UDT::epoll_release(eid);
     if (rc == UDT::ERROR) {
         // error happen
+        errno = UDT::getlasterror_code();
         return -1;
     } else {
         // success
@@ -486,6 +746,75 @@ int udt_epoll_release(int eid)
     }
 }
 
+int udt_setcc(UDTSOCKET u, const UDT_CCCALLBACKS * cb, uintptr_t factory)
+{
+    int rc;
+
+    // UDT keeps a clone of the factory, the caller keeps its handle
+    CCCCallbackFactory f(cb, factory, false);
+    rc = UDT::setsockopt(u, 0, UDT_CC, &f, sizeof(f));
+    if (rc == UDT::ERROR) {
+        // error happen
+        errno = UDT::getlasterror_code();
+        return -1;
+    } else {
+        return 0;
+    }
+}
+
+int udt_getcc(UDTSOCKET u, uintptr_t * cc)
+{
+    int rc;
+    CCC * ccc = NULL;
+    int len = sizeof(ccc);
+
+    rc = UDT::getsockopt(u, 0, UDT_CC, &ccc, &len);
+    if (rc == UDT::ERROR) {
+        // error happen
+        errno = UDT::getlasterror_code();
+        return -1;
+    }
+
+    CCCCallback * cbc = dynamic_cast<CCCCallback *>(ccc);
+    *cc = (NULL != cbc) ? cbc->handle() : 0;
+    return 0;
+}
+
+void udt_cc_getparams(UDT_CCC cc, UDT_CCPARAMS * params)
+{
+    ((CCCCallback *)cc)->getParams(params);
+}
+
+void udt_cc_setpktsndperiod(UDT_CCC cc, double usPeriod)
+{
+    ((CCCCallback *)cc)->setPktSndPeriod(usPeriod);
+}
+
+void udt_cc_setcwndsize(UDT_CCC cc, double pktSize)
+{
+    ((CCCCallback *)cc)->setCWndSize(pktSize);
+}
+
+void udt_cc_setacktimer(UDT_CCC cc, int msINT)
+{
+    ((CCCCallback *)cc)->setACKTimer(msINT);
+}
+
+void udt_cc_setackinterval(UDT_CCC cc, int pktINT)
+{
+    ((CCCCallback *)cc)->setACKInterval(pktINT);
+}
+
+void udt_cc_setrto(UDT_CCC cc, int usRTO)
+{
+    ((CCCCallback *)cc)->setRTO(usRTO);
+}
+
+void udt_cc_sendcustommsg(UDT_CCC cc, int exttype, const char * data, int len)
+{
+    ((CCCCallback *)cc)->sendCustomMsg(exttype, data, len);
+}
+
 // constant definitions
 const UDTSOCKET UDT_INVALID_SOCK = -1;
 const int UDT_ERROR = -1;
@@ -41,7 +41,9 @@ package udtgo
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 	"testing"
@@ -59,6 +61,49 @@ const (
 	PORT9007
 	PORT9008
 	PORT9009
+	PORT9010
+	PORT9011
+	PORT9012
+	PORT9013
+	PORT9014
+	PORT9015
+	PORT9016
+	PORT9017
+	PORT9018
+	PORT9019
+	PORT9020
+	PORT9021
+	PORT9022
+	PORT9023
+	PORT9024
+	PORT9025
+	PORT9026
+	PORT9027
+	PORT9028
+	PORT9029
+	PORT9030
+	PORT9031
+	PORT9032
+	PORT9033
+	PORT9034
+	PORT9035
+	PORT9036
+	PORT9037
+	PORT9038
+	PORT9039
+	PORT9040
+	PORT9041
+	PORT9042
+	PORT9043
+	PORT9044
+	PORT9045
+	PORT9046
+	PORT9047
+	PORT9048
+	PORT9049
+	PORT9050
+	PORT9051
+	PORT9052
 )
 
 func TestMain(m *testing.M) {
@@ -528,7 +573,7 @@ func TestIPv6Socknames(t *testing.T) {
 	if err != nil {
 		t.Errorf("Unable to get sock name %s", err)
 	}
-	if sockaddr.sa_data != "::1" {
+	if sockaddr.sa_data != "::" {
 		t.Errorf("Unable to get sock name %s", sockaddr.sa_data)
 		return
 	}
@@ -551,6 +596,136 @@ func TestIPv6Socknames(t *testing.T) {
 
 }
 
+func TestBindAddr(t *testing.T) {
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+
+	bindAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9033}
+	if err = BindAddr(s, bindAddr); err != nil {
+		t.Fatalf("Unable to bind socket %s", err)
+	}
+	if _, err = Listen(s, 4); err != nil {
+		t.Fatalf("Unable to listen socket %s", err)
+	}
+
+	laddr, err := s.LocalAddr()
+	if err != nil || !laddr.IP.Equal(bindAddr.IP) || laddr.Port != PORT9033 {
+		t.Errorf("Local address should be %v got %v %v", bindAddr, laddr, err)
+	}
+
+	sc, err := startClient("ip4", "127.0.0.1", PORT9033, true)
+	if err != nil {
+		t.Fatalf("Unable to start client %s", err)
+	}
+	defer Close(sc)
+
+	raddr, err := sc.RemoteAddr()
+	if err != nil || !raddr.IP.Equal(bindAddr.IP) || raddr.Port != PORT9033 {
+		t.Errorf("Remote address should be %v got %v %v", bindAddr, raddr, err)
+	}
+	if laddr, err = sc.LocalAddr(); err != nil || laddr.Port == 0 {
+		t.Errorf("Client local address should have port got %v %v", laddr, err)
+	}
+}
+
+func TestBindUDPConn(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: PORT9037})
+	if err != nil {
+		t.Fatalf("Unable to listen UDP %s", err)
+	}
+	defer conn.Close()
+
+	s6, err := CreateSocket("ip6", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s6)
+	if err = BindUDPConn(s6, conn); err == nil {
+		t.Errorf("IPv4 UDP socket should not be bound to IPv6 socket")
+	}
+
+	s, err := CreateSocket("ip4", true)
+	if err != nil {
+		t.Fatalf("Unable to create socket %s", err)
+	}
+	defer Close(s)
+	if err = BindUDPConn(s, conn); err != nil {
+		t.Fatalf("Unable to bind UDP socket %s", err)
+	}
+	//UDT keeps its own descriptor
+	conn.Close()
+
+	if _, err = Listen(s, 4); err != nil {
+		t.Fatalf("Unable to listen socket %s", err)
+	}
+	laddr, err := s.LocalAddr()
+	if err != nil || !laddr.IP.Equal(net.IPv4(127, 0, 0, 1)) || laddr.Port != PORT9037 {
+		t.Errorf("Local address should be 127.0.0.1:%d got %v %v", PORT9037, laddr, err)
+	}
+
+	message := "Hello from Kamlesh"
+	go sendData(t, "ip4", "127.0.0.1", PORT9037, true, message)
+
+	ns, err := Accept(s)
+	if err != nil {
+		t.Fatalf("Unable to accept %s", err)
+	}
+	defer Close(ns)
+
+	data := make([]byte, len(message))
+	n, err := Recv(ns, &data[0], len(data))
+	if err != nil || string(data[:n]) != message {
+		t.Errorf("Message should be %q got %q %v", message, data[:n], err)
+	}
+}
+
+func TestIPv6Only(t *testing.T) {
+	for i, only := range []bool{false, true} {
+		port := PORT9034 + i
+		s, err := CreateSocket("ip6", true, WithIPv6Only(only))
+		if err != nil {
+			t.Fatalf("Unable to create socket %s", err)
+		}
+		defer Close(s)
+
+		if v6only, err := s.IPv6Only(); err != nil || v6only != only {
+			t.Errorf("IPv6Only should be %v got %v %v", only, v6only, err)
+		}
+		if _, err = Bind(s, port); err != nil {
+			t.Fatalf("Unable to bind socket %s", err)
+		}
+		if _, err = Listen(s, 4); err != nil {
+			t.Fatalf("Unable to listen socket %s", err)
+		}
+		if err = s.SetIPv6Only(!only); err == nil {
+			t.Errorf("IPv6Only of bound socket should not be changed")
+		}
+
+		laddr, err := s.LocalAddr()
+		if err != nil || !laddr.IP.Equal(net.IPv6unspecified) || laddr.Port != port {
+			t.Errorf("Local address should be [::]:%d got %v %v", port, laddr, err)
+		}
+
+		//IPv4 peer reaches dual-stack socket only
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		c, err := DialContext(ctx, "udt4", fmt.Sprintf("127.0.0.1:%d", port))
+		cancel()
+		if only && err == nil {
+			c.Close()
+			t.Errorf("IPv4 peer should not connect to IPv6 only socket")
+		}
+		if !only {
+			if err != nil {
+				t.Fatalf("IPv4 peer should connect to dual-stack socket %s", err)
+			}
+			c.Close()
+		}
+	}
+}
+
 func TestPerfmon(t *testing.T) {
 
 	s, err := startServer(PORT9006, "ip4", true)
@@ -561,7 +736,9 @@ func TestPerfmon(t *testing.T) {
 
 	dataSize := 100000
 
-	go sendPerfmonData(t, "ip4", "localhost", PORT9006, true, dataSize)
+	done := make(chan struct{})
+	defer func() { <-done }()
+	go sendPerfmonData(t, "ip4", "localhost", PORT9006, true, dataSize, done)
 
 	ns, err := Accept(s)
 	if err != nil {
@@ -695,7 +872,8 @@ func startServer(portno int, network string, isStream bool) (socket *Socket, err
 }
 
 func sendPerfmonData(t *testing.T, network string, host string, portno int,
-	isStream bool, dataSize int) {
+	isStream bool, dataSize int, done chan struct{}) {
+	defer close(done)
 
 	s, err := startClient(network, host, portno, isStream)
 
@@ -707,7 +885,7 @@ func sendPerfmonData(t *testing.T, network string, host string, portno int,
 	data := make([]byte, dataSize)
 	sDataSize := 10
 
-	go monitor(t, s)
+	defer monitor(t, s)()
 
 	for sDataSize < dataSize {
 		n, err := Send(s, &data[0], sDataSize)
@@ -722,20 +900,26 @@ func sendPerfmonData(t *testing.T, network string, host string, portno int,
 
 }
 
-func monitor(t *testing.T, socket *Socket) {
+//Logs socket statistics until the returned stop function is called.
 
-	t.Logf("SendRate(Mb/s)\tRTT(ms)\tCWnd\tPktSndPeriod(us)\tRecvACK\tRecvNAK")
+func monitor(t *testing.T, socket *Socket) (stop func()) {
 
-	for {
-		time.Sleep(10 * time.Millisecond)
-		traceinfo, err := Perfmon(socket, false)
-		if err != nil {
-			t.Logf("Unable to get perform data %s", err)
-			break
+	sampler := NewStatsSampler(socket, 10*time.Millisecond)
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		t.Logf("SendRate(Mb/s)\tRTT(ms)\tCWnd\tPktSndPeriod(us)\tRecvACK\tRecvNAK")
+		for stats := range sampler.C {
+			t.Logf("%f\t%f\t%d\t%f\t%d\t%d",
+				stats.SendRateMbps, float64(stats.RTT)/float64(time.Millisecond), stats.CongestionWindow,
+				float64(stats.PktSndPeriod)/float64(time.Microsecond), stats.PktRecvACK, stats.PktRecvNAK)
 		}
-		t.Logf("%f\t%f\t%d\t%f\t%d\t%d",
-			traceinfo.mbpsSendRate, traceinfo.msRTT, traceinfo.pktCongestionWindow,
-			traceinfo.usPktSndPeriod, traceinfo.pktRecvACK, traceinfo.pktRecvNAK)
+	}()
+
+	return func() {
+		sampler.Stop()
+		<-finished
 	}
 }
 
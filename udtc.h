@@ -41,6 +41,7 @@ written by
 #define UDTC_H_
 
 #ifndef WIN32
+   #include <stdint.h>
    #include <sys/types.h>
    #include <sys/socket.h>
    #include <netinet/in.h>
@@ -132,7 +133,17 @@ enum UDT_UDTOpt {
 	UDT_UDT_STATE,           // current socket state, see UDTSTATUS, read only
 	UDT_UDT_EVENT,           // current available events associated with the socket
 	UDT_UDT_SNDDATA,         // size of data in the sending buffer
-	UDT_UDT_RCVDATA          // size of data available for recv
+	UDT_UDT_RCVDATA,         // size of data available for recv
+	UDT_UDT_PASSPHRASE,      // passphrase the AES-GCM data encryption key is derived from
+	UDT_UDT_CRYPTOKEY,       // raw AES-GCM data encryption key, 16, 24 or 32 bytes
+	UDT_UDT_PSK,             // pre-shared keys authenticating hand shakes, each one as int32_t ID, int32_t length and the key
+	UDT_UDT_HSRATE,          // hand shakes per second accepted from one source IP address by a listening socket, 0 means no limit
+	UDT_UDT_HSDROPPED,       // number of hand shakes dropped by a listening socket for a wrong SYN cookie or signature
+	UDT_UDT_HSLIMITED,       // number of hand shakes dropped by a listening socket for exceeding the rate or pending connection limit
+	UDT_UDT_STREAMID,        // application data sent with the connection request, such as a stream ID, at most 512 bytes
+	UDT_UDT_REJECTREASON,    // reason code of the listener that rejected the connection request, 0 if none was given, read only
+	UDT_UDT_IPV6ONLY,        // IPV6_V6ONLY of the UDP socket bound by an IPv6 socket, 1 or 0, -1 keeps the system default
+	UDT_UDT_UDPSOCK          // UDP socket the bound socket sends and receives on, still owned by UDT, read only
 };
 
 // UDT error code
@@ -244,6 +255,8 @@ UDT_API extern int udt_recvmsg(UDTSOCKET u, char* buf, int len);
 ///UDT_API extern int64_t udt_recvfile(UDTSOCKET u, std::fstream& ofs, int64_t& offset, int64_t size, int block = 7280000);
 UDT_API extern int64_t udt_sendfile2(UDTSOCKET u, const char* path, int64_t* offset, int64_t size, int block/* = 364000*/);
 UDT_API extern int64_t udt_recvfile2(UDTSOCKET u, const char* path, int64_t* offset, int64_t size, int block/* = 7280000*/);
+// same as udt_recvfile2 but writes through descriptor fd of an open file without truncating it
+UDT_API extern int64_t udt_recvfile_fd(UDTSOCKET u, int fd, int64_t* offset, int64_t size, int block/* = 7280000*/);
 
 // last error detection
 UDT_API extern const char * udt_getlasterror_desc();
@@ -256,6 +269,16 @@ UDT_API extern int udt_perfmon(UDTSOCKET u, UDT_TRACEINFO * perf, int clear);
 // get UDT socket state
 UDT_API extern int udt_getsockstate(UDTSOCKET u);
 
+// limit connections waiting for accept on all listening sockets, 0 means no limit
+UDT_API extern int udt_setmaxpending(int max);
+
+// connection request hook of a listening socket, called before the connection is set up, options of the new
+// socket ns can be changed by the hook, as well as options and the hook of the listening socket lsn. It returns
+// 0 to accept the connection, otherwise the returned reason is sent to the peer, which reads it as
+// UDT_UDT_REJECTREASON. NULL hook removes the hook.
+typedef int (*UDT_ACCEPTHOOK)(void* opaque, UDTSOCKET lsn, UDTSOCKET ns, const struct sockaddr* peer, const char* streamid, int len);
+UDT_API extern int udt_setaccepthook(UDTSOCKET u, UDT_ACCEPTHOOK hook, void* opaque);
+
 // event mechanism
 // select and selectEX are DEPRECATED; please use epoll.
 enum UDT_EPOLLOpt
@@ -278,6 +301,64 @@ UDT_API extern int udt_epoll_wait2(int eid, UDTSOCKET* readfds, int* rnum, UDTSO
                         SYSSOCKET* lrfds, int* lrnum, SYSSOCKET* lwfds, int* lwnum);
 UDT_API extern int udt_epoll_release(int eid);
 
+// user defined congestion control
+// UDT_CCC is the CCC object of a connection, valid until release callback is called
+typedef void * UDT_CCC;
+
+// packet passed to packet callbacks
+typedef struct UDT_CCPACKET_ {
+	int control;                         // 1 for control packet, 0 for data packet
+	int type;                            // control packet type, 0x7FFF for user defined packet
+	int exttype;                         // extended type of user defined control packet
+	int32_t seqno;                       // sequence number of data packet
+	int32_t msgno;                       // message number of data packet
+	int32_t info;                        // additional information of control packet
+	int32_t timestamp;                   // timestamp, in microseconds
+	const char* data;                    // payload
+	int len;                             // payload size
+} UDT_CCPACKET;
+
+// connection parameters available to congestion control
+typedef struct UDT_CCPARAMS_ {
+	double usPktSndPeriod;               // packet sending period, in microseconds
+	double pktCWndSize;                  // congestion window size, in packets
+	double pktMaxCWndSize;               // maximum congestion window size, in packets
+	int mss;                             // maximum packet size, including all packet headers
+	int32_t sndCurrSeqNo;                // current maximum seq no sent out
+	int rcvRate;                         // packet arrive rate at receiver side, packets per second
+	int usRTT;                           // estimated RTT, in microseconds
+	int bandwidth;                       // estimated bandwidth, packets per second
+	int usSYNInterval;                   // UDT SYN interval, in microseconds
+} UDT_CCPARAMS;
+
+// callbacks of user defined congestion control, handles are opaque values of the caller
+typedef struct UDT_CCCALLBACKS_ {
+	uintptr_t (*create)(uintptr_t factory, UDT_CCC cc);   // new congestion control of a connection
+	uintptr_t (*clone)(uintptr_t factory);               // copy of factory handle
+	void (*release)(uintptr_t handle);                   // release factory or congestion control handle
+	void (*init)(uintptr_t cc);
+	void (*close)(uintptr_t cc);
+	void (*onack)(uintptr_t cc, int32_t ackno);
+	void (*onloss)(uintptr_t cc, int32_t* losslist, int size);
+	void (*ontimeout)(uintptr_t cc);
+	void (*onpktsent)(uintptr_t cc, UDT_CCPACKET* pkt);
+	void (*onpktreceived)(uintptr_t cc, UDT_CCPACKET* pkt);
+	void (*processcustommsg)(uintptr_t cc, UDT_CCPACKET* pkt);
+} UDT_CCCALLBACKS;
+
+// set congestion control of the socket, the library keeps its own clone of factory handle
+UDT_API extern int udt_setcc(UDTSOCKET u, const UDT_CCCALLBACKS* cb, uintptr_t factory);
+// handle of congestion control of a connected socket, 0 if it is not user defined
+UDT_API extern int udt_getcc(UDTSOCKET u, uintptr_t* cc);
+// functions below may only be called from callbacks of the same congestion control
+UDT_API extern void udt_cc_getparams(UDT_CCC cc, UDT_CCPARAMS* params);
+UDT_API extern void udt_cc_setpktsndperiod(UDT_CCC cc, double usPeriod);
+UDT_API extern void udt_cc_setcwndsize(UDT_CCC cc, double pktSize);
+UDT_API extern void udt_cc_setacktimer(UDT_CCC cc, int msINT);
+UDT_API extern void udt_cc_setackinterval(UDT_CCC cc, int pktINT);
+UDT_API extern void udt_cc_setrto(UDT_CCC cc, int usRTO);
+UDT_API extern void udt_cc_sendcustommsg(UDT_CCC cc, int exttype, const char* data, int len);
+
 #ifdef __cplusplus
 }
 #endif
@@ -1,6 +1,8 @@
 package udtgo
 
 import (
+	"net"
+	"os"
 	"syscall"
 	"unsafe"
 )
@@ -170,4 +172,87 @@ func appendHex(dst []byte, i uint32) []byte {
 		}
 	}
 	return dst
-}
\ No newline at end of file
+}
+
+//Converts RawSockaddrAny structure to UDP address with IP and port
+
+func sockaddrToUDPAddr(rsa *syscall.RawSockaddrAny) (*net.UDPAddr, error) {
+	switch rsa.Addr.Family {
+	case syscall.AF_INET:
+		prsa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		pport := (*[2]byte)(unsafe.Pointer(&prsa.Port))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, prsa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(pport[0])<<8 | int(pport[1])}, nil
+
+	case syscall.AF_INET6:
+		prsa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		pport := (*[2]byte)(unsafe.Pointer(&prsa.Port))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, prsa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(pport[0])<<8 | int(pport[1]), Zone: ipv6IntToZone(int(prsa.Scope_id))}, nil
+	}
+	return nil, syscall.EAFNOSUPPORT
+}
+
+//Reports whether UDT can transfer regular file f directly. Files opened in append mode are
+//not supported since UDT writes at explicit offsets.
+
+func nativeFile(f osFile) bool {
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var ok bool
+	rc.Control(func(fd uintptr) {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+		ok = errno == 0 && flags&syscall.O_APPEND == 0
+	})
+	return ok
+}
+
+//Returns path under which UDT sendfile opens descriptor fd of a file for reading.
+
+func nativeFilePath(fd uintptr) string {
+	return "/proc/self/fd/" + uitoa(uint(fd))
+}
+
+//Duplicates descriptor of UDP connection, the duplicate is close-on-exec like descriptors
+//created by net package.
+
+func dupUDPConn(conn *net.UDPConn) (int, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	fd := -1
+	var dupErr error
+	err = rc.Control(func(cfd uintptr) {
+		fd, dupErr = dupFD(int(cfd))
+	})
+	if err != nil {
+		return -1, err
+	}
+	return fd, dupErr
+}
+
+//Duplicates fd with close-on-exec set, so the duplicate does not leak into child processes.
+
+func dupFD(fd int) (int, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	nfd, err := syscall.Dup(fd)
+	if err != nil {
+		return -1, os.NewSyscallError("dup", err)
+	}
+	syscall.CloseOnExec(nfd)
+	return nfd, nil
+}
+
+func closeFD(fd int) error {
+	return syscall.Close(fd)
+}
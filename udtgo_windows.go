@@ -1,6 +1,7 @@
 package udtgo
 
 import (
+	"net"
 	"syscall"
 	"unsafe"
 )
@@ -166,4 +167,44 @@ func appendHex(dst []byte, i uint32) []byte {
 		}
 	}
 	return dst
-}
\ No newline at end of file
+}
+
+func sockaddrToUDPAddr(rsa *syscall.RawSockaddrAny) (*net.UDPAddr, error) {
+	switch rsa.Addr.Family {
+	case syscall.AF_INET:
+		prsa := (*syscall.RawSockaddrInet4)(unsafe.Pointer(rsa))
+		pport := (*[2]byte)(unsafe.Pointer(&prsa.Port))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, prsa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(pport[0])<<8 | int(pport[1])}, nil
+
+	case syscall.AF_INET6:
+		prsa := (*syscall.RawSockaddrInet6)(unsafe.Pointer(rsa))
+		pport := (*[2]byte)(unsafe.Pointer(&prsa.Port))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, prsa.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: int(pport[0])<<8 | int(pport[1]), Zone: ipv6IntToZone(int(prsa.Scope_id))}, nil
+	}
+	return nil, syscall.EAFNOSUPPORT
+}
+
+//Native sendfile needs a path of the open file, which is not available on windows,
+//Conn.ReadFrom and Conn.WriteTo always copy through buffers.
+
+func nativeFile(f osFile) bool {
+	return false
+}
+
+func nativeFilePath(fd uintptr) string {
+	return ""
+}
+
+//Duplicating sockets for UDT is not supported on Windows, use BindFD with a socket handle.
+
+func dupUDPConn(conn *net.UDPConn) (int, error) {
+	return -1, syscall.EWINDOWS
+}
+
+func closeFD(fd int) error {
+	return syscall.Closesocket(syscall.Handle(fd))
+}